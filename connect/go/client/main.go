@@ -1,16 +1,26 @@
 package client
 
 import (
+	"crypto/tls"
 	"fmt"
+	"fullstackedorg/fullstacked/src/rpc"
 	"fullstackedorg/fullstacked/src/serialize"
 	"net"
 	"strconv"
+	"sync"
+	"time"
 )
 
 type DataClient struct {
 	socket net.Conn
 	buffer []byte
 	OnData func([]any)
+
+	writeMutex sync.Mutex
+	calls      rpc.Calls
+
+	handlersMutex sync.Mutex
+	handlers      map[string]rpc.Handler
 }
 
 func NewClient(channel string, port int) (*DataClient, error) {
@@ -18,7 +28,27 @@ func NewClient(channel string, port int) (*DataClient, error) {
 }
 
 func NewClientWithHostname(channel string, port int, hostname string) (*DataClient, error) {
-	c, err := net.Dial("tcp", hostname+":"+strconv.Itoa(port))
+	return NewClientWithOptions(channel, port, hostname, ClientOptions{})
+}
+
+type ClientOptions struct {
+	// nil for plaintext
+	TLS *tls.Config
+	// for channels created with a token
+	Token string
+}
+
+func NewClientWithOptions(channel string, port int, hostname string, options ClientOptions) (*DataClient, error) {
+	address := hostname + ":" + strconv.Itoa(port)
+
+	var c net.Conn
+	var err error
+	if options.TLS != nil {
+		c, err = tls.Dial("tcp", address, options.TLS)
+	} else {
+		c, err = net.Dial("tcp", address)
+	}
+
 	if err != nil {
 		return nil, err
 	}
@@ -28,7 +58,8 @@ func NewClientWithHostname(channel string, port int, hostname string) (*DataClie
 		buffer: []byte{},
 	}
 
-	dataClient.socket.Write(serialize.SerializeArgs([]any{channel}))
+	// the token field is always sent, empty without token
+	dataClient.socket.Write(serialize.SerializeArgs([]any{channel, options.Token}))
 
 	go dataClient.start()
 
@@ -42,6 +73,7 @@ func (dataClient *DataClient) start() {
 
 		if err != nil {
 			fmt.Println(err)
+			dataClient.calls.Cancel(err.Error())
 			return
 		}
 
@@ -58,26 +90,70 @@ func (dataClient *DataClient) tryReceive() bool {
 		return false
 	}
 
-	bodyLength := serialize.DeserializeBytesToInt(dataClient.buffer[0:4])
+	bodyLength, isRpc := rpc.ParseHeader(dataClient.buffer[0:4])
 	if bodyLength > len(dataClient.buffer)-4 {
 		return false
 	}
 
+	body := dataClient.buffer[4 : 4+bodyLength]
+	args := serialize.DeserializeArgs(body)
+
+	if isRpc {
+		dataClient.buffer = dataClient.buffer[4+bodyLength:]
+		if msg, ok := rpc.Parse(args); !ok {
+			fmt.Println("Invalid rpc frame for client")
+		} else if msg.Kind == rpc.KindCall {
+			dataClient.handlersMutex.Lock()
+			handler := dataClient.handlers[msg.Method]
+			dataClient.handlersMutex.Unlock()
+			go rpc.Serve(msg, handler, dataClient.writeFrame)
+		} else {
+			dataClient.calls.Resolve(msg)
+		}
+		return true
+	}
+
 	if dataClient.OnData == nil {
 		fmt.Println("No OnData func for client")
 		return false
 	}
 
-	body := dataClient.buffer[4 : 4+bodyLength]
-	dataClient.OnData(serialize.DeserializeArgs(body))
+	dataClient.OnData(args)
 	dataClient.buffer = dataClient.buffer[4+bodyLength:]
 	return true
 }
 
+func (dataClient *DataClient) writeFrame(payload []byte) error {
+	dataClient.writeMutex.Lock()
+	defer dataClient.writeMutex.Unlock()
+	_, err := dataClient.socket.Write(payload)
+	return err
+}
+
 func (dataClient *DataClient) Send(args []any) {
 	body := serialize.SerializeArgs(args)
-	bodyLength := len(body)
-	payload := serialize.SerializeIntToBytes(bodyLength)
-	payload = append(payload, body...)
-	dataClient.socket.Write(payload)
+	payload := serialize.SerializeIntToBytes(len(body))
+	dataClient.writeFrame(append(payload, body...))
+}
+
+// calls a method handled by the server channel,
+// safe to use from multiple goroutines.
+// 0 timeout waits until the connection drops
+func (dataClient *DataClient) Call(method string, args []any, timeout time.Duration) ([]any, error) {
+	return dataClient.calls.Call(dataClient.writeFrame, method, args, timeout)
+}
+
+// serves rpc calls from the server,
+// each call runs in its own goroutine
+func (dataClient *DataClient) Handle(method string, handler func(args []any) ([]any, error)) {
+	dataClient.handlersMutex.Lock()
+	if dataClient.handlers == nil {
+		dataClient.handlers = map[string]rpc.Handler{}
+	}
+	dataClient.handlers[method] = handler
+	dataClient.handlersMutex.Unlock()
+}
+
+func (dataClient *DataClient) Close() error {
+	return dataClient.socket.Close()
 }
@@ -1,17 +1,30 @@
 package server
 
 import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"strconv"
+	"sync"
+	"time"
 
+	"fullstackedorg/fullstacked/src/rpc"
 	"fullstackedorg/fullstacked/src/serialize"
 )
 
 type DataServer struct {
-	raw      bool
-	server   net.Listener
+	raw    bool
+	server net.Listener
+
+	mutex    sync.Mutex
 	channels map[string]*DataChannel
+	sockets  map[*DataSocket]bool
+	closed   bool
+
+	// running connection handlers
+	handlers sync.WaitGroup
 }
 
 func NewServer(port int) (*DataServer, error) {
@@ -26,40 +39,97 @@ func NewServerWithHostname(port int, hostname string) (*DataServer, error) {
 		return nil, err
 	}
 
+	return newDataServer(server), nil
+}
+
+// tlsConfig needs at least one certificate
+func NewServerWithTLS(port int, hostname string, tlsConfig *tls.Config) (*DataServer, error) {
+	address := hostname + ":" + strconv.Itoa(port)
+	server, err := tls.Listen("tcp", address, tlsConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newDataServer(server), nil
+}
+
+func newDataServer(server net.Listener) *DataServer {
 	dataServer := DataServer{
 		raw:      false,
 		server:   server,
 		channels: map[string]*DataChannel{},
+		sockets:  map[*DataSocket]bool{},
 	}
 
 	go dataServer.start()
 
-	return &dataServer, nil
+	return &dataServer
+}
+
+// useful when listening on port 0
+func (dataServer *DataServer) Addr() net.Addr {
+	return dataServer.server.Addr()
 }
 
 func (dataServer *DataServer) start() {
-	c, err := dataServer.server.Accept()
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
+	for {
+		c, err := dataServer.server.Accept()
+		if err != nil {
+			dataServer.mutex.Lock()
+			closed := dataServer.closed
+			dataServer.mutex.Unlock()
 
-	go dataServer.handleConnection(c)
-}
+			if closed {
+				return
+			}
+
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+
+			fmt.Println(err)
+			return
+		}
 
-func (dataServer *DataServer) handleConnection(c net.Conn) {
-	dataSocket := DataSocket{
-		socket:  c,
-		buffer:  []byte{},
-		channel: nil,
+		dataSocket := &DataSocket{
+			socket: c,
+			buffer: []byte{},
+		}
+
+		dataServer.mutex.Lock()
+		if dataServer.closed {
+			dataServer.mutex.Unlock()
+			c.Close()
+			return
+		}
+		dataServer.sockets[dataSocket] = true
+		dataServer.handlers.Add(1)
+		dataServer.mutex.Unlock()
+
+		go dataServer.handleConnection(dataSocket)
 	}
+}
+
+// Before the upgrade, nothing is authenticated:
+// the handshake must fit in maxHandshakeSize
+// and arrive within HandshakeTimeout
+const maxHandshakeSize = 4096
+
+var HandshakeTimeout = 10 * time.Second
+
+func (dataServer *DataServer) handleConnection(dataSocket *DataSocket) {
+	defer dataServer.handlers.Done()
+	defer dataServer.removeSocket(dataSocket)
+
+	dataSocket.socket.SetReadDeadline(time.Now().Add(HandshakeTimeout))
 
 	for {
 		buffer := make([]byte, 1024)
-		n, err := c.Read(buffer)
+		n, err := dataSocket.socket.Read(buffer)
 
 		if err != nil {
-			fmt.Println(err)
 			return
 		}
 
@@ -67,8 +137,8 @@ func (dataServer *DataServer) handleConnection(c net.Conn) {
 
 		keepProcessing := true
 		for keepProcessing {
-			if dataSocket.channel == nil {
-				keepProcessing = dataServer.tryUpgrade(&dataSocket)
+			if dataSocket.getChannel() == nil {
+				keepProcessing = dataServer.tryUpgrade(dataSocket)
 			} else {
 				keepProcessing = dataSocket.tryReceive()
 			}
@@ -77,85 +147,313 @@ func (dataServer *DataServer) handleConnection(c net.Conn) {
 	}
 }
 
+func (dataServer *DataServer) removeSocket(dataSocket *DataSocket) {
+	dataSocket.socket.Close()
+
+	dataServer.mutex.Lock()
+	delete(dataServer.sockets, dataSocket)
+	dataServer.mutex.Unlock()
+
+	dataSocket.calls.Cancel("socket disconnected")
+
+	dataChannel := dataSocket.getChannel()
+	if dataChannel == nil {
+		return
+	}
+
+	dataChannel.mutex.Lock()
+	for i, s := range dataChannel.dataSockets {
+		if s == dataSocket {
+			dataChannel.dataSockets = append(dataChannel.dataSockets[:i], dataChannel.dataSockets[i+1:]...)
+			break
+		}
+	}
+	onDisconnect := dataChannel.OnDisconnect
+	dataChannel.mutex.Unlock()
+
+	if onDisconnect != nil {
+		onDisconnect(dataSocket)
+	}
+}
+
+// serialized STRING at offset,
+// ok is false if the buffer doesn't hold a string,
+// next is where it ends once its length is received
+func readString(buffer []byte, offset int) (value string, next int, complete bool, ok bool) {
+	if len(buffer) <= offset {
+		return "", offset, false, true
+	}
+
+	if buffer[offset] != serialize.STRING {
+		return "", offset, false, false
+	}
+
+	if len(buffer) < offset+5 {
+		return "", offset, false, true
+	}
+
+	dataLength := serialize.DeserializeBytesToInt(buffer[offset+1 : offset+5])
+	if dataLength > len(buffer)-offset-5 {
+		return "", offset + 5 + dataLength, false, true
+	}
+
+	return string(buffer[offset+5 : offset+5+dataLength]), offset + 5 + dataLength, true, true
+}
+
+// handshake: channel name as a STRING,
+// followed by the token STRING, empty if the channel has none
 func (dataServer *DataServer) tryUpgrade(dataSocket *DataSocket) bool {
-	if dataSocket.buffer[0] != serialize.STRING {
+	channelName, next, complete, ok := readString(dataSocket.buffer, 0)
+
+	if !ok {
 		dataSocket.socket.Close()
 		return false
 	}
 
-	if len(dataSocket.buffer) < 5 {
-		return false
+	if !complete {
+		return dataServer.waitHandshake(dataSocket, next)
 	}
 
-	dataLength := serialize.DeserializeBytesToInt(dataSocket.buffer[1:5])
-	if dataLength > len(dataSocket.buffer)-5 {
+	dataServer.mutex.Lock()
+	dataChannel, ok := dataServer.channels[channelName]
+	dataServer.mutex.Unlock()
+
+	if !ok {
+		dataSocket.socket.Close()
+		fmt.Println("Socket trying to connect to unknown channel [" + channelName + "]")
 		return false
 	}
 
-	channelName := string(dataSocket.buffer[5 : 5+dataLength])
-	dataChannel, ok := dataServer.channels[channelName]
+	token, next, complete, ok := readString(dataSocket.buffer, next)
+
 	if !ok {
 		dataSocket.socket.Close()
-		fmt.Println("Socket trying to connect to unknown channel [" + channelName + "]")
+		fmt.Println("Socket missing token for channel [" + channelName + "]")
+		return false
+	}
+
+	if !complete {
+		return dataServer.waitHandshake(dataSocket, next)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token), []byte(dataChannel.token)) != 1 {
+		dataSocket.socket.Close()
+		fmt.Println("Socket with invalid token for channel [" + channelName + "]")
 		return false
 	}
 
 	fmt.Println("Socket upgrading to channel [" + channelName + "]")
 
-	dataSocket.buffer = dataSocket.buffer[5+dataLength:]
-	dataSocket.channel = dataChannel
+	dataSocket.socket.SetReadDeadline(time.Time{})
+	dataSocket.buffer = dataSocket.buffer[next:]
+	dataSocket.setChannel(dataChannel)
+
+	dataChannel.mutex.Lock()
 	dataChannel.dataSockets = append(dataChannel.dataSockets, dataSocket)
+	onConnect := dataChannel.OnConnect
+	dataChannel.mutex.Unlock()
+
+	if onConnect != nil {
+		onConnect(dataSocket)
+	}
+
 	return true
 }
 
+// an incomplete handshake waits for more data,
+// unless it already is, or announces to be, over the size limit
+func (dataServer *DataServer) waitHandshake(dataSocket *DataSocket, end int) bool {
+	if end > maxHandshakeSize || len(dataSocket.buffer) > maxHandshakeSize {
+		dataSocket.socket.Close()
+		fmt.Println("Socket handshake over " + strconv.Itoa(maxHandshakeSize) + " bytes")
+	}
+	return false
+}
+
 func (dataServer *DataServer) CreateChannel(name string) *DataChannel {
+	return dataServer.CreateChannelWithToken(name, "")
+}
+
+// sockets must send the same token after the channel name,
+// an empty token for channels created without one
+func (dataServer *DataServer) CreateChannelWithToken(name string, token string) *DataChannel {
 	dataChannel := &DataChannel{
 		name:        name,
+		token:       token,
 		dataSockets: []*DataSocket{},
 	}
+
+	dataServer.mutex.Lock()
 	dataServer.channels[name] = dataChannel
+	dataServer.mutex.Unlock()
+
 	return dataChannel
 }
 
+// stops accepting, disconnects all sockets
+// and waits for their handlers to return
+func (dataServer *DataServer) Close() error {
+	dataServer.mutex.Lock()
+	if dataServer.closed {
+		dataServer.mutex.Unlock()
+		return nil
+	}
+	dataServer.closed = true
+	err := dataServer.server.Close()
+	for dataSocket := range dataServer.sockets {
+		dataSocket.socket.Close()
+	}
+	dataServer.mutex.Unlock()
+
+	dataServer.handlers.Wait()
+
+	return err
+}
+
 type DataChannel struct {
 	name        string
+	token       string
+	mutex       sync.Mutex
 	dataSockets []*DataSocket
 	OnData      func([]any)
+	// called from the socket goroutine
+	OnConnect    func(*DataSocket)
+	OnDisconnect func(*DataSocket)
+
+	handlers map[string]func(*DataSocket, []any) ([]any, error)
 }
 
-func (dataChannel *DataChannel) Send(args []any) {
+// serves rpc calls from sockets,
+// each call runs in its own goroutine
+func (dataChannel *DataChannel) Handle(method string, handler func(dataSocket *DataSocket, args []any) ([]any, error)) {
+	dataChannel.mutex.Lock()
+	if dataChannel.handlers == nil {
+		dataChannel.handlers = map[string]func(*DataSocket, []any) ([]any, error){}
+	}
+	dataChannel.handlers[method] = handler
+	dataChannel.mutex.Unlock()
+}
+
+// calls a method handled by the socket,
+// 0 timeout waits until the socket disconnects
+func (dataChannel *DataChannel) Call(dataSocket *DataSocket, method string, args []any, timeout time.Duration) ([]any, error) {
+	if dataSocket.getChannel() != dataChannel {
+		return nil, errors.New("socket is not connected to channel [" + dataChannel.name + "]")
+	}
+
+	return dataSocket.calls.Call(dataSocket.write, method, args, timeout)
+}
+
+func (dataChannel *DataChannel) serve(dataSocket *DataSocket, msg rpc.Message) {
+	dataChannel.mutex.Lock()
+	handler := dataChannel.handlers[msg.Method]
+	dataChannel.mutex.Unlock()
+
+	var h rpc.Handler
+	if handler != nil {
+		h = func(args []any) ([]any, error) {
+			return handler(dataSocket, args)
+		}
+	}
+
+	go rpc.Serve(msg, h, dataSocket.write)
+}
+
+func frame(args []any) []byte {
 	body := serialize.SerializeArgs(args)
 	bodyLength := len(body)
 	payload := serialize.SerializeIntToBytes(bodyLength)
-	payload = append(payload, body...)
-	for _, dataSocket := range dataChannel.dataSockets {
-		dataSocket.socket.Write(payload)
+	return append(payload, body...)
+}
+
+// to all sockets of the channel
+func (dataChannel *DataChannel) Send(args []any) {
+	payload := frame(args)
+
+	dataChannel.mutex.Lock()
+	dataSockets := append([]*DataSocket{}, dataChannel.dataSockets...)
+	dataChannel.mutex.Unlock()
+
+	for _, dataSocket := range dataSockets {
+		dataSocket.write(payload)
+	}
+}
+
+func (dataChannel *DataChannel) SendTo(dataSocket *DataSocket, args []any) error {
+	if dataSocket.getChannel() != dataChannel {
+		return errors.New("socket is not connected to channel [" + dataChannel.name + "]")
 	}
+
+	return dataSocket.write(frame(args))
 }
 
 type DataSocket struct {
-	socket  net.Conn
-	buffer  []byte
+	socket     net.Conn
+	writeMutex sync.Mutex
+	buffer     []byte
+	calls      rpc.Calls
+
+	// set by the reader goroutine on upgrade,
+	// read from any goroutine
+	mutex   sync.Mutex
 	channel *DataChannel
 }
 
+func (dataSocket *DataSocket) getChannel() *DataChannel {
+	dataSocket.mutex.Lock()
+	defer dataSocket.mutex.Unlock()
+	return dataSocket.channel
+}
+
+func (dataSocket *DataSocket) setChannel(dataChannel *DataChannel) {
+	dataSocket.mutex.Lock()
+	defer dataSocket.mutex.Unlock()
+	dataSocket.channel = dataChannel
+}
+
+func (dataSocket *DataSocket) RemoteAddr() net.Addr {
+	return dataSocket.socket.RemoteAddr()
+}
+
+func (dataSocket *DataSocket) write(payload []byte) error {
+	dataSocket.writeMutex.Lock()
+	defer dataSocket.writeMutex.Unlock()
+	_, err := dataSocket.socket.Write(payload)
+	return err
+}
+
 func (dataSocket *DataSocket) tryReceive() bool {
 	if len(dataSocket.buffer) < 4 {
 		return false
 	}
 
-	bodyLength := serialize.DeserializeBytesToInt(dataSocket.buffer[0:4])
+	bodyLength, isRpc := rpc.ParseHeader(dataSocket.buffer[0:4])
 	if bodyLength > len(dataSocket.buffer)-4 {
 		return false
 	}
 
-	if dataSocket.channel.OnData == nil {
-		fmt.Println("No OnData func for channel [" + dataSocket.channel.name + "]")
+	body := dataSocket.buffer[4 : 4+bodyLength]
+	args := serialize.DeserializeArgs(body)
+	dataChannel := dataSocket.getChannel()
+
+	if isRpc {
+		dataSocket.buffer = dataSocket.buffer[4+bodyLength:]
+		if msg, ok := rpc.Parse(args); !ok {
+			fmt.Println("Invalid rpc frame for channel [" + dataChannel.name + "]")
+		} else if msg.Kind == rpc.KindCall {
+			dataChannel.serve(dataSocket, msg)
+		} else {
+			dataSocket.calls.Resolve(msg)
+		}
+		return true
+	}
+
+	if dataChannel.OnData == nil {
+		fmt.Println("No OnData func for channel [" + dataChannel.name + "]")
 		return false
 	}
 
-	body := dataSocket.buffer[4 : 4+bodyLength]
-	dataSocket.channel.OnData(serialize.DeserializeArgs(body))
+	dataChannel.OnData(args)
 	dataSocket.buffer = dataSocket.buffer[4+bodyLength:]
 	return true
 }
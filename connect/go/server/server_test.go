@@ -0,0 +1,364 @@
+package server
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"fullstacked/connect/client"
+	"fullstackedorg/fullstacked/src/serialize"
+)
+
+func newTestServer(t *testing.T) (*DataServer, int) {
+	dataServer, err := NewServerWithHostname(0, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dataServer.Close() })
+
+	return dataServer, dataServer.Addr().(*net.TCPAddr).Port
+}
+
+func newTestClient(t *testing.T, channel string, port int) *client.DataClient {
+	dataClient, err := client.NewClientWithHostname(channel, port, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dataClient.Close() })
+
+	return dataClient
+}
+
+func receive[T any](t *testing.T, c chan T) T {
+	select {
+	case v := <-c:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+
+	var zero T
+	return zero
+}
+
+func TestConnectAndDisconnect(t *testing.T) {
+	dataServer, port := newTestServer(t)
+	channel := dataServer.CreateChannel("test")
+
+	connected := make(chan *DataSocket, 1)
+	disconnected := make(chan *DataSocket, 1)
+	channel.OnConnect = func(dataSocket *DataSocket) { connected <- dataSocket }
+	channel.OnDisconnect = func(dataSocket *DataSocket) { disconnected <- dataSocket }
+
+	dataClient := newTestClient(t, "test", port)
+
+	dataSocket := receive(t, connected)
+	if dataSocket.RemoteAddr() == nil {
+		t.Fatal("no remote address")
+	}
+
+	dataClient.Close()
+
+	if receive(t, disconnected) != dataSocket {
+		t.Fatal("disconnected another socket")
+	}
+
+	if err := channel.SendTo(dataSocket, []any{"gone"}); err == nil {
+		t.Fatal("expected an error sending to a disconnected socket")
+	}
+}
+
+func TestUnknownChannel(t *testing.T) {
+	dataServer, port := newTestServer(t)
+	channel := dataServer.CreateChannel("test")
+
+	connected := make(chan *DataSocket, 1)
+	channel.OnConnect = func(dataSocket *DataSocket) { connected <- dataSocket }
+
+	dataClient := newTestClient(t, "other", port)
+
+	// the server closes the socket, calls fail
+	_, err := dataClient.Call("method", nil, 5*time.Second)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	select {
+	case <-connected:
+		t.Fatal("connected to the wrong channel")
+	default:
+	}
+}
+
+func TestSendAndSendTo(t *testing.T) {
+	dataServer, port := newTestServer(t)
+	channel := dataServer.CreateChannel("test")
+	other := dataServer.CreateChannel("other")
+
+	received := make(chan []any, 1)
+	channel.OnData = func(args []any) { received <- args }
+
+	connected := make(chan *DataSocket, 2)
+	channel.OnConnect = func(dataSocket *DataSocket) { connected <- dataSocket }
+
+	first := newTestClient(t, "test", port)
+	firstSocket := receive(t, connected)
+	second := newTestClient(t, "test", port)
+	receive(t, connected)
+
+	firstData := make(chan []any, 2)
+	secondData := make(chan []any, 2)
+	first.OnData = func(args []any) { firstData <- args }
+	second.OnData = func(args []any) { secondData <- args }
+
+	first.Send([]any{"from client", float64(1), true})
+	args := receive(t, received)
+	if len(args) != 3 || args[0] != "from client" || args[1] != float64(1) || args[2] != true {
+		t.Fatalf("unexpected %v", args)
+	}
+
+	if err := channel.SendTo(firstSocket, []any{"only first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if args := receive(t, firstData); args[0] != "only first" {
+		t.Fatalf("unexpected %v", args)
+	}
+
+	channel.Send([]any{"everyone"})
+
+	if args := receive(t, firstData); args[0] != "everyone" {
+		t.Fatalf("unexpected %v", args)
+	}
+	if args := receive(t, secondData); args[0] != "everyone" {
+		t.Fatalf("second got %v, SendTo reached it", args)
+	}
+
+	if err := other.SendTo(firstSocket, []any{"wrong channel"}); err == nil {
+		t.Fatal("expected an error sending through another channel")
+	}
+}
+
+func TestTokenChannel(t *testing.T) {
+	dataServer, port := newTestServer(t)
+	channel := dataServer.CreateChannelWithToken("secure", "secret")
+
+	connected := make(chan *DataSocket, 1)
+	channel.OnConnect = func(dataSocket *DataSocket) { connected <- dataSocket }
+
+	wrong, err := client.NewClientWithOptions("secure", port, "127.0.0.1", client.ClientOptions{Token: "nope"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wrong.Close()
+
+	if _, err := wrong.Call("method", nil, 5*time.Second); err == nil {
+		t.Fatal("expected the wrong token to be rejected")
+	}
+
+	right, err := client.NewClientWithOptions("secure", port, "127.0.0.1", client.ClientOptions{Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer right.Close()
+
+	receive(t, connected)
+}
+
+// sends the handshake and a frame,
+// true if the server closes the socket
+func rejected(t *testing.T, port int, handshake []byte) bool {
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	body := serialize.SerializeArgs([]any{"frame"})
+	conn.Write(append(handshake, append(serialize.SerializeIntToBytes(len(body)), body...)...))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	return err == io.EOF
+}
+
+func TestTokenField(t *testing.T) {
+	dataServer, port := newTestServer(t)
+	channel := dataServer.CreateChannel("test")
+
+	received := make(chan []any, 1)
+	channel.OnData = func(args []any) { received <- args }
+
+	// token sent to a tokenless channel
+	if !rejected(t, port, serialize.SerializeArgs([]any{"test", "secret"})) {
+		t.Fatal("expected a token to be rejected on a tokenless channel")
+	}
+
+	// no token field
+	if !rejected(t, port, serialize.SerializeArgs([]any{"test"})) {
+		t.Fatal("expected a missing token field to be rejected")
+	}
+
+	// empty token field
+	if rejected(t, port, serialize.SerializeArgs([]any{"test", ""})) {
+		t.Fatal("expected an empty token to connect")
+	}
+
+	if args := receive(t, received); len(args) != 1 || args[0] != "frame" {
+		t.Fatalf("unexpected %v", args)
+	}
+}
+
+// true if the server closes the socket
+// within a second of sending data
+func closedAfter(t *testing.T, conn net.Conn, data []byte) bool {
+	conn.Write(data)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := conn.Read(make([]byte, 1))
+
+	// reset if closed with unread data
+	timeout, ok := err.(net.Error)
+	return err != nil && !(ok && timeout.Timeout())
+}
+
+func TestHandshakeLimits(t *testing.T) {
+	timeout := HandshakeTimeout
+	HandshakeTimeout = 200 * time.Millisecond
+	defer func() { HandshakeTimeout = timeout }()
+
+	dataServer, port := newTestServer(t)
+	channel := dataServer.CreateChannel("test")
+
+	received := make(chan []any, 1)
+	channel.OnData = func(args []any) { received <- args }
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	// a ~2GB channel name
+	huge := append([]byte{serialize.STRING}, serialize.SerializeIntToBytes(1<<31-1)...)
+	if !closedAfter(t, dial(), huge) {
+		t.Fatal("expected an oversized channel name to be rejected")
+	}
+
+	// a token over the limit, sent in full
+	handshake := serialize.SerializeArgs([]any{"test", strings.Repeat("x", 5000)})
+	if !closedAfter(t, dial(), handshake) {
+		t.Fatal("expected an oversized token to be rejected")
+	}
+
+	// never completes the handshake
+	if !closedAfter(t, dial(), []byte{serialize.STRING}) {
+		t.Fatal("expected an incomplete handshake to time out")
+	}
+
+	// upgraded sockets have no deadline
+	c, err := client.NewClientWithHostname("test", port, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	time.Sleep(2 * HandshakeTimeout)
+	c.Send([]any{"late"})
+
+	if args := receive(t, received); len(args) != 1 || args[0] != "late" {
+		t.Fatalf("unexpected %v", args)
+	}
+}
+
+func TestCall(t *testing.T) {
+	dataServer, port := newTestServer(t)
+	channel := dataServer.CreateChannel("test")
+
+	connected := make(chan *DataSocket, 1)
+	channel.OnConnect = func(dataSocket *DataSocket) { connected <- dataSocket }
+	channel.Handle("add", func(dataSocket *DataSocket, args []any) ([]any, error) {
+		return []any{args[0].(float64) + args[1].(float64)}, nil
+	})
+
+	dataClient := newTestClient(t, "test", port)
+	dataClient.Handle("echo", func(args []any) ([]any, error) {
+		return args, nil
+	})
+
+	results, err := dataClient.Call("add", []any{float64(1), float64(2)}, 5*time.Second)
+	if err != nil || results[0] != float64(3) {
+		t.Fatalf("unexpected %v %v", results, err)
+	}
+
+	// from another goroutine than the socket reader
+	dataSocket := receive(t, connected)
+	results, err = channel.Call(dataSocket, "echo", []any{"hi"}, 5*time.Second)
+	if err != nil || results[0] != "hi" {
+		t.Fatalf("unexpected %v %v", results, err)
+	}
+}
+
+func TestRpcLookalikeData(t *testing.T) {
+	dataServer, port := newTestServer(t)
+	channel := dataServer.CreateChannel("test")
+
+	received := make(chan []any, 1)
+	channel.OnData = func(args []any) { received <- args }
+	channel.Handle("method", func(dataSocket *DataSocket, args []any) ([]any, error) {
+		t.Error("data frame served as a call")
+		return nil, nil
+	})
+
+	dataClient := newTestClient(t, "test", port)
+
+	// rpc frames are flagged in the header, not by their content
+	dataClient.Send([]any{"rpc", "call", float64(0), "method"})
+
+	args := receive(t, received)
+	if len(args) != 4 || args[0] != "rpc" || args[3] != "method" {
+		t.Fatalf("unexpected %v", args)
+	}
+}
+
+func TestClose(t *testing.T) {
+	dataServer, port := newTestServer(t)
+	channel := dataServer.CreateChannel("test")
+
+	connected := make(chan *DataSocket, 1)
+	disconnected := make(chan *DataSocket, 1)
+	channel.OnConnect = func(dataSocket *DataSocket) { connected <- dataSocket }
+	channel.OnDisconnect = func(dataSocket *DataSocket) { disconnected <- dataSocket }
+
+	dataClient := newTestClient(t, "test", port)
+	receive(t, connected)
+
+	if err := dataServer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// handlers have returned
+	select {
+	case <-disconnected:
+	default:
+		t.Fatal("OnDisconnect not called before Close returned")
+	}
+
+	if _, err := dataClient.Call("method", nil, 5*time.Second); err == nil {
+		t.Fatal("expected the client to be disconnected")
+	}
+
+	if _, err := net.Dial("tcp", dataServer.Addr().String()); err == nil {
+		t.Fatal("server still accepting")
+	}
+
+	// closing twice is fine
+	if err := dataServer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
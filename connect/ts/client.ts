@@ -5,7 +5,7 @@ import {
     numberTo4Bytes,
     serializeArgs
 } from "../../fullstacked_modules/bridge/serialization";
-import { Data, DataListener } from "./server";
+import { Data, DataListener, RPC_FRAME } from "./server";
 
 type DataSocketClient = {
     socket: net.Socket;
@@ -15,12 +15,16 @@ type DataSocketClient = {
 
 function trySend(dataSocketClient: DataSocketClient) {
     if (dataSocketClient.buffer.byteLength < 5) return false;
-    const dataLength = bytesToNumber(dataSocketClient.buffer.slice(0, 4));
+    const header = bytesToNumber(dataSocketClient.buffer.slice(0, 4));
+    const dataLength = header & ~RPC_FRAME;
     if (dataLength > dataSocketClient.buffer.byteLength - 4) return false;
-    const data = deserializeArgs(
-        dataSocketClient.buffer.slice(4, 4 + dataLength)
-    );
-    dataSocketClient.listeners.forEach((cb) => cb(data));
+    // rpc is not served here
+    if (!(header & RPC_FRAME)) {
+        const data = deserializeArgs(
+            dataSocketClient.buffer.slice(4, 4 + dataLength)
+        );
+        dataSocketClient.listeners.forEach((cb) => cb(data));
+    }
     dataSocketClient.buffer = dataSocketClient.buffer.slice(4 + dataLength);
     return true;
 }
@@ -45,7 +49,8 @@ export function connect(channel: string, port: number, host?: string) {
         listeners: new Set<DataListener>()
     };
     dataSocketClient.socket.connect(port, host);
-    dataSocketClient.socket.write(serializeArgs([channel]));
+    // the token field is always sent, empty without token
+    dataSocketClient.socket.write(serializeArgs([channel, ""]));
     dataSocketClient.socket.on("data", onData.bind(dataSocketClient));
 
     const methods = {
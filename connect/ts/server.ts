@@ -9,6 +9,9 @@ import {
 
 export type Data = string | number | boolean | Uint8Array;
 
+// high bit of the frame length, set on rpc frames
+export const RPC_FRAME = 0x80000000;
+
 type DataSocket = {
     socket: net.Socket;
     buffer: Uint8Array;
@@ -103,18 +106,41 @@ function createChannel(
 
 const td = new TextDecoder();
 
+// Before the upgrade, nothing is authenticated:
+// the handshake must fit in MAX_HANDSHAKE_SIZE
+// and arrive within HANDSHAKE_TIMEOUT
+const MAX_HANDSHAKE_SIZE = 4096;
+const HANDSHAKE_TIMEOUT = 10 * 1000; // 10s
+
+// STRING at offset, null if not a STRING,
+// value is null until complete, next once its length is received
+function readString(buffer: Uint8Array, offset: number) {
+    if (buffer.byteLength <= offset) return { value: null, next: offset };
+    if (buffer.at(offset) !== DataType.STRING) return null;
+    if (buffer.byteLength < offset + 5) return { value: null, next: offset };
+
+    const dataLength = bytesToNumber(buffer.slice(offset + 1, offset + 5));
+    if (dataLength > buffer.byteLength - offset - 5) {
+        return { value: null, next: offset + 5 + dataLength };
+    }
+
+    return {
+        value: td.decode(buffer.slice(offset + 5, offset + 5 + dataLength)),
+        next: offset + 5 + dataLength
+    };
+}
+
+// handshake: channel name as a STRING,
+// followed by the token STRING, always empty here
 function tryUpgrade(server: DataServer, dataSocket: DataSocket) {
-    if (dataSocket.buffer.at(0) !== DataType.STRING) {
+    const name = readString(dataSocket.buffer, 0);
+    if (name === null) {
         dataSocket.socket.end();
         return false;
     }
+    if (name.value === null) return waitHandshake(dataSocket, name.next);
 
-    if (dataSocket.buffer.byteLength < 5) return false;
-
-    const dataLength = bytesToNumber(dataSocket.buffer.slice(1, 5));
-    if (dataLength > dataSocket.buffer.byteLength - 5) return false;
-
-    const channelName = td.decode(dataSocket.buffer.slice(5, 5 + dataLength));
+    const channelName = name.value;
     if (!server.channels.has(channelName)) {
         dataSocket.socket.end();
         console.log(
@@ -123,9 +149,24 @@ function tryUpgrade(server: DataServer, dataSocket: DataSocket) {
         return false;
     }
 
+    const token = readString(dataSocket.buffer, name.next);
+    if (token === null) {
+        dataSocket.socket.end();
+        console.log(`Socket missing token for channel [${channelName}]`);
+        return false;
+    }
+    if (token.value === null) return waitHandshake(dataSocket, token.next);
+
+    if (token.value !== "") {
+        dataSocket.socket.end();
+        console.log(`Socket with invalid token for channel [${channelName}]`);
+        return false;
+    }
+
     console.log(`Socket upgrading to channel [${channelName}]`);
 
-    dataSocket.buffer = dataSocket.buffer.slice(5 + dataLength);
+    dataSocket.socket.setTimeout(0);
+    dataSocket.buffer = dataSocket.buffer.slice(token.next);
     dataSocket.channel = server.channels.get(channelName);
     dataSocket.channel.dataSockets.add(dataSocket);
     server.connecting.delete(dataSocket);
@@ -135,6 +176,19 @@ function tryUpgrade(server: DataServer, dataSocket: DataSocket) {
     return true;
 }
 
+// an incomplete handshake waits for more data,
+// unless it already is, or announces to be, over the size limit
+function waitHandshake(dataSocket: DataSocket, end: number) {
+    if (
+        end > MAX_HANDSHAKE_SIZE ||
+        dataSocket.buffer.byteLength > MAX_HANDSHAKE_SIZE
+    ) {
+        dataSocket.socket.destroy();
+        console.log(`Socket handshake over ${MAX_HANDSHAKE_SIZE} bytes`);
+    }
+    return false;
+}
+
 function tryReceive(dataSocket: DataSocket) {
     if (dataSocket.channel.raw) {
         dataSocket.channel.receive(dataSocket.buffer);
@@ -143,11 +197,15 @@ function tryReceive(dataSocket: DataSocket) {
     }
 
     if (dataSocket.buffer.byteLength < 4) return false;
-    const bodyLength = bytesToNumber(dataSocket.buffer.slice(0, 4));
+    const header = bytesToNumber(dataSocket.buffer.slice(0, 4));
+    const bodyLength = header & ~RPC_FRAME;
     if (bodyLength > dataSocket.buffer.byteLength - 4) return false;
 
-    const body = dataSocket.buffer.slice(4, 4 + bodyLength);
-    dataSocket.channel.receive(deserializeArgs(body));
+    // rpc is not served here
+    if (!(header & RPC_FRAME)) {
+        const body = dataSocket.buffer.slice(4, 4 + bodyLength);
+        dataSocket.channel.receive(deserializeArgs(body));
+    }
     dataSocket.buffer = dataSocket.buffer.slice(4 + bodyLength);
     return true;
 }
@@ -180,6 +238,10 @@ function connectSocket(this: DataServer, socket: net.Socket) {
     };
 
     this.connecting.add(dataSocket);
+    socket.setTimeout(HANDSHAKE_TIMEOUT);
+    socket.on("timeout", () => {
+        if (this.connecting.has(dataSocket)) socket.destroy();
+    });
     socket.on("data", onData.bind({ server: this, socket: dataSocket }));
     socket.on("close", () => this.connecting.delete(dataSocket));
 }
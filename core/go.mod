@@ -12,6 +12,7 @@ require (
 )
 
 require (
+	github.com/fsnotify/fsnotify v1.10.1
 	github.com/go-git/go-billy/v5 v5.7.0
 	github.com/microsoft/typescript-go v0.0.0
 	golang.org/x/net v0.50.0
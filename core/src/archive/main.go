@@ -164,6 +164,7 @@ func ZipDataToDataSerialized(entries []FileEntry) []byte {
 	return serialize.SerializeBuffer(Zip(entries))
 }
 
+// skip is a list of glob patterns, see the glob package
 func DirectoryToFileEntries(in string, skip []string) ([]FileEntry, error) {
 	exists, isFile := fs.Exists(in)
 
@@ -173,7 +174,8 @@ func DirectoryToFileEntries(in string, skip []string) ([]FileEntry, error) {
 		return nil, errors.New("directory to zip is not a directory")
 	}
 
-	files, err := fs.ReadDir(in, true, false, []string{})
+	// skipped directories are not walked
+	files, err := fs.ReadDir(in, true, false, skip, nil)
 
 	if err != nil {
 		return nil, err
@@ -182,18 +184,6 @@ func DirectoryToFileEntries(in string, skip []string) ([]FileEntry, error) {
 	entries := []FileEntry{}
 
 	for _, f := range files {
-
-		mustSkip := false
-		for _, p := range skip {
-			if strings.HasPrefix(f.Name, p) {
-				mustSkip = true
-				break
-			}
-		}
-		if mustSkip {
-			continue
-		}
-
 		data := ([]byte)(nil)
 		if !f.IsDir {
 			data, err = fs.ReadFile(path.Join(in, f.Name))
@@ -32,7 +32,7 @@ func EsbuildVersion() string {
 }
 
 func findEntryPoint(directory string, filenames []string) *string {
-	items, _ := fs.ReadDir(directory, false, false, []string{})
+	items, _ := fs.ReadDir(directory, false, false, nil, nil)
 
 	entryPoint := (*string)(nil)
 
@@ -316,7 +316,7 @@ type HTMLBuildResult struct {
 func (p *ProjectBuild) BuildHTML() HTMLBuildResult {
 	projectDirectory := path.Join(setup.Directories.Root, p.ProjectID)
 
-	items, _ := fs.ReadDir(projectDirectory, true, true, []string{"node_modules", ".build"})
+	items, _ := fs.ReadDir(projectDirectory, true, true, []string{"/node_modules", "/.build"}, []string{"*index.html"})
 
 	result := HTMLBuildResult{
 		Errors:      []esbuild.Message{},
@@ -324,10 +324,6 @@ func (p *ProjectBuild) BuildHTML() HTMLBuildResult {
 	}
 
 	for _, file := range items {
-		if !strings.HasSuffix(file.Name, "index.html") {
-			continue
-		}
-
 		result.OutputFiles = append(result.OutputFiles, esbuild.OutputFile{
 			Path:     file.Name,
 			Contents: SetupHTML(path.Join(projectDirectory, file.Name)),
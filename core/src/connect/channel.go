@@ -1,15 +1,26 @@
 package connect
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
-	"fmt"
+	"encoding/hex"
+	"errors"
+	"fullstackedorg/fullstacked/src/rpc"
 	"fullstackedorg/fullstacked/src/serialize"
 	"fullstackedorg/fullstacked/src/setup"
 	"net"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+var minReconnectDelay = time.Millisecond * 500
+var maxReconnectDelay = time.Second * 30
+
 type Channel struct {
 	ProjectId string
 	Id        string
@@ -17,38 +28,195 @@ type Channel struct {
 	Port      int
 	Host      string
 	Raw       bool
-	buffer    []byte
-	conn      net.Conn
+	Reconnect bool
+	// sent after the channel name,
+	// empty for channels without token
+	Token string
+	TLS   bool
+	// PEM certificates trusted on top of the system ones
+	TLSCA string
+	// SHA-256 of the server certificate in hex, colons allowed,
+	// for self-signed certificates on the LAN
+	TLSFingerprint string
+	buffer         []byte
+
+	// in-flight rpc calls,
+	// cancelled when the connection drops
+	calls rpc.Calls
+
+	mutex  sync.Mutex
+	conn   net.Conn
+	closed bool
+	done   chan struct{}
+}
+
+// lifecycle events are sent to "channel-status-<id>"
+//   - ["connected"] on the first connection and after reconnecting
+//   - ["error", message]
+//   - ["closed"]
+func (c *Channel) emit(event string, args ...string) {
+	data := serialize.SerializeString(event)
+	for _, arg := range args {
+		data = append(data, serialize.SerializeString(arg)...)
+	}
+	setup.Callback(c.ProjectId, "channel-status-"+c.Id, base64.StdEncoding.EncodeToString(data))
 }
 
-func (c *Channel) connect() {
-	fmt.Println("Connecting to " + c.Host + ":" + strconv.Itoa(c.Port))
+func (c *Channel) connect() error {
+	address := net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	dialer := &net.Dialer{Timeout: time.Second}
 
-	conn, err := net.DialTimeout("tcp", c.Host+":"+strconv.Itoa(c.Port), time.Second)
+	var conn net.Conn
+	var err error
+	if c.TLS {
+		var config *tls.Config
+		config, err = c.tlsConfig()
+		if err != nil {
+			return err
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, config)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
 
-	_, err = conn.Write(serialize.SerializeString(c.Name))
+	// the token field is always sent, empty without token
+	handshake := serialize.SerializeString(c.Name)
+	handshake = append(handshake, serialize.SerializeString(c.Token)...)
+
+	_, err = conn.Write(handshake)
 	if err != nil {
-		fmt.Println(err)
-		return
+		conn.Close()
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		conn.Close()
+		return errors.New("channel closed")
 	}
 
 	c.conn = conn
+	c.buffer = nil
+
+	return nil
+}
+
+func (c *Channel) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{ServerName: c.Host}
+
+	if c.TLSCA != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(c.TLSCA)) {
+			return nil, errors.New("no valid certificate in CA")
+		}
+		config.RootCAs = pool
+	}
+
+	if c.TLSFingerprint != "" {
+		fingerprint, err := hex.DecodeString(strings.ReplaceAll(c.TLSFingerprint, ":", ""))
+		if err != nil || len(fingerprint) != sha256.Size {
+			return nil, errors.New("invalid certificate fingerprint")
+		}
+
+		// the pinned certificate replaces the chain verification
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("no server certificate")
+			}
+			sum := sha256.Sum256(rawCerts[0])
+			if subtle.ConstantTimeCompare(sum[:], fingerprint) != 1 {
+				return errors.New("server certificate fingerprint mismatch")
+			}
+			return nil
+		}
+	}
+
+	return config, nil
+}
+
+func (c *Channel) isClosed() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.closed
 }
 
 func (c *Channel) start() {
-	if c.conn == nil {
+	c.mutex.Lock()
+	connected := c.conn != nil
+	c.mutex.Unlock()
+
+	if connected {
+		c.emit("connected")
+	}
+
+	for {
+		c.read()
+
+		if c.isClosed() || !c.Reconnect || !c.reconnect() {
+			break
+		}
+	}
+
+	c.close()
+	removeChannel(c.Id)
+	c.emit("closed")
+}
+
+// retries with exponential backoff until connected or closed
+func (c *Channel) reconnect() bool {
+	delay := minReconnectDelay
+
+	for {
+		select {
+		case <-c.done:
+			return false
+		case <-time.After(delay):
+		}
+
+		err := c.connect()
+		if err == nil {
+			c.emit("connected")
+			return true
+		}
+
+		if c.isClosed() {
+			return false
+		}
+
+		c.emit("error", err.Error())
+
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// reads until the connection fails
+func (c *Channel) read() {
+	c.mutex.Lock()
+	conn := c.conn
+	c.mutex.Unlock()
+
+	if conn == nil {
 		return
 	}
 
 	for {
 		buf := make([]byte, 1024)
-		size, err := c.conn.Read(buf)
+		size, err := conn.Read(buf)
 		if err != nil {
-			fmt.Println(err.Error())
+			if !c.isClosed() {
+				c.emit("error", err.Error())
+			}
+			conn.Close()
+			c.calls.Cancel("connection lost")
 			return
 		}
 
@@ -66,13 +234,23 @@ func (c *Channel) receive() {
 		return
 	}
 
-	bodyLength := serialize.DeserializeBytesToInt(c.buffer[0:4])
+	bodyLength, isRpc := rpc.ParseHeader(c.buffer[0:4])
 	if len(c.buffer) < bodyLength+4 {
 		return
 	}
 
 	body := c.buffer[4 : 4+bodyLength]
-	setup.Callback(c.ProjectId, "channel-"+c.Id, base64.RawStdEncoding.EncodeToString(body))
+
+	if !isRpc {
+		setup.Callback(c.ProjectId, "channel-"+c.Id, base64.RawStdEncoding.EncodeToString(body))
+	} else if msg, ok := rpc.Parse(serialize.DeserializeArgs(body)); ok {
+		if msg.Kind == rpc.KindCall {
+			// no methods are served from here
+			go rpc.Serve(msg, nil, c.writeFrame)
+		} else {
+			c.calls.Resolve(msg)
+		}
+	}
 
 	c.buffer = c.buffer[4+bodyLength:]
 	if len(c.buffer) > 0 {
@@ -81,8 +259,57 @@ func (c *Channel) receive() {
 }
 
 func (c *Channel) send(data []byte) {
-	if c.conn == nil {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.conn == nil || c.closed {
 		return
 	}
 	c.conn.Write(data)
 }
+
+func (c *Channel) writeFrame(payload []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.conn == nil || c.closed {
+		return errors.New("channel not connected")
+	}
+
+	_, err := c.conn.Write(payload)
+	return err
+}
+
+// result is sent to "channel-rpc-<id>"
+//   - [callId, true, ...results]
+//   - [callId, false, message]
+func (c *Channel) call(callId float64, method string, args []any, timeout time.Duration) {
+	results, err := c.calls.Call(c.writeFrame, method, args, timeout)
+
+	data := serialize.SerializeNumber(callId)
+	if err != nil {
+		data = append(data, serialize.SerializeBoolean(false)...)
+		data = append(data, serialize.SerializeString(err.Error())...)
+	} else {
+		data = append(data, serialize.SerializeBoolean(true)...)
+		data = append(data, serialize.SerializeArgs(results)...)
+	}
+
+	setup.Callback(c.ProjectId, "channel-rpc-"+c.Id, base64.StdEncoding.EncodeToString(data))
+}
+
+func (c *Channel) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	c.closed = true
+	close(c.done)
+
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
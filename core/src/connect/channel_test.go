@@ -0,0 +1,72 @@
+package connect
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(nil)
+	defer server.Close()
+
+	address := server.Listener.Addr().String()
+	certificate := server.Certificate()
+
+	ca := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw}))
+	sum := sha256.Sum256(certificate.Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	var colons []string
+	for i := 0; i < len(fingerprint); i += 2 {
+		colons = append(colons, strings.ToUpper(fingerprint[i:i+2]))
+	}
+
+	other := sha256.Sum256([]byte("other"))
+
+	tests := []struct {
+		name        string
+		ca          string
+		fingerprint string
+		// "" for a successful handshake
+		err string
+	}{
+		{"system only", "", "", "certificate"},
+		{"ca", ca, "", ""},
+		{"invalid ca", "nope", "", "no valid certificate in CA"},
+		{"fingerprint", "", fingerprint, ""},
+		{"fingerprint with colons", "", strings.Join(colons, ":"), ""},
+		{"fingerprint mismatch", "", hex.EncodeToString(other[:]), "fingerprint mismatch"},
+		{"invalid fingerprint", "", "abc", "invalid certificate fingerprint"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			channel := &Channel{
+				Host:           "127.0.0.1",
+				TLSCA:          test.ca,
+				TLSFingerprint: test.fingerprint,
+			}
+			config, err := channel.tlsConfig()
+			if err == nil {
+				var conn *tls.Conn
+				conn, err = tls.Dial("tcp", address, config)
+				if err == nil {
+					conn.Close()
+				}
+			}
+
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
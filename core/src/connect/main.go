@@ -1,40 +1,108 @@
 package connect
 
 import (
+	"errors"
+	"sync"
+	"time"
+
 	"fullstackedorg/fullstacked/src/utils"
 )
 
-var channels = map[string]Channel{}
+var channelsMutex = sync.Mutex{}
+var channels = map[string]*Channel{}
 
+// with reconnect, the channel is returned
+// even if the first connection fails
 func Connect(
 	projectId string,
 	name string,
 	port float64,
 	host string,
 	raw bool,
-) string {
+	reconnect bool,
+	token string,
+	useTLS bool,
+	tlsCA string,
+	tlsFingerprint string,
+) (string, error) {
 	channelId := utils.RandString(6)
-	channel := Channel{
-		ProjectId: projectId,
-		Id:        channelId,
-		Name:      name,
-		Port:      int(port),
-		Host:      host,
-		Raw:       raw,
+	channel := &Channel{
+		ProjectId:      projectId,
+		Id:             channelId,
+		Name:           name,
+		Port:           int(port),
+		Host:           host,
+		Raw:            raw,
+		Reconnect:      reconnect,
+		Token:          token,
+		TLS:            useTLS,
+		TLSCA:          tlsCA,
+		TLSFingerprint: tlsFingerprint,
+		done:           make(chan struct{}),
+	}
+
+	err := channel.connect()
+	if err != nil && !reconnect {
+		return "", err
 	}
-	channel.connect()
+
+	channelsMutex.Lock()
 	channels[channelId] = channel
+	channelsMutex.Unlock()
+
 	go channel.start()
-	return channelId
+	return channelId, nil
+}
+
+func getChannel(channelId string) *Channel {
+	channelsMutex.Lock()
+	defer channelsMutex.Unlock()
+	return channels[channelId]
+}
+
+func removeChannel(channelId string) {
+	channelsMutex.Lock()
+	delete(channels, channelId)
+	channelsMutex.Unlock()
 }
 
 func Send(
 	channelId string,
 	data []byte,
 ) {
-	channel, ok := channels[channelId]
-	if !ok {
+	channel := getChannel(channelId)
+	if channel == nil {
 		return
 	}
 	channel.send(data)
 }
+
+func Close(channelId string) {
+	channel := getChannel(channelId)
+	if channel == nil {
+		return
+	}
+	channel.close()
+}
+
+// rpc call over a non-raw channel,
+// timeout in milliseconds, 0 for none
+func Call(
+	channelId string,
+	callId float64,
+	method string,
+	args []any,
+	timeout float64,
+) error {
+	channel := getChannel(channelId)
+	if channel == nil {
+		return errors.New("unknown channel [" + channelId + "]")
+	}
+
+	if channel.Raw {
+		return errors.New("rpc is not available on raw channels")
+	}
+
+	go channel.call(callId, method, args, time.Duration(timeout*float64(time.Millisecond)))
+	return nil
+}
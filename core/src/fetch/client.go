@@ -0,0 +1,133 @@
+package fetch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+type RedirectPolicy = string
+
+const (
+	REDIRECT_FOLLOW RedirectPolicy = "follow"
+	REDIRECT_MANUAL RedirectPolicy = "manual"
+	REDIRECT_ERROR  RedirectPolicy = "error"
+)
+
+type TLSOptions struct {
+	// PEM encoded certificates
+	// trusted in addition to the system pool
+	CA string `json:"ca"`
+	// local dev only
+	Insecure bool `json:"insecure"`
+}
+
+type ClientOptions struct {
+	// seconds, 0 is no timeout
+	Timeout  float64        `json:"timeout"`
+	Redirect RedirectPolicy `json:"redirect"`
+	TLS      TLSOptions     `json:"tls"`
+	Proxy    string         `json:"proxy"`
+	// named jar persisted per project,
+	// empty for no cookies
+	CookieJar string `json:"cookieJar"`
+}
+
+var errRedirect = errors.New("redirect not allowed")
+
+// transports are shared between requests
+// with the same TLS and proxy options
+// to reuse connections
+type transportKey struct {
+	tls   TLSOptions
+	proxy string
+}
+
+var transportsMutex = sync.Mutex{}
+var transports = map[transportKey]*http.Transport{}
+
+func getTransport(opts ClientOptions) (http.RoundTripper, error) {
+	key := transportKey{
+		tls:   opts.TLS,
+		proxy: opts.Proxy,
+	}
+
+	if key == (transportKey{}) {
+		return http.DefaultTransport, nil
+	}
+
+	transportsMutex.Lock()
+	defer transportsMutex.Unlock()
+
+	transport, ok := transports[key]
+	if ok {
+		return transport, nil
+	}
+
+	transport = http.DefaultTransport.(*http.Transport).Clone()
+
+	if opts.Proxy != "" {
+		proxyUrl, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	if opts.TLS.CA != "" || opts.TLS.Insecure {
+		tlsConfig := &tls.Config{
+			InsecureSkipVerify: opts.TLS.Insecure,
+		}
+
+		if opts.TLS.CA != "" {
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM([]byte(opts.TLS.CA)) {
+				return nil, errors.New("no valid certificate in CA")
+			}
+			tlsConfig.RootCAs = pool
+		}
+
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	transports[key] = transport
+
+	return transport, nil
+}
+
+func newClient(projectId string, opts ClientOptions) (*http.Client, error) {
+	transport, err := getTransport(opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Transport: intercept(projectId, transport),
+		Timeout:   time.Duration(opts.Timeout * float64(time.Second)),
+		Jar:       getCookieJar(projectId, opts.CookieJar),
+	}
+
+	switch opts.Redirect {
+	case "", REDIRECT_FOLLOW:
+	case REDIRECT_MANUAL:
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	case REDIRECT_ERROR:
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return errRedirect
+		}
+	default:
+		return nil, errors.New("unknown redirect policy: " + opts.Redirect)
+	}
+
+	return client, nil
+}
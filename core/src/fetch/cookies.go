@@ -0,0 +1,276 @@
+package fetch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	fs "fullstackedorg/fullstacked/src/fs"
+	serialize "fullstackedorg/fullstacked/src/serialize"
+	setup "fullstackedorg/fullstacked/src/setup"
+	"golang.org/x/net/publicsuffix"
+)
+
+var fileEventOrigin = "fetch"
+
+// without a public suffix list, a site can set
+// cookies for a whole TLD like co.uk
+func newCookieJar() *cookiejar.Jar {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return jar
+}
+
+// the url is kept to replay SetCookies on load
+type storedCookie struct {
+	Url    string       `json:"url"`
+	Cookie *http.Cookie `json:"cookie"`
+}
+
+func (c *storedCookie) domain() string {
+	if c.Cookie.Domain != "" {
+		return strings.ToLower(strings.TrimPrefix(c.Cookie.Domain, "."))
+	}
+
+	u, err := url.Parse(c.Url)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+func (c *storedCookie) path() string {
+	if c.Cookie.Path != "" {
+		return c.Cookie.Path
+	}
+	return "/"
+}
+
+func (c *storedCookie) expired() bool {
+	return c.Cookie.MaxAge < 0 ||
+		(!c.Cookie.Expires.IsZero() && c.Cookie.Expires.Before(time.Now()))
+}
+
+// net/http/cookiejar with a record of the received cookies,
+// saved to the config directory after every change.
+// Session cookies are persisted too
+type persistentJar struct {
+	mutex    sync.Mutex
+	jar      *cookiejar.Jar
+	cookies  []storedCookie
+	filePath string
+}
+
+func (j *persistentJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.jar.Cookies(u)
+}
+
+func (j *persistentJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.setCookies(u, cookies)
+	j.save()
+}
+
+func (j *persistentJar) setCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	for _, c := range cookies {
+		cookie := *c
+
+		// keep an absolute expiry for replay
+		if cookie.MaxAge > 0 {
+			cookie.Expires = time.Now().Add(time.Duration(cookie.MaxAge) * time.Second)
+			cookie.MaxAge = 0
+		}
+
+		stored := storedCookie{
+			Url:    u.String(),
+			Cookie: &cookie,
+		}
+
+		j.cookies = slices.DeleteFunc(j.cookies, func(s storedCookie) bool {
+			return s.Cookie.Name == stored.Cookie.Name &&
+				s.domain() == stored.domain() &&
+				s.path() == stored.path()
+		})
+
+		if !stored.expired() {
+			j.cookies = append(j.cookies, stored)
+		}
+	}
+}
+
+func (j *persistentJar) validCookies() []storedCookie {
+	valid := []storedCookie{}
+	for _, c := range j.cookies {
+		if !c.expired() {
+			valid = append(valid, c)
+		}
+	}
+	return valid
+}
+
+func (j *persistentJar) save() {
+	j.cookies = j.validCookies()
+
+	data, err := json.Marshal(j.cookies)
+	if err != nil {
+		return
+	}
+
+	fs.Mkdir(path.Dir(j.filePath), fileEventOrigin)
+	fs.WriteFile(j.filePath, data, fileEventOrigin)
+}
+
+func (j *persistentJar) load() {
+	data, err := fs.ReadFile(j.filePath)
+	if err != nil {
+		return
+	}
+
+	cookies := []storedCookie{}
+	err = json.Unmarshal(data, &cookies)
+	if err != nil {
+		return
+	}
+
+	for _, c := range cookies {
+		u, err := url.Parse(c.Url)
+		if err != nil || c.Cookie == nil {
+			continue
+		}
+		j.setCookies(u, []*http.Cookie{c.Cookie})
+	}
+}
+
+func cookiesDirectory(projectId string) string {
+	return path.Join(setup.Directories.Config, "cookies", url.PathEscape(projectId))
+}
+
+var jarsMutex = sync.Mutex{}
+var jars = map[string]map[string]*persistentJar{}
+
+func getCookieJar(projectId string, name string) http.CookieJar {
+	if name == "" {
+		return nil
+	}
+
+	return getPersistentJar(projectId, name)
+}
+
+func getPersistentJar(projectId string, name string) *persistentJar {
+	jarsMutex.Lock()
+	defer jarsMutex.Unlock()
+
+	projectJars, ok := jars[projectId]
+	if !ok {
+		projectJars = map[string]*persistentJar{}
+		jars[projectId] = projectJars
+	}
+
+	jar, ok := projectJars[name]
+	if !ok {
+		jar = &persistentJar{
+			jar:      newCookieJar(),
+			cookies:  []storedCookie{},
+			filePath: path.Join(cookiesDirectory(projectId), url.PathEscape(name)+".json"),
+		}
+		jar.load()
+		projectJars[name] = jar
+	}
+
+	return jar
+}
+
+// in memory and saved jars
+func cookieJarNames(projectId string) []string {
+	names := []string{}
+
+	jarsMutex.Lock()
+	for name := range jars[projectId] {
+		names = append(names, name)
+	}
+	jarsMutex.Unlock()
+
+	items, _ := fs.ReadDir(cookiesDirectory(projectId), false, true, nil, nil)
+	for _, item := range items {
+		if !strings.HasSuffix(item.Name, ".json") {
+			continue
+		}
+
+		name, err := url.PathUnescape(strings.TrimSuffix(item.Name, ".json"))
+		if err == nil && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// all jars if jarName is empty
+func CookiesSerialized(projectId string, jarName string) []byte {
+	names := []string{jarName}
+	if jarName == "" {
+		names = cookieJarNames(projectId)
+	}
+
+	data := []byte{}
+
+	for _, name := range names {
+		jar := getPersistentJar(projectId, name)
+
+		jar.mutex.Lock()
+		cookies := jar.validCookies()
+		jar.mutex.Unlock()
+
+		for _, c := range cookies {
+			expires := float64(0)
+			if !c.Cookie.Expires.IsZero() {
+				expires = float64(c.Cookie.Expires.UnixMilli())
+			}
+
+			data = append(data, serialize.SerializeString(name)...)
+			data = append(data, serialize.SerializeString(c.Cookie.Name)...)
+			data = append(data, serialize.SerializeString(c.Cookie.Value)...)
+			data = append(data, serialize.SerializeString(c.domain())...)
+			data = append(data, serialize.SerializeString(c.path())...)
+			data = append(data, serialize.SerializeNumber(expires)...)
+			data = append(data, serialize.SerializeBoolean(c.Cookie.Secure)...)
+			data = append(data, serialize.SerializeBoolean(c.Cookie.HttpOnly)...)
+		}
+	}
+
+	return data
+}
+
+// all jars if jarName is empty
+func ClearCookies(projectId string, jarName string) {
+	names := []string{jarName}
+	if jarName == "" {
+		names = cookieJarNames(projectId)
+	}
+
+	for _, name := range names {
+		jar := getPersistentJar(projectId, name)
+
+		jar.mutex.Lock()
+		jar.jar = newCookieJar()
+		jar.cookies = []storedCookie{}
+		fs.Unlink(jar.filePath, fileEventOrigin)
+		jar.mutex.Unlock()
+	}
+}
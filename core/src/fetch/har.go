@@ -0,0 +1,326 @@
+package fetch
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	fs "fullstackedorg/fullstacked/src/fs"
+)
+
+// subset of HAR 1.2
+// http://www.softwareishard.com/blog/har-12-spec/
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method  string      `json:"method"`
+	Url     string      `json:"url"`
+	Headers []harHeader `json:"headers"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harResponse struct {
+	Status     int         `json:"status"`
+	StatusText string      `json:"statusText"`
+	Headers    []harHeader `json:"headers"`
+	Content    harContent  `json:"content"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+}
+
+type harLog struct {
+	Log struct {
+		Version string `json:"version"`
+		Creator struct {
+			Name string `json:"name"`
+		} `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+// HAR files are project files and can end up in git,
+// credentials are never written
+var redactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+const redactedValue = "[redacted]"
+
+func toHarHeaders(header http.Header) []harHeader {
+	headers := []harHeader{}
+	for name, values := range header {
+		redacted := slices.ContainsFunc(redactedHeaders, func(h string) bool {
+			return strings.EqualFold(h, name)
+		})
+
+		for _, value := range values {
+			if redacted {
+				value = redactedValue
+			}
+
+			headers = append(headers, harHeader{
+				Name:  name,
+				Value: value,
+			})
+		}
+	}
+	return headers
+}
+
+func newHarEntry(req *http.Request, res *http.Response, body []byte, started time.Time) harEntry {
+	return harEntry{
+		StartedDateTime: started.Format(time.RFC3339Nano),
+		Time:            float64(time.Since(started).Milliseconds()),
+		Request: harRequest{
+			Method:  req.Method,
+			Url:     req.URL.String(),
+			Headers: toHarHeaders(req.Header),
+		},
+		Response: harResponse{
+			Status:     res.StatusCode,
+			StatusText: http.StatusText(res.StatusCode),
+			Headers:    toHarHeaders(res.Header),
+			Content: harContent{
+				Size:     len(body),
+				MimeType: res.Header.Get("Content-Type"),
+				Text:     base64.StdEncoding.EncodeToString(body),
+				Encoding: "base64",
+			},
+		},
+	}
+}
+
+func (e *harEntry) response(req *http.Request) (*http.Response, error) {
+	body := []byte(e.Response.Content.Text)
+
+	if e.Response.Content.Encoding == "base64" {
+		data, err := base64.StdEncoding.DecodeString(e.Response.Content.Text)
+		if err != nil {
+			return nil, err
+		}
+		body = data
+	}
+
+	header := http.Header{}
+	for _, h := range e.Response.Headers {
+		// body is stored decoded
+		if strings.EqualFold(h.Name, "Content-Encoding") || strings.EqualFold(h.Name, "Content-Length") {
+			continue
+		}
+		if h.Value == redactedValue {
+			continue
+		}
+		header.Add(h.Name, h.Value)
+	}
+
+	return newResponse(req, e.Response.Status, header, body), nil
+}
+
+// last recorded entry for the same method and url
+func findHarEntry(entries []harEntry, req *http.Request) *harEntry {
+	url := req.URL.String()
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Request.Method == req.Method && entries[i].Request.Url == url {
+			entry := entries[i]
+			return &entry
+		}
+	}
+
+	return nil
+}
+
+func recordHarEntry(projectId string, entry harEntry) {
+	interceptionsMutex.Lock()
+	defer interceptionsMutex.Unlock()
+
+	i, ok := interceptions[projectId]
+	if !ok || !i.recording {
+		return
+	}
+
+	// the entries are held in memory until StopRecording
+	if i.recordedSize+entry.Response.Content.Size > maxRecordedSize {
+		return
+	}
+
+	i.recordedSize += entry.Response.Content.Size
+	i.recorded = append(i.recorded, entry)
+}
+
+const maxRecordedBodySize = 5 << 20 // 5MB
+const maxRecordedSize = 64 << 20    // 64MB
+
+// passes the response body through as it is read,
+// keeping a copy for the HAR entry.
+// The entry is recorded at the end of the body or when closed
+type recordingBody struct {
+	io.ReadCloser
+	projectId string
+	req       *http.Request
+	res       *http.Response
+	started   time.Time
+	body      []byte
+	truncated bool
+	once      sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	if n > 0 && !b.truncated {
+		if len(b.body)+n > maxRecordedBodySize {
+			b.truncated = true
+		} else {
+			b.body = append(b.body, p[:n]...)
+		}
+	}
+
+	if err == io.EOF {
+		b.record()
+	}
+
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.record()
+	return err
+}
+
+func (b *recordingBody) record() {
+	b.once.Do(func() {
+		entry := newHarEntry(b.req, b.res, b.body, b.started)
+		if b.truncated {
+			entry.Response.Content.Comment = "truncated"
+		}
+		recordHarEntry(b.projectId, entry)
+	})
+}
+
+func projectFilePath(baseDir string, filePath string) (string, error) {
+	filePathAbs := path.Clean(path.Join(baseDir, filePath))
+
+	if filePathAbs != baseDir && !strings.HasPrefix(filePathAbs, baseDir+"/") {
+		return "", errors.New("illegal fs operation")
+	}
+
+	return filePathAbs, nil
+}
+
+// records real responses until stopped,
+// then writes them to the HAR file
+func StartRecording(projectId string, baseDir string, filePath string) error {
+	filePathAbs, err := projectFilePath(baseDir, filePath)
+
+	if err != nil {
+		return err
+	}
+
+	interceptionsMutex.Lock()
+	i := getInterception(projectId, baseDir)
+	i.recording = true
+	i.recordingFile = filePathAbs
+	i.recorded = []harEntry{}
+	i.recordedSize = 0
+	interceptionsMutex.Unlock()
+
+	return nil
+}
+
+func StopRecording(projectId string) error {
+	interceptionsMutex.Lock()
+	i, ok := interceptions[projectId]
+	if !ok || !i.recording {
+		interceptionsMutex.Unlock()
+		return nil
+	}
+	entries := i.recorded
+	filePath := i.recordingFile
+	i.recording = false
+	i.recorded = nil
+	i.recordedSize = 0
+	cleanupInterception(projectId)
+	interceptionsMutex.Unlock()
+
+	har := harLog{}
+	har.Log.Version = "1.2"
+	har.Log.Creator.Name = "FullStacked"
+	har.Log.Entries = entries
+
+	data, err := json.MarshalIndent(har, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	fs.Mkdir(path.Dir(filePath), fileEventOrigin)
+	return fs.WriteFile(filePath, data, fileEventOrigin)
+}
+
+// serves the HAR file responses,
+// empty filePath to stop
+func Replay(projectId string, baseDir string, filePath string) error {
+	if filePath == "" {
+		interceptionsMutex.Lock()
+		i, ok := interceptions[projectId]
+		if ok {
+			i.replay = nil
+			cleanupInterception(projectId)
+		}
+		interceptionsMutex.Unlock()
+		return nil
+	}
+
+	filePathAbs, err := projectFilePath(baseDir, filePath)
+
+	if err != nil {
+		return err
+	}
+
+	data, err := fs.ReadFile(filePathAbs)
+
+	if err != nil {
+		return err
+	}
+
+	har := harLog{}
+	err = json.Unmarshal(data, &har)
+
+	if err != nil {
+		return err
+	}
+
+	interceptionsMutex.Lock()
+	getInterception(projectId, baseDir).replay = har.Log.Entries
+	interceptionsMutex.Unlock()
+
+	return nil
+}
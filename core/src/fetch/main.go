@@ -11,14 +11,12 @@ import (
 	"io"
 	"net/http"
 	"sync"
-	"time"
 )
 
 type Request struct {
 	Cancel func()
 }
 
-var client = &http.Client{}
 var activeRequestsMutex = sync.Mutex{}
 var activeRequests = map[float64]Request{}
 
@@ -31,6 +29,7 @@ func FetchSerialized(
 	body []byte,
 	timeout int,
 	asString bool,
+	cookieJar string,
 ) {
 	requestBody := (io.Reader)(http.NoBody)
 	if len(body) > 0 {
@@ -45,9 +44,16 @@ func FetchSerialized(
 		}
 	}
 
-	client.Timeout = time.Duration(timeout) * time.Second
+	client, err := newClient(projectId, ClientOptions{
+		Timeout:   float64(timeout),
+		CookieJar: cookieJar,
+	})
+
+	response := (*http.Response)(nil)
+	if err == nil {
+		response, err = client.Do(request)
+	}
 
-	response, err := client.Do(request)
 	bytes := []byte{}
 	if err != nil {
 		bytes = append(bytes, serialize.SerializeNumber(id)...)
@@ -90,31 +96,45 @@ func CancelRequest(id float64) {
 	}
 	delete(activeRequests, id)
 	activeRequestsMutex.Unlock()
+
+	closeBodyStream(id)
 }
 
-func Fetch2(
+func doFetch2(
+	ctx context.Context,
+	client *http.Client,
 	projectId string,
 	id float64,
 	method string,
 	url string,
 	headers *map[string]string,
 	body []byte,
-) {
-	// body
-	requestBody := (io.Reader)(http.NoBody)
-	if len(body) > 0 {
-		requestBody = bytes.NewReader(body)
+	baseDir string,
+	opts RequestOptions,
+) (*http.Response, error) {
+	requestBody, bodySize, err := requestBody(id, body, baseDir, opts)
+
+	if err != nil {
+		return nil, err
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	request, _ := http.NewRequestWithContext(ctx, method, url, requestBody)
+	if opts.UploadProgress {
+		requestBody = &uploadProgress{
+			ReadCloser: requestBody,
+			projectId:  projectId,
+			id:         id,
+			total:      bodySize,
+		}
+	}
 
-	// stash cancel
-	activeRequestsMutex.Lock()
-	activeRequests[id] = Request{
-		Cancel: cancel,
+	request, err := http.NewRequestWithContext(ctx, method, url, requestBody)
+
+	if err != nil {
+		requestBody.Close()
+		return nil, err
 	}
-	activeRequestsMutex.Unlock()
+
+	request.ContentLength = bodySize
 
 	// headers
 	if headers != nil {
@@ -123,10 +143,38 @@ func Fetch2(
 		}
 	}
 
-	// infinite timeout
-	client.Timeout = time.Duration(0)
+	return client.Do(request)
+}
 
-	res, err := client.Do(request)
+func Fetch2(
+	projectId string,
+	id float64,
+	method string,
+	url string,
+	headers *map[string]string,
+	body []byte,
+	baseDir string,
+	opts RequestOptions,
+) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// stash cancel
+	activeRequestsMutex.Lock()
+	activeRequests[id] = Request{
+		Cancel: cancel,
+	}
+	activeRequestsMutex.Unlock()
+
+	client, err := newClient(projectId, opts.ClientOptions)
+
+	res := (*http.Response)(nil)
+	if err == nil {
+		res, err = doFetch2(ctx, client, projectId, id, method, url, headers, body, baseDir, opts)
+	}
+
+	if opts.BodyStream {
+		closeBodyStream(id)
+	}
 
 	// req id
 	response := serialize.SerializeNumber(id)
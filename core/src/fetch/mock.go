@@ -0,0 +1,238 @@
+package fetch
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	fs "fullstackedorg/fullstacked/src/fs"
+)
+
+// Mock rules are matched in order,
+// before replayed entries and before the network
+type MockRule struct {
+	// empty matches any method
+	Method string `json:"method"`
+	// full url, * matches anything
+	Url     string            `json:"url"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	// project file path used as body
+	File string `json:"file"`
+	// milliseconds
+	Delay float64 `json:"delay"`
+
+	pattern *regexp.Regexp
+}
+
+type interception struct {
+	baseDir string
+	rules   []MockRule
+
+	replay []harEntry
+
+	recording     bool
+	recordingFile string
+	recorded      []harEntry
+	// body bytes in recorded
+	recordedSize int
+}
+
+var interceptionsMutex = sync.Mutex{}
+var interceptions = map[string]*interception{}
+
+// must be called with interceptionsMutex locked
+func getInterception(projectId string, baseDir string) *interception {
+	i, ok := interceptions[projectId]
+	if !ok {
+		i = &interception{}
+		interceptions[projectId] = i
+	}
+	i.baseDir = baseDir
+	return i
+}
+
+// must be called with interceptionsMutex locked
+func cleanupInterception(projectId string) {
+	i, ok := interceptions[projectId]
+	if ok && len(i.rules) == 0 && i.replay == nil && !i.recording {
+		delete(interceptions, projectId)
+	}
+}
+
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	parts := strings.Split(glob, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return regexp.Compile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// replaces the project mock rules,
+// no rules to stop mocking
+func SetMockRules(projectId string, baseDir string, rules []MockRule) error {
+	for i := range rules {
+		pattern, err := globToRegexp(rules[i].Url)
+		if err != nil {
+			return err
+		}
+		rules[i].pattern = pattern
+	}
+
+	interceptionsMutex.Lock()
+	getInterception(projectId, baseDir).rules = rules
+	cleanupInterception(projectId)
+	interceptionsMutex.Unlock()
+
+	return nil
+}
+
+func (r *MockRule) match(req *http.Request) bool {
+	if r.Method != "" && !strings.EqualFold(r.Method, req.Method) {
+		return false
+	}
+
+	return r.pattern.MatchString(req.URL.String())
+}
+
+func (r *MockRule) response(req *http.Request, baseDir string) (*http.Response, error) {
+	if r.Delay > 0 {
+		select {
+		case <-time.After(time.Duration(r.Delay * float64(time.Millisecond))):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	body := []byte(r.Body)
+
+	if r.File != "" {
+		filePath, err := projectFilePath(baseDir, r.File)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := fs.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		body = data
+	}
+
+	header := http.Header{}
+	for key, value := range r.Headers {
+		header.Set(key, value)
+	}
+
+	if header.Get("Content-Type") == "" && r.File != "" {
+		header.Set("Content-Type", http.DetectContentType(body))
+	}
+
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	return newResponse(req, status, header, body), nil
+}
+
+func newResponse(req *http.Request, status int, header http.Header, body []byte) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+type interceptTransport struct {
+	projectId string
+	next      http.RoundTripper
+}
+
+// only wraps the transport of projects
+// with mocks, replay or recording
+func intercept(projectId string, transport http.RoundTripper) http.RoundTripper {
+	interceptionsMutex.Lock()
+	_, ok := interceptions[projectId]
+	interceptionsMutex.Unlock()
+
+	if !ok {
+		return transport
+	}
+
+	return &interceptTransport{
+		projectId: projectId,
+		next:      transport,
+	}
+}
+
+func (t *interceptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	interceptionsMutex.Lock()
+	i, ok := interceptions[t.projectId]
+	rule := (*MockRule)(nil)
+	entry := (*harEntry)(nil)
+	baseDir := ""
+	recording := false
+	if ok {
+		baseDir = i.baseDir
+		recording = i.recording
+		for j := range i.rules {
+			if i.rules[j].match(req) {
+				r := i.rules[j]
+				rule = &r
+				break
+			}
+		}
+		if rule == nil {
+			entry = findHarEntry(i.replay, req)
+		}
+	}
+	interceptionsMutex.Unlock()
+
+	// the request never reaches the network
+	if (rule != nil || entry != nil) && req.Body != nil {
+		req.Body.Close()
+	}
+
+	if rule != nil {
+		return rule.response(req, baseDir)
+	}
+
+	if entry != nil {
+		return entry.response(req)
+	}
+
+	if !recording {
+		return t.next.RoundTrip(req)
+	}
+
+	started := time.Now()
+
+	res, err := t.next.RoundTrip(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res.Body = &recordingBody{
+		ReadCloser: res.Body,
+		projectId:  t.projectId,
+		req:        req,
+		res:        res,
+		started:    started,
+	}
+
+	return res, nil
+}
@@ -0,0 +1,150 @@
+package fetch
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	fs "fullstackedorg/fullstacked/src/fs"
+	serialize "fullstackedorg/fullstacked/src/serialize"
+	setup "fullstackedorg/fullstacked/src/setup"
+)
+
+type RequestOptions struct {
+	ClientOptions
+	// project file path, read while uploading
+	BodyFile string `json:"bodyFile"`
+	// body chunks are sent with FETCH2_BODY
+	BodyStream     bool `json:"bodyStream"`
+	UploadProgress bool `json:"uploadProgress"`
+}
+
+type bodyStream struct {
+	reader *io.PipeReader
+	writer *io.PipeWriter
+}
+
+var bodyStreamsMutex = sync.Mutex{}
+var bodyStreams = map[float64]*bodyStream{}
+
+// must be called before the first chunk is written,
+// the request itself starts in its own goroutine
+func OpenBodyStream(id float64) {
+	reader, writer := io.Pipe()
+
+	bodyStreamsMutex.Lock()
+	bodyStreams[id] = &bodyStream{
+		reader: reader,
+		writer: writer,
+	}
+	bodyStreamsMutex.Unlock()
+}
+
+// blocks until the chunk is consumed by the request
+func WriteBodyStream(id float64, chunk []byte, done bool) []byte {
+	bodyStreamsMutex.Lock()
+	stream, ok := bodyStreams[id]
+	bodyStreamsMutex.Unlock()
+
+	if !ok {
+		return serialize.SerializeError(errors.New("no body stream for request"))
+	}
+
+	if len(chunk) > 0 {
+		_, err := stream.writer.Write(chunk)
+		if err != nil {
+			return serialize.SerializeError(err)
+		}
+	}
+
+	if done {
+		stream.writer.Close()
+	}
+
+	return nil
+}
+
+func closeBodyStream(id float64) {
+	bodyStreamsMutex.Lock()
+	stream, ok := bodyStreams[id]
+	delete(bodyStreams, id)
+	bodyStreamsMutex.Unlock()
+
+	// unblocks pending writes
+	if ok {
+		stream.reader.CloseWithError(errors.New("request ended"))
+	}
+}
+
+// body size is -1 when unknown
+func requestBody(id float64, body []byte, baseDir string, opts RequestOptions) (io.ReadCloser, int64, error) {
+	if opts.BodyStream {
+		bodyStreamsMutex.Lock()
+		stream, ok := bodyStreams[id]
+		bodyStreamsMutex.Unlock()
+
+		if !ok {
+			return nil, 0, errors.New("no body stream for request")
+		}
+
+		return stream.reader, -1, nil
+	}
+
+	if opts.BodyFile != "" {
+		filePath := path.Clean(path.Join(baseDir, opts.BodyFile))
+
+		if filePath != baseDir && !strings.HasPrefix(filePath, baseDir+"/") {
+			return nil, 0, errors.New("illegal fs operation")
+		}
+
+		return fs.Open(filePath)
+	}
+
+	if len(body) > 0 {
+		return io.NopCloser(bytes.NewReader(body)), int64(len(body)), nil
+	}
+
+	return http.NoBody, 0, nil
+}
+
+var uploadProgressInterval = time.Millisecond * 100
+
+// sends [id, sent, total] at most every 100ms and once done.
+// In WASM, the body is read at once before sending
+type uploadProgress struct {
+	io.ReadCloser
+	projectId string
+	id        float64
+	sent      int64
+	total     int64
+	lastEmit  time.Time
+	done      bool
+}
+
+func (u *uploadProgress) Read(p []byte) (int, error) {
+	n, err := u.ReadCloser.Read(p)
+	u.sent += int64(n)
+
+	done := err == io.EOF || (u.total >= 0 && u.sent >= u.total)
+
+	if (done && !u.done) || time.Since(u.lastEmit) > uploadProgressInterval {
+		u.done = done
+		u.lastEmit = time.Now()
+
+		// req id
+		progress := serialize.SerializeNumber(u.id)
+		// sent bytes
+		progress = append(progress, serialize.SerializeNumber(float64(u.sent))...)
+		// total bytes, -1 if unknown
+		progress = append(progress, serialize.SerializeNumber(float64(u.total))...)
+		setup.Callback(u.projectId, "fetch2-upload", base64.StdEncoding.EncodeToString(progress))
+	}
+
+	return n, err
+}
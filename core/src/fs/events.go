@@ -0,0 +1,220 @@
+package fs
+
+import (
+	"encoding/json"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	serialize "fullstackedorg/fullstacked/src/serialize"
+	setup "fullstackedorg/fullstacked/src/setup"
+	utils "fullstackedorg/fullstacked/src/utils"
+)
+
+// File events are buffered for the debounce window,
+// coalesced by path and origin, then sent to "file-event"
+// in batches of at most maxEventBatch.
+// The editor receives all events,
+// a project only the events under its directory once subscribed
+
+const eventDebounce = time.Millisecond * 100 // 100ms
+const maxEventBatch = 500
+
+type EventSubscription struct {
+	// only these origins when not empty
+	Origins []string `json:"origins"`
+	// never these origins
+	IgnoreOrigins []string `json:"ignoreOrigins"`
+}
+
+func (s *EventSubscription) accepts(origin string) bool {
+	if len(s.Origins) > 0 && !slices.Contains(s.Origins, origin) {
+		return false
+	}
+
+	return !slices.Contains(s.IgnoreOrigins, origin)
+}
+
+type eventBus struct {
+	mutex  sync.Mutex
+	buffer []FileEvent
+	// index in buffer of the last event per origin and path,
+	// renames are never coalesced
+	last          map[string]int
+	subscriptions map[string]EventSubscription
+	debounce      func(func())
+}
+
+var events = &eventBus{
+	buffer: []FileEvent{},
+	last:   map[string]int{},
+	subscriptions: map[string]EventSubscription{
+		// the editor
+		"": {},
+	},
+	debounce: utils.NewDebouncer(eventDebounce),
+}
+
+// the resulting type of previous followed by next,
+// UNKNOWN when they cancel out and ok false when they don't combine
+func coalesce(previous FileEventType, next FileEventType, isFile bool) (FileEventType, bool) {
+	switch {
+	case previous == CREATED && next == MODIFIED:
+		return CREATED, true
+	case previous == MODIFIED && next == MODIFIED:
+		return MODIFIED, true
+	case previous == CREATED && next == DELETED:
+		return UNKNOWN, true
+	case previous == MODIFIED && next == DELETED:
+		return DELETED, true
+	// replaced by a new file, like atomic saves
+	case previous == DELETED && next == CREATED && isFile:
+		return MODIFIED, true
+	}
+
+	return UNKNOWN, false
+}
+
+func (b *eventBus) push(event FileEvent) {
+	b.mutex.Lock()
+
+	if event.Type == RENAME {
+		// events before the rename stay before it
+		for _, p := range event.Paths {
+			delete(b.last, event.Origin+"\x00"+p)
+		}
+		b.buffer = append(b.buffer, event)
+	} else {
+		key := event.Origin + "\x00" + strings.Join(event.Paths, "\x00")
+		i, ok := b.last[key]
+
+		coalesced := false
+		if ok && b.buffer[i].IsFile == event.IsFile {
+			eventType, combines := coalesce(b.buffer[i].Type, event.Type, event.IsFile)
+			if combines {
+				b.buffer[i].Type = eventType
+				coalesced = true
+				if eventType == UNKNOWN {
+					delete(b.last, key)
+				}
+			}
+		}
+
+		if !coalesced {
+			b.last[key] = len(b.buffer)
+			b.buffer = append(b.buffer, event)
+		}
+	}
+
+	full := len(b.buffer) >= maxEventBatch
+
+	b.mutex.Unlock()
+
+	if full {
+		b.flush()
+	} else {
+		b.debounce(b.flush)
+	}
+}
+
+func (b *eventBus) flush() {
+	b.mutex.Lock()
+	buffer := b.buffer
+	b.buffer = []FileEvent{}
+	b.last = map[string]int{}
+	subscriptions := make(map[string]EventSubscription, len(b.subscriptions))
+	for projectId, subscription := range b.subscriptions {
+		subscriptions[projectId] = subscription
+	}
+	b.mutex.Unlock()
+
+	if setup.Callback == nil {
+		return
+	}
+
+	batch := []FileEvent{}
+	for _, event := range buffer {
+		// cancelled out
+		if event.Type != UNKNOWN {
+			batch = append(batch, event)
+		}
+	}
+
+	if len(batch) == 0 {
+		return
+	}
+
+	for projectId, subscription := range subscriptions {
+		routed := []FileEvent{}
+
+		for _, event := range batch {
+			if !subscription.accepts(event.Origin) {
+				continue
+			}
+
+			if projectId != "" && !eventInProject(event, projectId) {
+				continue
+			}
+
+			routed = append(routed, event)
+		}
+
+		for start := 0; start < len(routed); start += maxEventBatch {
+			jsonData, _ := json.Marshal(routed[start:min(start+maxEventBatch, len(routed))])
+			setup.Callback(projectId, "file-event", string(jsonData))
+		}
+	}
+}
+
+func eventInProject(event FileEvent, projectId string) bool {
+	if setup.Directories == nil {
+		return false
+	}
+
+	projectDirectory := path.Join(setup.Directories.Root, projectId)
+
+	for _, p := range event.Paths {
+		if p == projectDirectory || strings.HasPrefix(p, projectDirectory+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// replaces the previous subscription of the project,
+// the editor is projectId ""
+func Subscribe(projectId string, subscription EventSubscription) {
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+
+	events.subscriptions[projectId] = subscription
+}
+
+// the editor goes back to receiving everything
+func Unsubscribe(projectId string) {
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+
+	if projectId == "" {
+		events.subscriptions[""] = EventSubscription{}
+	} else {
+		delete(events.subscriptions, projectId)
+	}
+}
+
+func SubscribeSerialized(projectId string, subscriptionJSON string) []byte {
+	subscription := EventSubscription{}
+
+	if subscriptionJSON != "" {
+		err := json.Unmarshal([]byte(subscriptionJSON), &subscription)
+		if err != nil {
+			return serialize.SerializeError(err)
+		}
+	}
+
+	Subscribe(projectId, subscription)
+	return nil
+}
@@ -0,0 +1,320 @@
+package fs
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+
+	setup "fullstackedorg/fullstacked/src/setup"
+)
+
+// flushed only when full or by the test
+func newTestBus(subscriptions map[string]EventSubscription) *eventBus {
+	return &eventBus{
+		buffer:        []FileEvent{},
+		last:          map[string]int{},
+		subscriptions: subscriptions,
+		debounce:      func(func()) {},
+	}
+}
+
+// projectId => batches received
+func recordBatches(t *testing.T) map[string][][]FileEvent {
+	batches := map[string][][]FileEvent{}
+
+	callback := setup.Callback
+	directories := setup.Directories
+	t.Cleanup(func() {
+		setup.Callback = callback
+		setup.Directories = directories
+	})
+
+	setup.Directories = &setup.DirectoriesStruct{Root: "/root"}
+	setup.Callback = func(projectId string, messageType string, message string) {
+		if messageType != "file-event" {
+			return
+		}
+
+		batch := []FileEvent{}
+		json.Unmarshal([]byte(message), &batch)
+		batches[projectId] = append(batches[projectId], batch)
+	}
+
+	return batches
+}
+
+func event(eventType FileEventType, isFile bool, origin string, paths ...string) FileEvent {
+	return FileEvent{Type: eventType, Paths: paths, IsFile: isFile, Origin: origin}
+}
+
+func describe(events []FileEvent) []string {
+	described := []string{}
+	for _, e := range events {
+		described = append(described, fmt.Sprint(e.Type, e.Paths, e.IsFile, e.Origin))
+	}
+	return described
+}
+
+func TestEventCoalescing(t *testing.T) {
+	tests := []struct {
+		name     string
+		pushed   []FileEvent
+		expected []FileEvent
+	}{
+		{"created then modified", []FileEvent{
+			event(CREATED, true, "", "/a"),
+			event(MODIFIED, true, "", "/a"),
+		}, []FileEvent{
+			event(CREATED, true, "", "/a"),
+		}},
+		{"modified", []FileEvent{
+			event(MODIFIED, true, "", "/a"),
+			event(MODIFIED, true, "", "/a"),
+			event(MODIFIED, true, "", "/a"),
+		}, []FileEvent{
+			event(MODIFIED, true, "", "/a"),
+		}},
+		{"created then deleted", []FileEvent{
+			event(CREATED, true, "", "/a"),
+			event(MODIFIED, true, "", "/a"),
+			event(DELETED, true, "", "/a"),
+		}, []FileEvent{}},
+		{"modified then deleted", []FileEvent{
+			event(MODIFIED, true, "", "/a"),
+			event(DELETED, true, "", "/a"),
+		}, []FileEvent{
+			event(DELETED, true, "", "/a"),
+		}},
+		{"atomic save", []FileEvent{
+			event(DELETED, true, "", "/a"),
+			event(CREATED, true, "", "/a"),
+		}, []FileEvent{
+			event(MODIFIED, true, "", "/a"),
+		}},
+		{"directory replaced", []FileEvent{
+			event(DELETED, false, "", "/a"),
+			event(CREATED, false, "", "/a"),
+		}, []FileEvent{
+			event(DELETED, false, "", "/a"),
+			event(CREATED, false, "", "/a"),
+		}},
+		{"created again after cancelling out", []FileEvent{
+			event(CREATED, true, "", "/a"),
+			event(DELETED, true, "", "/a"),
+			event(CREATED, true, "", "/a"),
+		}, []FileEvent{
+			event(CREATED, true, "", "/a"),
+		}},
+		{"file and directory", []FileEvent{
+			event(MODIFIED, false, "", "/a"),
+			event(MODIFIED, true, "", "/a"),
+		}, []FileEvent{
+			event(MODIFIED, false, "", "/a"),
+			event(MODIFIED, true, "", "/a"),
+		}},
+		{"origins", []FileEvent{
+			event(MODIFIED, true, "editor", "/a"),
+			event(MODIFIED, true, "git", "/a"),
+			event(MODIFIED, true, "editor", "/a"),
+		}, []FileEvent{
+			event(MODIFIED, true, "editor", "/a"),
+			event(MODIFIED, true, "git", "/a"),
+		}},
+		{"paths", []FileEvent{
+			event(MODIFIED, true, "", "/a"),
+			event(MODIFIED, true, "", "/b"),
+			event(MODIFIED, true, "", "/a"),
+		}, []FileEvent{
+			event(MODIFIED, true, "", "/a"),
+			event(MODIFIED, true, "", "/b"),
+		}},
+		// the order around a rename matters
+		{"rename", []FileEvent{
+			event(MODIFIED, true, "", "/a"),
+			event(RENAME, true, "", "/a", "/b"),
+			event(RENAME, true, "", "/b", "/a"),
+			event(MODIFIED, true, "", "/a"),
+		}, []FileEvent{
+			event(MODIFIED, true, "", "/a"),
+			event(RENAME, true, "", "/a", "/b"),
+			event(RENAME, true, "", "/b", "/a"),
+			event(MODIFIED, true, "", "/a"),
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			batches := recordBatches(t)
+			bus := newTestBus(map[string]EventSubscription{"": {}})
+
+			for _, e := range test.pushed {
+				bus.push(e)
+			}
+			bus.flush()
+
+			got := []FileEvent{}
+			for _, batch := range batches[""] {
+				got = append(got, batch...)
+			}
+
+			if !slices.Equal(describe(got), describe(test.expected)) {
+				t.Fatalf("got %v, expected %v", describe(got), describe(test.expected))
+			}
+		})
+	}
+}
+
+func TestEventBatchCap(t *testing.T) {
+	batches := recordBatches(t)
+	bus := newTestBus(map[string]EventSubscription{"": {}})
+
+	for i := range 1200 {
+		bus.push(event(MODIFIED, true, "", fmt.Sprintf("/file-%d", i)))
+	}
+
+	// flushed when full, the rest is still buffered
+	if len(batches[""]) != 2 {
+		t.Fatalf("got %d batches before the flush", len(batches[""]))
+	}
+
+	bus.flush()
+
+	sizes := []int{}
+	for _, batch := range batches[""] {
+		sizes = append(sizes, len(batch))
+	}
+
+	if !slices.Equal(sizes, []int{maxEventBatch, maxEventBatch, 200}) {
+		t.Fatalf("unexpected batch sizes %v", sizes)
+	}
+
+	if batches[""][2][199].Paths[0] != "/file-1199" {
+		t.Fatalf("unexpected last event %+v", batches[""][2][199])
+	}
+}
+
+func TestEventRouting(t *testing.T) {
+	batches := recordBatches(t)
+	bus := newTestBus(map[string]EventSubscription{
+		"":  {},
+		"p": {},
+	})
+
+	bus.push(event(MODIFIED, true, "", "/root/p/a"))
+	bus.push(event(MODIFIED, false, "", "/root/p"))
+	// shares the prefix only
+	bus.push(event(MODIFIED, true, "", "/root/pq/a"))
+	bus.push(event(MODIFIED, true, "", "/root/other/a"))
+	// moved out of the project
+	bus.push(event(RENAME, true, "", "/root/p/b", "/tmp/b"))
+	bus.flush()
+
+	if len(batches[""]) != 1 || len(batches[""][0]) != 5 {
+		t.Fatalf("the editor got %v", batches[""])
+	}
+
+	got := []string{}
+	for _, e := range batches["p"][0] {
+		got = append(got, e.Paths[0])
+	}
+	if len(batches["p"]) != 1 || !slices.Equal(got, []string{"/root/p/a", "/root/p", "/root/p/b"}) {
+		t.Fatalf("the project got %v", batches["p"])
+	}
+
+	// nothing for the project
+	bus.push(event(MODIFIED, true, "", "/root/other/a"))
+	bus.flush()
+
+	if len(batches["p"]) != 1 {
+		t.Fatalf("the project got an empty batch %v", batches["p"])
+	}
+}
+
+func TestEventOriginFilters(t *testing.T) {
+	batches := recordBatches(t)
+	bus := newTestBus(map[string]EventSubscription{
+		"":  {IgnoreOrigins: []string{"editor"}},
+		"p": {Origins: []string{"git", ExternalOrigin}},
+		"q": {Origins: []string{"git", "editor"}, IgnoreOrigins: []string{"git"}},
+	})
+
+	for _, origin := range []string{"editor", "git", ExternalOrigin, ""} {
+		for _, project := range []string{"p", "q"} {
+			bus.push(event(MODIFIED, true, origin, "/root/"+project+"/a"))
+		}
+	}
+	bus.flush()
+
+	origins := func(projectId string) []string {
+		result := []string{}
+		for _, batch := range batches[projectId] {
+			for _, e := range batch {
+				result = append(result, e.Origin+" "+e.Paths[0])
+			}
+		}
+		return result
+	}
+
+	expected := map[string][]string{
+		"": {
+			"git /root/p/a", "git /root/q/a",
+			ExternalOrigin + " /root/p/a", ExternalOrigin + " /root/q/a",
+			" /root/p/a", " /root/q/a",
+		},
+		"p": {"git /root/p/a", ExternalOrigin + " /root/p/a"},
+		"q": {"editor /root/q/a"},
+	}
+
+	for projectId, expectedOrigins := range expected {
+		if got := origins(projectId); !slices.Equal(got, expectedOrigins) {
+			t.Errorf("%q got %v, expected %v", projectId, got, expectedOrigins)
+		}
+	}
+}
+
+func TestEventSubscriptions(t *testing.T) {
+	events.mutex.Lock()
+	subscriptions := events.subscriptions
+	events.subscriptions = map[string]EventSubscription{"": {}}
+	events.mutex.Unlock()
+	t.Cleanup(func() {
+		events.mutex.Lock()
+		events.subscriptions = subscriptions
+		events.mutex.Unlock()
+	})
+
+	if SubscribeSerialized("p", `{"origins":["git"]}`) != nil {
+		t.Fatal("subscribe failed")
+	}
+	if SubscribeSerialized("", `{"ignoreOrigins":["editor"]}`) != nil {
+		t.Fatal("subscribe failed")
+	}
+	if SubscribeSerialized("q", "{") == nil {
+		t.Fatal("expected an error for invalid JSON")
+	}
+
+	events.mutex.Lock()
+	if !slices.Equal(events.subscriptions["p"].Origins, []string{"git"}) ||
+		!slices.Equal(events.subscriptions[""].IgnoreOrigins, []string{"editor"}) {
+		t.Fatalf("unexpected subscriptions %+v", events.subscriptions)
+	}
+	if _, ok := events.subscriptions["q"]; ok {
+		t.Fatal("invalid subscription added")
+	}
+	events.mutex.Unlock()
+
+	Unsubscribe("p")
+	Unsubscribe("")
+
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+
+	if _, ok := events.subscriptions["p"]; ok {
+		t.Fatal("project still subscribed")
+	}
+	// the editor always receives
+	if subscription, ok := events.subscriptions[""]; !ok || len(subscription.IgnoreOrigins) != 0 {
+		t.Fatalf("unexpected editor subscription %+v", subscription)
+	}
+}
@@ -1,8 +1,11 @@
 package fs
 
 import (
+	"bytes"
 	"errors"
+	glob "fullstackedorg/fullstacked/src/glob"
 	serialize "fullstackedorg/fullstacked/src/serialize"
+	"io"
 	"io/fs"
 	"os"
 	"path"
@@ -42,6 +45,41 @@ func ReadFile(path string) ([]byte, error) {
 	return fileData, nil
 }
 
+// for reading large files without loading them at once,
+// returns the file size with the reader
+func Open(path string) (io.ReadCloser, int64, error) {
+	exists, isFile := Exists(path)
+
+	if !exists {
+		return nil, 0, errors.New("ENOENT")
+	}
+
+	if !isFile {
+		return nil, 0, errors.New("EISDIR")
+	}
+
+	if WASM {
+		fileData, err := vReadFile(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		return io.NopCloser(bytes.NewReader(fileData)), int64(len(fileData)), nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+
+	return file, stat.Size(), nil
+}
+
 func ReadFileSerialized(path string, asString bool) []byte {
 	fileData, err := ReadFile(path)
 
@@ -61,6 +99,8 @@ func WriteFile(path string, data []byte, origin string) error {
 
 	exists, _ := Exists(path)
 
+	recordOwnPaths(path)
+
 	if WASM {
 		err = vWriteFile(path, data)
 	} else {
@@ -97,6 +137,8 @@ func WriteFileSerialized(path string, data []byte, origin string) []byte {
 func Unlink(path string, origin string) error {
 	err := (error)(nil)
 
+	recordOwnPaths(path)
+
 	if WASM {
 		err = vUnlink(path)
 	} else {
@@ -121,17 +163,9 @@ func UnlinkSerialized(path string, origin string) []byte {
 	return serialize.SerializeString(err.Error())
 }
 
-func containsStartsWith(arr []string, e string) bool {
-	for _, i := range arr {
-		if strings.HasPrefix(e, i) {
-			return true
-		}
-	}
-
-	return false
-}
-
-func ReadDir(path string, recursive bool, filesOnly bool, skip []string) ([]FileInfo2, error) {
+// skip and include are glob patterns, see the glob package.
+// Skipped directories are not walked, include only filters files
+func ReadDir(path string, recursive bool, filesOnly bool, skip []string, include []string) ([]FileInfo2, error) {
 	items := []FileInfo2{}
 
 	exists, isFile := Exists(path)
@@ -143,8 +177,19 @@ func ReadDir(path string, recursive bool, filesOnly bool, skip []string) ([]File
 		return nil, errors.New("ENOTDIR")
 	}
 
+	skipMatcher := glob.New(skip)
+	includeMatcher := glob.New(include)
+
+	excluded := func(relativeName string, isDir bool) bool {
+		if skipMatcher.Match(relativeName, isDir) {
+			return true
+		}
+
+		return !isDir && includeMatcher != nil && !includeMatcher.Match(relativeName, false)
+	}
+
 	if WASM {
-		items = vReadDir(path, recursive, filesOnly, skip)
+		items = vReadDir(path, recursive, filesOnly, excluded)
 	} else {
 		pathComponents := splitPath(filepath.ToSlash(path))
 
@@ -154,15 +199,19 @@ func ReadDir(path string, recursive bool, filesOnly bool, skip []string) ([]File
 					return err
 				}
 
-				if filesOnly && d.IsDir() {
-					return nil
-				}
-
 				itemPathComponents := splitPath(filepath.ToSlash(path))
 
 				relativeName := strings.Join(itemPathComponents[len(pathComponents):], "/")
 
-				if containsStartsWith(skip, relativeName) {
+				// don't walk skipped directories, node_modules can be huge
+				if excluded(relativeName, d.IsDir()) {
+					if d.IsDir() && relativeName != "" {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+
+				if filesOnly && d.IsDir() {
 					return nil
 				}
 
@@ -195,6 +244,10 @@ func ReadDir(path string, recursive bool, filesOnly bool, skip []string) ([]File
 					continue
 				}
 
+				if excluded(item.Name(), item.IsDir()) {
+					continue
+				}
+
 				items = append(items, FileInfo2{
 					Name:  item.Name(),
 					IsDir: item.IsDir(),
@@ -207,18 +260,11 @@ func ReadDir(path string, recursive bool, filesOnly bool, skip []string) ([]File
 	return items, nil
 }
 
-func ReadDirSerialized(path string, recursive bool, withFileTypes bool, filesOnly bool, skip []string) []byte {
-	items := ([]FileInfo2)(nil)
-	err := (error)(nil)
+func ReadDirSerialized(path string, recursive bool, withFileTypes bool, filesOnly bool, skip []string, include []string) []byte {
+	items, err := ReadDir(path, recursive, filesOnly, skip, include)
 
-	if WASM {
-		items = vReadDir(path, recursive, filesOnly, skip)
-	} else {
-		items, err = ReadDir(path, recursive, filesOnly, skip)
-
-		if err != nil {
-			return serialize.SerializeError(err)
-		}
+	if err != nil {
+		return serialize.SerializeError(err)
 	}
 
 	bytes := []byte{}
@@ -239,6 +285,15 @@ func Mkdir(path string, origin string) bool {
 
 	exists, _ := Exists(path)
 
+	recordOwnPaths(path)
+	// the missing parents are created too
+	for parent := filepath.Dir(path); parent != filepath.Dir(parent); parent = filepath.Dir(parent) {
+		if parentExists, _ := Exists(parent); parentExists {
+			break
+		}
+		recordOwnPaths(parent)
+	}
+
 	if WASM {
 		err = vMkdir(path)
 	} else {
@@ -270,6 +325,17 @@ func Rmdir(path string, origin string) bool {
 
 	err := (error)(nil)
 
+	recordOwnPaths(path)
+	// the OS watchers report the deleted content too
+	if !WASM && watching() {
+		items, _ := ReadDir(path, true, false, WatchSkip, nil)
+		content := []string{}
+		for _, item := range items {
+			content = append(content, filepath.Join(path, item.Name))
+		}
+		recordOwnPaths(content...)
+	}
+
 	if WASM {
 		err = vRmdir(path)
 	} else {
@@ -387,6 +453,8 @@ func Rename(oldPath string, newPath string, origin string) bool {
 
 	_, isFile := Exists(oldPath)
 
+	recordOwnPaths(oldPath, newPath)
+
 	if WASM {
 		err = vRename(oldPath, newPath)
 	} else {
@@ -430,7 +498,7 @@ func Copy(src string, dst string, origin string) error {
 		}
 		WriteFile(dst, data, origin)
 	} else {
-		items, err := ReadDir(src, true, false, []string{})
+		items, err := ReadDir(src, true, false, nil, nil)
 		if err != nil {
 			return err
 		}
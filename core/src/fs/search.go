@@ -0,0 +1,406 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	glob "fullstackedorg/fullstacked/src/glob"
+	setup "fullstackedorg/fullstacked/src/setup"
+)
+
+type SearchOptions struct {
+	Query         string `json:"query"`
+	Regex         bool   `json:"regex"`
+	CaseSensitive bool   `json:"caseSensitive"`
+	WholeWord     bool   `json:"wholeWord"`
+	// glob patterns relative to the searched directory,
+	// no include means every file
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// glob patterns, defaults to DefaultSearchSkip
+	Skip []string `json:"skip"`
+	// 0 for DefaultMaxSearchResults
+	MaxResults int `json:"maxResults"`
+	// only these files when not empty,
+	// relative to the searched directory
+	Files []string `json:"files"`
+}
+
+var DefaultSearchSkip = []string{".git", "node_modules", "/.build"}
+
+const DefaultMaxSearchResults = 10000
+
+// larger files and binary files are not searched
+const maxSearchFileSize = 5 * 1024 * 1024
+const binarySniffLength = 8000
+
+const maxPreviewLength = 250
+
+type SearchMatch struct {
+	// zero-based, character in UTF-16 units
+	// like JS strings
+	Line      int `json:"line"`
+	Character int `json:"character"`
+	Length    int `json:"length"`
+	// the matched line, shortened around the match
+	// when too long
+	Preview          string `json:"preview"`
+	PreviewCharacter int    `json:"previewCharacter"`
+}
+
+type SearchFileResult struct {
+	Id      float64       `json:"id"`
+	File    string        `json:"file"`
+	Matches []SearchMatch `json:"matches"`
+}
+
+type SearchEnd struct {
+	Id        float64 `json:"id"`
+	Done      bool    `json:"done"`
+	Files     int     `json:"files"`
+	Matches   int     `json:"matches"`
+	Truncated bool    `json:"truncated"`
+	Error     string  `json:"error"`
+}
+
+func (o *SearchOptions) compile() (*regexp.Regexp, error) {
+	if o.Query == "" {
+		return nil, errors.New("empty search query")
+	}
+
+	expression := o.Query
+	if !o.Regex {
+		expression = regexp.QuoteMeta(expression)
+	}
+
+	if o.WholeWord {
+		expression = `\b(?:` + expression + `)\b`
+	}
+
+	// lines are matched one at a time,
+	// ^ and $ anchor to the line
+	expression = "(?m)" + expression
+
+	if !o.CaseSensitive {
+		expression = "(?i)" + expression
+	}
+
+	return regexp.Compile(expression)
+}
+
+// relative file names to search in directory
+func (o *SearchOptions) files(directory string) ([]string, error) {
+	skip := o.Skip
+	if skip == nil {
+		skip = DefaultSearchSkip
+	}
+
+	excluded := append(slices.Clone(skip), o.Exclude...)
+
+	if len(o.Files) == 0 {
+		items, err := ReadDir(directory, true, true, excluded, o.Include)
+		if err != nil {
+			return nil, err
+		}
+
+		files := []string{}
+		for _, item := range items {
+			files = append(files, item.Name)
+		}
+		return files, nil
+	}
+
+	exclude := glob.New(excluded)
+	include := glob.New(o.Include)
+
+	files := []string{}
+	for _, name := range o.Files {
+		name = strings.TrimPrefix(path.Clean("/"+name), "/")
+
+		if exclude.Match(name, false) {
+			continue
+		}
+
+		if include != nil && !include.Match(name, false) {
+			continue
+		}
+
+		files = append(files, name)
+	}
+
+	return files, nil
+}
+
+func readSearchable(filePath string) ([]byte, bool) {
+	exists, isFile := Exists(filePath)
+	if !exists || !isFile {
+		return nil, false
+	}
+
+	stat, err := Stat(filePath)
+	if err != nil || stat.Size > maxSearchFileSize {
+		return nil, false
+	}
+
+	data, err := ReadFile(filePath)
+	if err != nil {
+		return nil, false
+	}
+
+	if bytes.IndexByte(data[:min(len(data), binarySniffLength)], 0) != -1 {
+		return nil, false
+	}
+
+	return data, true
+}
+
+func utf16Length(s string) int {
+	length := 0
+	for _, r := range s {
+		length += utf16.RuneLen(r)
+	}
+	return length
+}
+
+func previewLine(line string, start int, end int) (string, int) {
+	if len(line) <= maxPreviewLength {
+		return line, utf16Length(line[:start])
+	}
+
+	// keep some context before the match
+	from := max(0, start-maxPreviewLength/4)
+	to := min(len(line), max(end, from+maxPreviewLength))
+
+	for from > 0 && !utf8.RuneStart(line[from]) {
+		from--
+	}
+	for to < len(line) && !utf8.RuneStart(line[to]) {
+		to++
+	}
+
+	return line[from:to], utf16Length(line[from:start])
+}
+
+func searchContent(content string, expression *regexp.Regexp, limit int) []SearchMatch {
+	matches := []SearchMatch{}
+
+	lineNumber := 0
+	for len(content) > 0 && len(matches) < limit {
+		line := content
+		next := strings.IndexByte(content, '\n')
+		if next == -1 {
+			content = ""
+		} else {
+			line = content[:next]
+			content = content[next+1:]
+		}
+		line = strings.TrimSuffix(line, "\r")
+
+		for _, location := range expression.FindAllStringIndex(line, -1) {
+			// empty matches of regexes like a*
+			if location[0] == location[1] {
+				continue
+			}
+
+			preview, previewCharacter := previewLine(line, location[0], location[1])
+
+			matches = append(matches, SearchMatch{
+				Line:             lineNumber,
+				Character:        utf16Length(line[:location[0]]),
+				Length:           utf16Length(line[location[0]:location[1]]),
+				Preview:          preview,
+				PreviewCharacter: previewCharacter,
+			})
+
+			if len(matches) == limit {
+				break
+			}
+		}
+
+		lineNumber++
+	}
+
+	return matches
+}
+
+// matches are sent to onFile, one call per file with matches
+func Search(directory string, options SearchOptions, onFile func(file string, matches []SearchMatch)) (SearchEnd, error) {
+	end := SearchEnd{Done: true}
+
+	expression, err := options.compile()
+	if err != nil {
+		return end, err
+	}
+
+	files, err := options.files(directory)
+	if err != nil {
+		return end, err
+	}
+
+	maxResults := options.MaxResults
+	if maxResults <= 0 {
+		maxResults = DefaultMaxSearchResults
+	}
+
+	for _, file := range files {
+		if end.Matches >= maxResults {
+			end.Truncated = true
+			break
+		}
+
+		data, ok := readSearchable(path.Join(directory, file))
+		if !ok {
+			continue
+		}
+
+		matches := searchContent(string(data), expression, maxResults-end.Matches)
+		if len(matches) == 0 {
+			continue
+		}
+
+		end.Files++
+		end.Matches += len(matches)
+		onFile(file, matches)
+	}
+
+	return end, nil
+}
+
+// results are sent to "fs-search",
+// one message per file then the SearchEnd
+func SearchAsync(projectId string, directory string, options SearchOptions, id float64) {
+	send := func(message any) {
+		data, _ := json.Marshal(message)
+		setup.Callback(projectId, "fs-search", string(data))
+	}
+
+	end, err := Search(directory, options, func(file string, matches []SearchMatch) {
+		send(SearchFileResult{
+			Id:      id,
+			File:    file,
+			Matches: matches,
+		})
+	})
+
+	end.Id = id
+	if err != nil {
+		end.Error = err.Error()
+	}
+
+	send(end)
+}
+
+// line by line like searchContent,
+// so the replacements are exactly the search matches
+func replaceAll(expression *regexp.Regexp, data []byte, replacement string, expand bool) ([]byte, int) {
+	result := make([]byte, 0, len(data))
+	count := 0
+
+	for len(data) > 0 {
+		line, rest, found := bytes.Cut(data, []byte{'\n'})
+		data = rest
+
+		ending := ""
+		if found {
+			ending = "\n"
+		}
+		if trimmed, ok := bytes.CutSuffix(line, []byte{'\r'}); ok {
+			line = trimmed
+			ending = "\r" + ending
+		}
+
+		last := 0
+		for _, submatches := range expression.FindAllSubmatchIndex(line, -1) {
+			if submatches[0] == submatches[1] {
+				continue
+			}
+
+			result = append(result, line[last:submatches[0]]...)
+			if expand {
+				result = expression.Expand(result, []byte(replacement), line, submatches)
+			} else {
+				result = append(result, replacement...)
+			}
+
+			last = submatches[1]
+			count++
+		}
+
+		result = append(result, line[last:]...)
+		result = append(result, ending...)
+	}
+
+	return result, count
+}
+
+// returns the count of modified files and replacements,
+// regex replacements can use $1 or ${name}
+func Replace(directory string, options SearchOptions, replacement string, origin string) (int, int, error) {
+	expression, err := options.compile()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	files, err := options.files(directory)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	modifiedFiles := 0
+	replacements := 0
+
+	for _, file := range files {
+		filePath := path.Join(directory, file)
+
+		data, ok := readSearchable(filePath)
+		if !ok {
+			continue
+		}
+
+		replaced, count := replaceAll(expression, data, replacement, options.Regex)
+		if count == 0 {
+			continue
+		}
+
+		err = WriteFile(filePath, replaced, origin)
+		if err != nil {
+			return modifiedFiles, replacements, err
+		}
+
+		modifiedFiles++
+		replacements += count
+	}
+
+	return modifiedFiles, replacements, nil
+}
+
+type ReplaceEnd struct {
+	Id           float64 `json:"id"`
+	Files        int     `json:"files"`
+	Replacements int     `json:"replacements"`
+	Error        string  `json:"error"`
+}
+
+// the ReplaceEnd is sent to "fs-replace"
+func ReplaceAsync(projectId string, directory string, options SearchOptions, replacement string, origin string, id float64) {
+	modifiedFiles, replacements, err := Replace(directory, options, replacement, origin)
+
+	end := ReplaceEnd{
+		Id:           id,
+		Files:        modifiedFiles,
+		Replacements: replacements,
+	}
+	if err != nil {
+		end.Error = err.Error()
+	}
+
+	data, _ := json.Marshal(end)
+	setup.Callback(projectId, "fs-replace", string(data))
+}
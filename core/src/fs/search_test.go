@@ -0,0 +1,232 @@
+package fs
+
+import (
+	"os"
+	"path"
+	"slices"
+	"testing"
+)
+
+func searchDirectory(t *testing.T, files map[string]string) string {
+	directory := t.TempDir()
+
+	for name, content := range files {
+		filePath := path.Join(directory, name)
+		os.MkdirAll(path.Dir(filePath), 0755)
+		err := os.WriteFile(filePath, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return directory
+}
+
+type searchResults map[string][]SearchMatch
+
+func runSearch(t *testing.T, directory string, options SearchOptions) (searchResults, SearchEnd) {
+	t.Helper()
+
+	results := searchResults{}
+	end, err := Search(directory, options, func(file string, matches []SearchMatch) {
+		results[file] = matches
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return results, end
+}
+
+func TestSearch(t *testing.T) {
+	directory := searchDirectory(t, map[string]string{
+		"a.ts":                   "const foo = 1;\nfood(foo_bar, Foo);\n",
+		"crlf.ts":                "first\r\nfoo\r\n",
+		"unicode.ts":             "// é😀 foo",
+		"node_modules/m/foo.js":  "foo",
+		"binary.bin":             "foo\x00",
+		"src/nested/deep/foo.ts": "FOO",
+	})
+
+	tests := []struct {
+		name     string
+		options  SearchOptions
+		expected map[string][]int
+	}{
+		// file => [line, character, length]...
+		{"case insensitive", SearchOptions{Query: "foo"}, map[string][]int{
+			"a.ts":                   {0, 6, 3, 1, 0, 3, 1, 5, 3, 1, 14, 3},
+			"crlf.ts":                {1, 0, 3},
+			"unicode.ts":             {0, 7, 3},
+			"src/nested/deep/foo.ts": {0, 0, 3},
+		}},
+		{"case sensitive", SearchOptions{Query: "Foo", CaseSensitive: true}, map[string][]int{
+			"a.ts": {1, 14, 3},
+		}},
+		{"whole word", SearchOptions{Query: "foo", WholeWord: true, CaseSensitive: true}, map[string][]int{
+			"a.ts":       {0, 6, 3},
+			"crlf.ts":    {1, 0, 3},
+			"unicode.ts": {0, 7, 3},
+		}},
+		{"regex", SearchOptions{Query: `fo+d?\(`, Regex: true}, map[string][]int{
+			"a.ts": {1, 0, 5},
+		}},
+		// $ anchors before the \r
+		{"regex line end", SearchOptions{Query: `^foo$`, Regex: true}, map[string][]int{
+			"crlf.ts":                {1, 0, 3},
+			"src/nested/deep/foo.ts": {0, 0, 3},
+		}},
+		{"include", SearchOptions{Query: "foo", Include: []string{"src/**"}}, map[string][]int{
+			"src/nested/deep/foo.ts": {0, 0, 3},
+		}},
+		{"exclude", SearchOptions{Query: "foo", Exclude: []string{"*.ts"}}, map[string][]int{}},
+		{"files", SearchOptions{Query: "foo", Files: []string{"crlf.ts", "/missing.ts", "../a.ts"}}, map[string][]int{
+			"crlf.ts": {1, 0, 3},
+			"a.ts":    {0, 6, 3, 1, 0, 3, 1, 5, 3, 1, 14, 3},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, end := runSearch(t, directory, test.options)
+
+			got := map[string][]int{}
+			matches := 0
+			for file, fileMatches := range results {
+				for _, match := range fileMatches {
+					got[file] = append(got[file], match.Line, match.Character, match.Length)
+				}
+				matches += len(fileMatches)
+			}
+
+			if len(got) != len(test.expected) || end.Files != len(got) || end.Matches != matches || end.Truncated {
+				t.Fatalf("got %v %+v, expected %v", got, end, test.expected)
+			}
+			for file, expected := range test.expected {
+				if !slices.Equal(got[file], expected) {
+					t.Fatalf("%s: got %v, expected %v", file, got[file], expected)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchPreview(t *testing.T) {
+	long := ""
+	for range 100 {
+		long += "abcdefghij"
+	}
+
+	directory := searchDirectory(t, map[string]string{
+		"crlf.ts": "a foo\r\n",
+		"long.ts": long + "foo" + long,
+	})
+
+	results, _ := runSearch(t, directory, SearchOptions{Query: "foo"})
+
+	crlf := results["crlf.ts"][0]
+	if crlf.Preview != "a foo" || crlf.PreviewCharacter != 2 {
+		t.Fatalf("unexpected preview %+v", crlf)
+	}
+
+	match := results["long.ts"][0]
+	if len(match.Preview) > 1000 || match.Preview[match.PreviewCharacter:match.PreviewCharacter+3] != "foo" {
+		t.Fatalf("unexpected preview %+v", match)
+	}
+}
+
+func TestSearchMaxResults(t *testing.T) {
+	directory := searchDirectory(t, map[string]string{
+		"a.ts": "foo foo foo",
+		"b.ts": "foo\nfoo",
+		"c.ts": "foo",
+	})
+
+	results, end := runSearch(t, directory, SearchOptions{Query: "foo", MaxResults: 4})
+
+	if end.Matches != 4 || end.Files != 2 || !end.Truncated {
+		t.Fatalf("unexpected end %+v", end)
+	}
+	if len(results["a.ts"]) != 3 || len(results["b.ts"]) != 1 {
+		t.Fatalf("unexpected results %v", results)
+	}
+
+	// the limit reached on the last match
+	_, end = runSearch(t, directory, SearchOptions{Query: "foo", MaxResults: 6})
+	if end.Matches != 6 || end.Truncated {
+		t.Fatalf("unexpected end %+v", end)
+	}
+}
+
+func TestReplaceAll(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     SearchOptions
+		data        string
+		replacement string
+		expected    string
+		count       int
+	}{
+		{"literal", SearchOptions{Query: "a.b"}, "a.b axb", "c", "c axb", 1},
+		{"literal dollar", SearchOptions{Query: "a"}, "a", "$1", "$1", 1},
+		{"case insensitive", SearchOptions{Query: "foo"}, "Foo fOO", "bar", "bar bar", 2},
+		{"whole word", SearchOptions{Query: "foo", WholeWord: true}, "foo food foo_bar (foo)", "x", "x food foo_bar (x)", 2},
+		{"regex groups", SearchOptions{Query: `(\w+)=(\w+)`, Regex: true}, "a=b, c=d", "$2=$1", "b=a, d=c", 2},
+		{"regex named groups", SearchOptions{Query: `(?P<key>\w+):`, Regex: true}, "key: 1", "${key} =", "key = 1", 1},
+		{"regex literal dollar", SearchOptions{Query: `\d+`, Regex: true}, "costs 5", "$$$0", "costs $5", 1},
+		{"crlf", SearchOptions{Query: `o$`, Regex: true}, "foo\r\nbar\r\nfoo", "0", "fo0\r\nbar\r\nfo0", 2},
+		{"lf", SearchOptions{Query: "a"}, "a\n\na\n", "b", "b\n\nb\n", 2},
+		{"empty matches", SearchOptions{Query: `x*`, Regex: true}, "axb", "-", "a-b", 1},
+		{"no match", SearchOptions{Query: "z"}, "abc", "y", "abc", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := test.options.compile()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			replaced, count := replaceAll(expression, []byte(test.data), test.replacement, test.options.Regex)
+			if string(replaced) != test.expected || count != test.count {
+				t.Fatalf("got %q (%d), expected %q (%d)", replaced, count, test.expected, test.count)
+			}
+		})
+	}
+}
+
+func TestReplace(t *testing.T) {
+	directory := searchDirectory(t, map[string]string{
+		"a.ts":                  "import { foo } from './foo';\r\nfoo();\r\n",
+		"b.ts":                  "nothing",
+		"node_modules/m/foo.js": "foo",
+	})
+
+	options := SearchOptions{Query: "foo", WholeWord: true}
+
+	results, end := runSearch(t, directory, options)
+
+	modifiedFiles, replacements, err := Replace(directory, options, "bar", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// exactly what the search found
+	if modifiedFiles != end.Files || replacements != end.Matches || len(results["a.ts"]) != 3 {
+		t.Fatalf("replaced %d in %d files, found %+v", replacements, modifiedFiles, end)
+	}
+
+	data, _ := os.ReadFile(path.Join(directory, "a.ts"))
+	if string(data) != "import { bar } from './bar';\r\nbar();\r\n" {
+		t.Fatalf("unexpected content %q", data)
+	}
+
+	data, _ = os.ReadFile(path.Join(directory, "node_modules/m/foo.js"))
+	if string(data) != "foo" {
+		t.Fatalf("skipped file changed %q", data)
+	}
+
+	if _, _, err := Replace(directory, SearchOptions{}, "bar", ""); err == nil {
+		t.Fatal("expected an error for an empty query")
+	}
+}
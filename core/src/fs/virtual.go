@@ -4,156 +4,293 @@ import (
 	"errors"
 	"os"
 	"path"
-	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 )
 
-type vFile struct {
-	Data    []byte
-	ModTime time.Time
+// In-memory fs for WASM, a tree of nodes from "/".
+// Lookups walk the path components, O(depth).
+// Relative paths are resolved from "/"
+
+type vNode struct {
+	isDir    bool
+	data     []byte
+	modTime  time.Time
+	children map[string]*vNode
+	// virtualSequence of the last change, see VirtualChanges
+	sequence uint64
 }
 
-var VirtFS = make(map[string]*vFile)
-var VirtDirs = []string{}
+// must hold virtualMutex for writing
+func newVDir() *vNode {
+	return &vNode{
+		isDir:    true,
+		modTime:  time.Now(),
+		children: map[string]*vNode{},
+		sequence: vNextSequence(),
+	}
+}
 
-func vReadFile(path string) ([]byte, error) {
-	f := VirtFS[path]
+var virtualMutex = sync.RWMutex{}
+var virtualRoot = &vNode{
+	isDir:    true,
+	modTime:  time.Now(),
+	children: map[string]*vNode{},
+}
 
-	if f == nil {
-		return nil, errors.New("ENOENT")
+func vComponents(p string) []string {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// must hold virtualMutex
+func vLookup(p string) *vNode {
+	node := virtualRoot
+
+	for _, component := range vComponents(p) {
+		if !node.isDir {
+			return nil
+		}
+
+		node = node.children[component]
+		if node == nil {
+			return nil
+		}
 	}
 
-	return f.Data, nil
+	return node
 }
 
-func vWriteFile(path string, data []byte) error {
-	if VirtFS[path] == nil {
-		VirtFS[path] = &vFile{
-			Data:    []byte{},
-			ModTime: time.Now(),
+// must hold virtualMutex for writing,
+// creates the missing directories
+func vMkdirAll(components []string) (*vNode, error) {
+	node := virtualRoot
+
+	for _, component := range components {
+		child := node.children[component]
+
+		if child == nil {
+			child = newVDir()
+			node.children[component] = child
+			node.modTime = child.modTime
+		} else if !child.isDir {
+			return nil, errors.New("ENOTDIR")
 		}
+
+		node = child
 	}
 
-	VirtFS[path].Data = data
-	return nil
+	return node, nil
 }
 
-func vUnlink(path string) error {
-	delete(VirtFS, path)
-	return nil
+func vReadFile(path string) ([]byte, error) {
+	virtualMutex.RLock()
+	defer virtualMutex.RUnlock()
+
+	node := vLookup(path)
+
+	if node == nil {
+		return nil, errors.New("ENOENT")
+	}
+
+	if node.isDir {
+		return nil, errors.New("EISDIR")
+	}
+
+	return node.data, nil
 }
 
-func vMkdir(path string) error {
-	path = strings.TrimSpace(path)
-	path = strings.TrimRight(path, "/")
-
-	pathComponents := strings.Split(path, "/")
-	for i := range pathComponents {
-		subdir := strings.Join(pathComponents[:i+1], "/")
-		exists := false
-		for _, dir := range VirtDirs {
-			if subdir == dir {
-				exists = true
-			}
-		}
+func vWriteFile(path string, data []byte) error {
+	virtualMutex.Lock()
+	defer virtualMutex.Unlock()
 
-		if !exists {
-			VirtDirs = append(VirtDirs, subdir)
-		}
+	components := vComponents(path)
+	if len(components) == 0 {
+		return errors.New("EISDIR")
+	}
+
+	parent, err := vMkdirAll(components[:len(components)-1])
+	if err != nil {
+		return err
 	}
 
+	name := components[len(components)-1]
+	node := parent.children[name]
+	now := time.Now()
+
+	if node == nil {
+		node = &vNode{}
+		parent.children[name] = node
+		parent.modTime = now
+	} else if node.isDir {
+		return errors.New("EISDIR")
+	}
+
+	node.data = data
+	node.modTime = now
+	node.sequence = vNextSequence()
+
 	return nil
 }
 
-func vRmdir(path string) error {
-	indexesToRemove := []int{}
+// must hold virtualMutex for writing
+func vRemove(path string) {
+	components := vComponents(path)
+	if len(components) == 0 {
+		return
+	}
 
-	for i, dir := range VirtDirs {
-		if dir == path || pathIsChildOfPath(dir, path) {
-			indexesToRemove = append(indexesToRemove, i)
-		}
+	parent := vLookup(strings.Join(components[:len(components)-1], "/"))
+	if parent == nil || !parent.isDir {
+		return
+	}
+
+	name := components[len(components)-1]
+	if _, ok := parent.children[name]; ok {
+		delete(parent.children, name)
+		parent.modTime = time.Now()
+		vDeleted("/" + strings.Join(components, "/"))
 	}
+}
+
+func vUnlink(path string) error {
+	virtualMutex.Lock()
+	defer virtualMutex.Unlock()
 
-	for i := len(indexesToRemove) - 1; i >= 0; i-- {
-		indexToRemove := indexesToRemove[i]
-		VirtDirs[indexToRemove] = VirtDirs[len(VirtDirs)-1]
-		VirtDirs = VirtDirs[:len(VirtDirs)-1]
+	node := vLookup(path)
+
+	if node == nil {
+		return errors.New("ENOENT")
 	}
 
-	for file := range VirtFS {
-		if pathIsChildOfPath(file, path) {
-			delete(VirtFS, file)
-		}
+	if node.isDir {
+		return errors.New("EISDIR")
 	}
 
+	vRemove(path)
+	return nil
+}
+
+func vMkdir(path string) error {
+	virtualMutex.Lock()
+	defer virtualMutex.Unlock()
+
+	_, err := vMkdirAll(vComponents(path))
+	return err
+}
+
+// like os.RemoveAll
+func vRmdir(path string) error {
+	virtualMutex.Lock()
+	defer virtualMutex.Unlock()
+
+	vRemove(path)
 	return nil
 }
 
 func vExists(path string) (bool, bool) {
-	for _, dir := range VirtDirs {
-		if path == dir {
-			return true, false
-		}
-	}
+	virtualMutex.RLock()
+	defer virtualMutex.RUnlock()
 
-	for file := range VirtFS {
-		if file == path {
-			return true, true
-		}
+	node := vLookup(path)
+
+	if node == nil {
+		return false, false
 	}
 
-	return false, false
+	return true, !node.isDir
 }
 
 func vStat(path string) *FileInfo2 {
-	f := VirtFS[path]
-	d := false
+	virtualMutex.RLock()
+	defer virtualMutex.RUnlock()
 
-	for _, dir := range VirtDirs {
-		if dir == path {
-			d = true
-			break
-		}
-	}
+	node := vLookup(path)
 
-	if f == nil || d {
+	if node == nil {
 		return nil
 	}
 
-	pathComponents := strings.Split(path, "/")
+	components := vComponents(path)
+	name := "/"
+	if len(components) > 0 {
+		name = components[len(components)-1]
+	}
 
-	mode := os.ModeDir
-	if !d {
-		mode = 0666
+	mode := os.FileMode(0666)
+	if node.isDir {
+		mode = os.ModeDir | 0755
 	}
 
 	return &FileInfo2{
-		Name:  pathComponents[len(pathComponents)-1],
-		Size:  int64(len(f.Data)),
-		ATime: f.ModTime,
-		MTime: f.ModTime,
-		CTime: f.ModTime,
-		IsDir: d,
+		Name:  name,
+		Size:  int64(len(node.data)),
+		ATime: node.modTime,
+		MTime: node.modTime,
+		CTime: node.modTime,
+		IsDir: node.isDir,
 		Mode:  mode,
 	}
 }
 
 func vRename(oldPath string, newPath string) error {
-	for i, dir := range VirtDirs {
-		if strings.HasPrefix(dir, oldPath) {
-			VirtDirs[i] = strings.Replace(dir, oldPath, newPath, 1)
-		}
+	virtualMutex.Lock()
+	defer virtualMutex.Unlock()
+
+	oldComponents := vComponents(oldPath)
+	newComponents := vComponents(newPath)
+
+	node := vLookup(oldPath)
+	if node == nil || len(oldComponents) == 0 {
+		return errors.New("ENOENT")
+	}
+
+	if slices.Equal(oldComponents, newComponents) {
+		return nil
+	}
+
+	// into itself
+	if len(newComponents) > len(oldComponents) && slices.Equal(newComponents[:len(oldComponents)], oldComponents) {
+		return errors.New("EINVAL")
+	}
+
+	if len(newComponents) == 0 {
+		return errors.New("EEXIST")
 	}
 
-	for file, data := range VirtFS {
-		if strings.HasPrefix(file, oldPath) {
-			newFile := strings.Replace(file, oldPath, newPath, 1)
-			VirtFS[newFile] = data
-			delete(VirtFS, file)
+	target := vLookup(newPath)
+	if target != nil {
+		if target.isDir && !node.isDir {
+			return errors.New("EISDIR")
+		}
+		if !target.isDir && node.isDir {
+			return errors.New("ENOTDIR")
 		}
+		if target.isDir && len(target.children) > 0 {
+			return errors.New("ENOTEMPTY")
+		}
+	}
+
+	// like os.Rename, the parent must exist
+	parent := vLookup(strings.Join(newComponents[:len(newComponents)-1], "/"))
+	if parent == nil {
+		return errors.New("ENOENT")
+	}
+	if !parent.isDir {
+		return errors.New("ENOTDIR")
 	}
 
+	vRemove(oldPath)
+	vRemove(newPath)
+	parent.children[newComponents[len(newComponents)-1]] = node
+	parent.modTime = time.Now()
+	vChangedTree(node)
+
 	return nil
 }
 
@@ -181,67 +318,99 @@ func splitPath(filePath string) []string {
 	return reversed
 }
 
-func pathIsChildOfPath(childPath string, parentPath string) bool {
-	childPathComponents := strings.Split(childPath, "/")
-	parentPathComponents := strings.Split(parentPath, "/")
+// names are relative to path, sorted like filepath.WalkDir,
+// excluded directories are not walked
+func vReadDir(path string, recursive bool, filesOnly bool, excluded func(relativeName string, isDir bool) bool) []FileInfo2 {
+	virtualMutex.RLock()
+	defer virtualMutex.RUnlock()
 
-	if len(childPathComponents) < len(parentPathComponents) {
-		return false
-	}
+	items := []FileInfo2{}
 
-	for i, parentPathComponent := range parentPathComponents {
-		if parentPathComponent != childPathComponents[i] {
-			return false
-		}
+	node := vLookup(path)
+	if node == nil || !node.isDir {
+		return items
 	}
 
-	return true
-}
-
-//	projects/node_modules/react/index.js
-//	projects/node_modules/react-dom/index.js
-//
-// path: projects/node_modules/react
-func vReadDir(path string, recursive bool, filesOnly bool, skip []string) []FileInfo2 {
-	items := []FileInfo2{}
-
-	pathComponents := splitPath(path)
-
-	if !filesOnly {
-		for _, dir := range VirtDirs {
-			if pathIsChildOfPath(dir, path) {
-				dirComponents := splitPath(dir)
-				relativeName := filepath.Join(dirComponents[len(pathComponents):]...)
-				if containsStartsWith(skip, relativeName) {
-					continue
-				}
-				if recursive || len(dirComponents)-len(pathComponents) == 1 {
-					items = append(items, FileInfo2{
-						Name:  relativeName,
-						IsDir: true,
-						Mode:  os.ModeDir,
-					})
-				}
-			}
+	var walk func(directory *vNode, prefix string)
+	walk = func(directory *vNode, prefix string) {
+		names := make([]string, 0, len(directory.children))
+		for name := range directory.children {
+			names = append(names, name)
 		}
-	}
+		slices.Sort(names)
+
+		for _, name := range names {
+			child := directory.children[name]
+			relativeName := prefix + name
 
-	for file := range VirtFS {
-		if pathIsChildOfPath(file, path) {
-			fileComponents := splitPath(file)
-			relativeName := filepath.Join(fileComponents[len(pathComponents):]...)
-			if containsStartsWith(skip, relativeName) {
+			if excluded(relativeName, child.isDir) {
 				continue
 			}
-			if recursive || len(fileComponents)-len(pathComponents) == 1 {
+
+			if !child.isDir {
 				items = append(items, FileInfo2{
 					Name:  relativeName,
 					IsDir: false,
 					Mode:  0666,
 				})
+				continue
+			}
+
+			if !filesOnly {
+				items = append(items, FileInfo2{
+					Name:  relativeName,
+					IsDir: true,
+					Mode:  os.ModeDir,
+				})
+			}
+
+			if recursive {
+				walk(child, relativeName+"/")
 			}
 		}
 	}
 
+	walk(node, "")
+
 	return items
 }
+
+type VirtualEntry struct {
+	Path    string
+	IsDir   bool
+	Data    []byte
+	ModTime time.Time
+}
+
+// every file and directory under prefix, absolute paths
+func VirtualEntries(prefix string) []VirtualEntry {
+	virtualMutex.RLock()
+	defer virtualMutex.RUnlock()
+
+	entries := []VirtualEntry{}
+
+	node := vLookup(prefix)
+	if node == nil {
+		return entries
+	}
+
+	components := vComponents(prefix)
+
+	var walk func(node *vNode, p string)
+	walk = func(node *vNode, p string) {
+		entries = append(entries, VirtualEntry{
+			Path:    p,
+			IsDir:   node.isDir,
+			Data:    node.data,
+			ModTime: node.modTime,
+		})
+
+		for name, child := range node.children {
+			walk(child, strings.TrimSuffix(p, "/")+"/"+name)
+		}
+	}
+
+	walk(node, "/"+strings.Join(components, "/"))
+
+	return entries
+}
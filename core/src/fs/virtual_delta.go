@@ -0,0 +1,437 @@
+package fs
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	serialize "fullstackedorg/fullstacked/src/serialize"
+)
+
+// Every change of the virtual fs gets a sequence number
+// so the platform can persist it (IndexedDB, OPFS)
+// with only what changed since its last export:
+//
+//	delta := VirtualChanges("/projects", lastSequence)
+//	// delete delta.Deleted paths and their children,
+//	// write delta.Entries, keep delta.Sequence
+//
+// and restore it on load with VirtualImport
+
+var virtualSequence uint64 = 0
+
+// deleted paths by component, a deleted directory
+// covers the deletions under it
+type vTombstone struct {
+	// of the deletion, 0 on the way to deleted paths
+	sequence uint64
+	// highest sequence under it, to skip
+	// the branches already exported
+	latest   uint64
+	children map[string]*vTombstone
+}
+
+func newVTombstone() *vTombstone {
+	return &vTombstone{children: map[string]*vTombstone{}}
+}
+
+var virtualDeleted = newVTombstone()
+
+// must hold virtualMutex for writing
+func vNextSequence() uint64 {
+	virtualSequence++
+	return virtualSequence
+}
+
+// must hold virtualMutex for writing
+func vDeleted(p string) {
+	sequence := vNextSequence()
+
+	tombstone := virtualDeleted
+	for _, component := range vComponents(p) {
+		tombstone.latest = sequence
+		child, ok := tombstone.children[component]
+		if !ok {
+			child = newVTombstone()
+			tombstone.children[component] = child
+		}
+		tombstone = child
+	}
+
+	tombstone.sequence = sequence
+	tombstone.latest = sequence
+	tombstone.children = map[string]*vTombstone{}
+}
+
+// must hold virtualMutex
+func vTombstoneLookup(components []string) *vTombstone {
+	tombstone := virtualDeleted
+	for _, component := range components {
+		tombstone = tombstone.children[component]
+		if tombstone == nil {
+			return nil
+		}
+	}
+	return tombstone
+}
+
+// the deleted paths after since, under p
+func (t *vTombstone) collect(p string, since uint64, deleted []string) []string {
+	if t.latest <= since {
+		return deleted
+	}
+
+	if t.sequence > since {
+		deleted = append(deleted, p)
+	}
+
+	for name, child := range t.children {
+		deleted = child.collect(strings.TrimSuffix(p, "/")+"/"+name, since, deleted)
+	}
+
+	return deleted
+}
+
+// maps every sequence, 0 drops the deletion,
+// returns false when nothing is left
+func (t *vTombstone) update(sequence func(uint64) uint64) bool {
+	if t.sequence > 0 {
+		t.sequence = sequence(t.sequence)
+	}
+	t.latest = t.sequence
+
+	for name, child := range t.children {
+		if !child.update(sequence) {
+			delete(t.children, name)
+		} else if child.latest > t.latest {
+			t.latest = child.latest
+		}
+	}
+
+	return t.latest > 0
+}
+
+// must hold virtualMutex for writing,
+// drops the deletions up to sequence under the components
+func vTombstonePrune(components []string, sequence uint64) {
+	tombstone := virtualDeleted
+	parents := []*vTombstone{}
+	for _, component := range components {
+		parents = append(parents, tombstone)
+		tombstone = tombstone.children[component]
+		if tombstone == nil {
+			return
+		}
+	}
+
+	tombstone.update(func(s uint64) uint64 {
+		if s <= sequence {
+			return 0
+		}
+		return s
+	})
+
+	if tombstone.latest > 0 {
+		return
+	}
+
+	// the parents keep their latest, it only
+	// costs a walk down to a pruned branch
+	for i := len(parents) - 1; i >= 0; i-- {
+		delete(parents[i].children, components[i])
+		if parents[i].sequence > 0 || len(parents[i].children) > 0 {
+			return
+		}
+	}
+}
+
+// must hold virtualMutex for writing,
+// a moved node is new at its destination
+func vChangedTree(node *vNode) {
+	node.sequence = vNextSequence()
+
+	for _, child := range node.children {
+		vChangedTree(child)
+	}
+}
+
+type VirtualDelta struct {
+	// of the last change included
+	Sequence uint64
+	// a snapshot replaces everything under Prefix
+	Full   bool
+	Prefix string
+	// absolute paths, deletions apply before the entries
+	Deleted []string
+	// absolute paths, directories before their content
+	Entries []VirtualEntry
+}
+
+// must hold virtualMutex, every node when full,
+// imported nodes have no sequence
+func vCollect(prefix string, since uint64, full bool) []VirtualEntry {
+	entries := []VirtualEntry{}
+
+	node := vLookup(prefix)
+	if node == nil {
+		return entries
+	}
+
+	var walk func(node *vNode, p string)
+	walk = func(node *vNode, p string) {
+		if (full || node.sequence > since) && p != "/" {
+			entries = append(entries, VirtualEntry{
+				Path:    p,
+				IsDir:   node.isDir,
+				Data:    node.data,
+				ModTime: node.modTime,
+			})
+		}
+
+		names := make([]string, 0, len(node.children))
+		for name := range node.children {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		for _, name := range names {
+			walk(node.children[name], strings.TrimSuffix(p, "/")+"/"+name)
+		}
+	}
+
+	walk(node, "/"+strings.Join(vComponents(prefix), "/"))
+
+	return entries
+}
+
+// everything under prefix
+func VirtualSnapshot(prefix string) VirtualDelta {
+	virtualMutex.RLock()
+	defer virtualMutex.RUnlock()
+
+	return VirtualDelta{
+		Sequence: virtualSequence,
+		Full:     true,
+		Prefix:   "/" + strings.Join(vComponents(prefix), "/"),
+		Deleted:  []string{},
+		Entries:  vCollect(prefix, 0, true),
+	}
+}
+
+// What changed under prefix after the since sequence.
+// The deletions up to since are dropped, the platform
+// already persisted them and never asks for less
+func VirtualChanges(prefix string, since uint64) VirtualDelta {
+	virtualMutex.Lock()
+	defer virtualMutex.Unlock()
+
+	components := vComponents(prefix)
+	prefix = "/" + strings.Join(components, "/")
+
+	vTombstonePrune(components, since)
+
+	deleted := []string{}
+	if tombstone := vTombstoneLookup(components); tombstone != nil {
+		deleted = tombstone.collect(prefix, since, deleted)
+	}
+	slices.Sort(deleted)
+
+	return VirtualDelta{
+		Sequence: virtualSequence,
+		Prefix:   prefix,
+		Deleted:  deleted,
+		Entries:  vCollect(prefix, since, false),
+	}
+}
+
+// Restores a snapshot or applies a delta.
+// Imported entries are not reported by VirtualChanges,
+// they already are where they come from.
+// No file events are emitted
+func VirtualImport(delta VirtualDelta) error {
+	virtualMutex.Lock()
+	defer virtualMutex.Unlock()
+
+	// the changes made before the import are numbered
+	// up to importSequence, see the re-sequencing below
+	importSequence := virtualSequence
+
+	removed := []string{}
+	if delta.Full {
+		removed = append(removed, delta.Prefix)
+	}
+	removed = append(removed, delta.Deleted...)
+
+	for _, p := range removed {
+		components := vComponents(p)
+		if len(components) == 0 {
+			virtualRoot.children = map[string]*vNode{}
+			continue
+		}
+
+		parent := vLookup(strings.Join(components[:len(components)-1], "/"))
+		if parent != nil && parent.isDir {
+			delete(parent.children, components[len(components)-1])
+		}
+	}
+
+	for _, entry := range delta.Entries {
+		components := vComponents(entry.Path)
+		if len(components) == 0 {
+			continue
+		}
+
+		parent, err := vMkdirAll(components[:len(components)-1])
+		if err != nil {
+			return err
+		}
+
+		name := components[len(components)-1]
+		node := parent.children[name]
+
+		if entry.IsDir {
+			if node == nil || !node.isDir {
+				node = newVDir()
+				parent.children[name] = node
+			}
+		} else {
+			if node != nil && node.isDir {
+				return errors.New("EISDIR")
+			}
+			node = &vNode{data: entry.Data}
+			parent.children[name] = node
+		}
+
+		if !entry.ModTime.IsZero() {
+			node.modTime = entry.ModTime
+		}
+		node.sequence = 0
+	}
+
+	// The directories created on the way are persisted
+	// with the entries under them. The changes made before
+	// the import move after delta.Sequence, the platform
+	// exports from there and would skip them otherwise
+	var resequence func(node *vNode)
+	resequence = func(node *vNode) {
+		if node.sequence > importSequence {
+			node.sequence = 0
+		} else if node.sequence > 0 {
+			node.sequence += delta.Sequence
+		}
+		for _, child := range node.children {
+			resequence(child)
+		}
+	}
+	resequence(virtualRoot)
+
+	// a snapshot brings back what was deleted under its prefix
+	if delta.Full {
+		vTombstonePrune(vComponents(delta.Prefix), importSequence)
+	}
+	virtualDeleted.update(func(sequence uint64) uint64 {
+		if sequence > importSequence {
+			return 0
+		}
+		return sequence + delta.Sequence
+	})
+
+	virtualSequence = delta.Sequence + importSequence
+
+	return nil
+}
+
+// [sequence, full, prefix, deletedCount, ...deleted, ...(path, isDir, modTimeMs, data)]
+func (delta VirtualDelta) Serialize() []byte {
+	args := []any{
+		float64(delta.Sequence),
+		delta.Full,
+		delta.Prefix,
+		float64(len(delta.Deleted)),
+	}
+
+	for _, p := range delta.Deleted {
+		args = append(args, p)
+	}
+
+	for _, entry := range delta.Entries {
+		data := entry.Data
+		if data == nil {
+			data = []byte{}
+		}
+		args = append(args, entry.Path, entry.IsDir, float64(entry.ModTime.UnixMilli()), data)
+	}
+
+	return serialize.SerializeArgs(args)
+}
+
+// not negative, NaN, a fraction or past
+// the integers a JavaScript number holds
+func vWholeNumber(n float64) bool {
+	return n >= 0 && n <= 1<<53 && n == math.Trunc(n)
+}
+
+func DeserializeVirtualDelta(data []byte) (VirtualDelta, error) {
+	delta := VirtualDelta{}
+	invalid := errors.New("invalid virtual fs delta")
+
+	args := serialize.DeserializeArgs(data)
+	if len(args) < 4 {
+		return delta, invalid
+	}
+
+	sequence, ok1 := args[0].(float64)
+	full, ok2 := args[1].(bool)
+	prefix, ok3 := args[2].(string)
+	deletedCount, ok4 := args[3].(float64)
+	if !ok1 || !ok2 || !ok3 || !ok4 ||
+		!vWholeNumber(sequence) || !vWholeNumber(deletedCount) ||
+		deletedCount > float64(len(args)-4) {
+		return delta, invalid
+	}
+
+	delta.Sequence = uint64(sequence)
+	delta.Full = full
+	delta.Prefix = prefix
+	delta.Deleted = []string{}
+
+	for _, arg := range args[4 : 4+int(deletedCount)] {
+		p, ok := arg.(string)
+		if !ok {
+			return delta, invalid
+		}
+		delta.Deleted = append(delta.Deleted, p)
+	}
+
+	entries := args[4+int(deletedCount):]
+	if len(entries)%4 != 0 {
+		return delta, invalid
+	}
+
+	for i := 0; i < len(entries); i += 4 {
+		p, ok1 := entries[i].(string)
+		isDir, ok2 := entries[i+1].(bool)
+		modTime, ok3 := entries[i+2].(float64)
+		if !ok1 || !ok2 || !ok3 {
+			return delta, invalid
+		}
+
+		// empty buffers can come back as nil
+		data, _ := entries[i+3].([]byte)
+
+		entry := VirtualEntry{
+			Path:    p,
+			IsDir:   isDir,
+			ModTime: time.UnixMilli(int64(modTime)),
+		}
+		if !isDir {
+			entry.Data = data
+		}
+
+		delta.Entries = append(delta.Entries, entry)
+	}
+
+	return delta, nil
+}
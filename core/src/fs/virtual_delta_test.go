@@ -0,0 +1,235 @@
+package fs
+
+import (
+	"bytes"
+	"math"
+	"slices"
+	"testing"
+
+	serialize "fullstackedorg/fullstacked/src/serialize"
+)
+
+// a fresh virtual fs, as after a reload
+func resetVirtual(t *testing.T) {
+	WASM = true
+	t.Cleanup(func() {
+		WASM = false
+	})
+
+	virtualMutex.Lock()
+	virtualRoot = &vNode{isDir: true, children: map[string]*vNode{}}
+	virtualSequence = 0
+	virtualDeleted = newVTombstone()
+	virtualMutex.Unlock()
+}
+
+// through the platform
+func roundTrip(t *testing.T, delta VirtualDelta) VirtualDelta {
+	result, err := DeserializeVirtualDelta(delta.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func sameEntries(t *testing.T, got []VirtualEntry, expected []VirtualEntry) {
+	t.Helper()
+
+	if len(got) != len(expected) {
+		t.Fatalf("got %d entries, expected %d", len(got), len(expected))
+	}
+
+	for i := range got {
+		if got[i].Path != expected[i].Path ||
+			got[i].IsDir != expected[i].IsDir ||
+			!bytes.Equal(got[i].Data, expected[i].Data) {
+			t.Fatalf("got %s, expected %s", got[i].Path, expected[i].Path)
+		}
+	}
+}
+
+func TestVirtualSnapshotAndDeltas(t *testing.T) {
+	resetVirtual(t)
+
+	Mkdir("/projects/a/src", "")
+	WriteFile("/projects/a/index.ts", []byte("index"), "")
+	WriteFile("/projects/a/src/lib.ts", []byte("lib"), "")
+	WriteFile("/projects/a/empty.txt", []byte{}, "")
+	WriteFile("/other/file", []byte("other"), "")
+
+	snapshot := roundTrip(t, VirtualSnapshot("/projects"))
+
+	if !snapshot.Full || snapshot.Prefix != "/projects" {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+
+	WriteFile("/projects/a/index.ts", []byte("index 2"), "")
+	Unlink("/projects/a/empty.txt", "")
+	Rename("/projects/a/src", "/projects/a/lib", "")
+	Mkdir("/projects/b", "")
+
+	delta := roundTrip(t, VirtualChanges("/projects", snapshot.Sequence))
+
+	if !slices.Equal(delta.Deleted, []string{"/projects/a/empty.txt", "/projects/a/src"}) {
+		t.Fatalf("unexpected deletions %v", delta.Deleted)
+	}
+
+	expected := VirtualSnapshot("/projects")
+
+	// after a reload
+	resetVirtual(t)
+
+	if err := VirtualImport(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if err := VirtualImport(delta); err != nil {
+		t.Fatal(err)
+	}
+
+	sameEntries(t, VirtualSnapshot("/projects").Entries, expected.Entries)
+
+	// imported, nothing to persist
+	changes := VirtualChanges("/", delta.Sequence)
+	if len(changes.Entries) != 0 || len(changes.Deleted) != 0 {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+
+	WriteFile("/projects/b/new.ts", []byte("new"), "")
+
+	changes = VirtualChanges("/", delta.Sequence)
+	sameEntries(t, changes.Entries, []VirtualEntry{
+		{Path: "/projects/b/new.ts", Data: []byte("new")},
+	})
+}
+
+func TestVirtualImportKeepsEarlierChanges(t *testing.T) {
+	resetVirtual(t)
+
+	for range 10 {
+		WriteFile("/projects/a/index.ts", []byte("persisted"), "")
+	}
+	persisted := VirtualSnapshot("/projects")
+
+	resetVirtual(t)
+
+	// written and deleted before the persisted state is loaded
+	WriteFile("/tmp/early", []byte("early"), "")
+	Mkdir("/tmp/removed", "")
+	Rmdir("/tmp/removed", "")
+
+	if err := VirtualImport(persisted); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := VirtualChanges("/", persisted.Sequence)
+
+	sameEntries(t, changes.Entries, []VirtualEntry{
+		{Path: "/tmp", IsDir: true},
+		{Path: "/tmp/early", Data: []byte("early")},
+	})
+
+	if !slices.Equal(changes.Deleted, []string{"/tmp/removed"}) {
+		t.Fatalf("unexpected deletions %v", changes.Deleted)
+	}
+
+	// later changes come after the earlier ones
+	WriteFile("/tmp/late", []byte("late"), "")
+
+	changes = VirtualChanges("/", changes.Sequence)
+	sameEntries(t, changes.Entries, []VirtualEntry{
+		{Path: "/tmp/late", Data: []byte("late")},
+	})
+}
+
+func TestDeserializeVirtualDeltaInvalid(t *testing.T) {
+	tests := [][]any{
+		{1.0, false, "/"},
+		{-1.0, false, "/", 0.0},
+		{1.5, false, "/", 0.0},
+		{1.0, false, "/", -1.0},
+		{1.0, false, "/", 0.5},
+		{1.0, false, "/", math.NaN()},
+		{1.0, false, "/", math.Inf(1)},
+		{1.0, false, "/", 2.0, "/a"},
+		{1.0, false, "/", 1.0, true},
+		{1.0, false, "/", 0.0, "/a", false, 0.0},
+		{1.0, false, "/", 0.0, "/a", "dir", 0.0, []byte{}},
+	}
+
+	for _, args := range tests {
+		_, err := DeserializeVirtualDelta(serialize.SerializeArgs(args))
+		if err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestVirtualDeletions(t *testing.T) {
+	resetVirtual(t)
+
+	Mkdir("/projects/a/src", "")
+	WriteFile("/projects/a/src/lib.ts", []byte("lib"), "")
+	WriteFile("/projects/a/index.ts", []byte("index"), "")
+	WriteFile("/projects/ab", []byte("sibling"), "")
+	WriteFile("/other/file", []byte("other"), "")
+	start := VirtualSnapshot("/").Sequence
+
+	Unlink("/projects/a/src/lib.ts", "")
+	Unlink("/projects/ab", "")
+	Unlink("/other/file", "")
+
+	changes := VirtualChanges("/projects", start)
+	if !slices.Equal(changes.Deleted, []string{"/projects/a/src/lib.ts", "/projects/ab"}) {
+		t.Fatalf("unexpected deletions %v", changes.Deleted)
+	}
+
+	// the directory covers the deletions under it
+	Rmdir("/projects/a", "")
+
+	changes = VirtualChanges("/projects/a", start)
+	if !slices.Equal(changes.Deleted, []string{"/projects/a"}) {
+		t.Fatalf("unexpected deletions %v", changes.Deleted)
+	}
+
+	persisted := changes.Sequence
+	VirtualChanges("/projects", persisted)
+
+	// persisted, pruned under the prefix only
+	changes = VirtualChanges("/", start)
+	if !slices.Equal(changes.Deleted, []string{"/other/file"}) {
+		t.Fatalf("unexpected deletions %v", changes.Deleted)
+	}
+
+	VirtualChanges("/", changes.Sequence)
+
+	virtualMutex.RLock()
+	left := len(virtualDeleted.children)
+	virtualMutex.RUnlock()
+	if left != 0 {
+		t.Fatalf("%d tombstones left", left)
+	}
+}
+
+func TestVirtualImportRestoresDeletions(t *testing.T) {
+	resetVirtual(t)
+
+	WriteFile("/projects/a/index.ts", []byte("persisted"), "")
+	persisted := VirtualSnapshot("/projects")
+
+	resetVirtual(t)
+
+	// deleted before the snapshot brings it back
+	WriteFile("/projects/a/index.ts", []byte("early"), "")
+	Unlink("/projects/a/index.ts", "")
+	WriteFile("/tmp/removed", []byte("removed"), "")
+	Unlink("/tmp/removed", "")
+
+	if err := VirtualImport(persisted); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := VirtualChanges("/", persisted.Sequence)
+	if !slices.Equal(changes.Deleted, []string{"/tmp/removed"}) {
+		t.Fatalf("unexpected deletions %v", changes.Deleted)
+	}
+}
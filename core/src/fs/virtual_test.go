@@ -0,0 +1,159 @@
+package fs
+
+import (
+	"slices"
+	"testing"
+)
+
+func names(t *testing.T, items []FileInfo2, err error) []string {
+	t.Helper()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := []string{}
+	for _, item := range items {
+		result = append(result, item.Name)
+	}
+	return result
+}
+
+func fileContent(t *testing.T, p string) string {
+	t.Helper()
+
+	data, err := ReadFile(p)
+	if err != nil {
+		t.Fatalf("%s: %v", p, err)
+	}
+	return string(data)
+}
+
+func TestVirtualRename(t *testing.T) {
+	resetVirtual(t)
+
+	WriteFile("/a/file", []byte("a"), "")
+	WriteFile("/a/dir/nested", []byte("nested"), "")
+	WriteFile("/ab/file", []byte("ab"), "")
+
+	if !Rename("/a", "/c", "") {
+		t.Fatal("rename failed")
+	}
+
+	if exists, _ := Exists("/a"); exists {
+		t.Fatal("/a still exists")
+	}
+	if fileContent(t, "/c/file") != "a" || fileContent(t, "/c/dir/nested") != "nested" {
+		t.Fatal("unexpected content under /c")
+	}
+
+	// the sibling sharing the prefix stays
+	if fileContent(t, "/ab/file") != "ab" {
+		t.Fatal("unexpected content under /ab")
+	}
+
+	if !Rename("/c/file", "/ab/renamed", "") || fileContent(t, "/ab/renamed") != "a" {
+		t.Fatal("file rename failed")
+	}
+
+	WriteFile("/target/file", []byte("target"), "")
+
+	failures := []struct {
+		oldPath string
+		newPath string
+		err     string
+	}{
+		{"/missing", "/other", "ENOENT"},
+		// the parent is not created
+		{"/ab/file", "/missing/file", "ENOENT"},
+		{"/ab/file", "/ab/renamed/file", "ENOTDIR"},
+		{"/c", "/c/dir/inside", "EINVAL"},
+		{"/c", "/target", "ENOTEMPTY"},
+		{"/c", "/ab/file", "ENOTDIR"},
+		{"/ab/file", "/c/dir", "EISDIR"},
+	}
+
+	for _, test := range failures {
+		err := vRename(test.oldPath, test.newPath)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%s => %s: got %v, expected %s", test.oldPath, test.newPath, err, test.err)
+		}
+	}
+
+	// replaces a file
+	if !Rename("/ab/file", "/ab/renamed", "") || fileContent(t, "/ab/renamed") != "ab" {
+		t.Fatal("rename over a file failed")
+	}
+}
+
+func TestVirtualRmdir(t *testing.T) {
+	resetVirtual(t)
+
+	WriteFile("/a/dir/nested", []byte("nested"), "")
+	WriteFile("/ab/file", []byte("ab"), "")
+
+	if !Rmdir("/a", "") {
+		t.Fatal("rmdir failed")
+	}
+
+	for _, p := range []string{"/a", "/a/dir", "/a/dir/nested"} {
+		if exists, _ := Exists(p); exists {
+			t.Fatalf("%s still exists", p)
+		}
+	}
+
+	if fileContent(t, "/ab/file") != "ab" {
+		t.Fatal("unexpected content under /ab")
+	}
+
+	// like os.RemoveAll
+	if !Rmdir("/missing", "") {
+		t.Fatal("rmdir of a missing directory failed")
+	}
+}
+
+func TestVirtualReadDir(t *testing.T) {
+	resetVirtual(t)
+
+	WriteFile("/p/b.ts", []byte{}, "")
+	WriteFile("/p/a.ts", []byte{}, "")
+	WriteFile("/p/src/c.ts", []byte{}, "")
+	WriteFile("/p/src/c.js", []byte{}, "")
+	WriteFile("/p/node_modules/m/index.js", []byte{}, "")
+	Mkdir("/p/empty", "")
+
+	tests := []struct {
+		name      string
+		recursive bool
+		filesOnly bool
+		skip      []string
+		include   []string
+		expected  []string
+	}{
+		{"flat", false, false, nil, nil, []string{"a.ts", "b.ts", "empty", "node_modules", "src"}},
+		{"recursive", true, false, nil, nil, []string{
+			"a.ts", "b.ts", "empty", "node_modules", "node_modules/m", "node_modules/m/index.js",
+			"src", "src/c.js", "src/c.ts",
+		}},
+		{"files only", true, true, nil, nil, []string{"a.ts", "b.ts", "node_modules/m/index.js", "src/c.js", "src/c.ts"}},
+		{"skip", true, false, []string{"node_modules", "/empty"}, nil, []string{"a.ts", "b.ts", "src", "src/c.js", "src/c.ts"}},
+		{"include", true, true, []string{"node_modules"}, []string{"*.ts"}, []string{"a.ts", "b.ts", "src/c.ts"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			items, err := ReadDir("/p", test.recursive, test.filesOnly, test.skip, test.include)
+			got := names(t, items, err)
+			if !slices.Equal(got, test.expected) {
+				t.Fatalf("got %q, expected %q", got, test.expected)
+			}
+		})
+	}
+
+	if _, err := ReadDir("/missing", false, false, nil, nil); err == nil || err.Error() != "ENOENT" {
+		t.Fatalf("got %v, expected ENOENT", err)
+	}
+	if _, err := ReadDir("/p/a.ts", false, false, nil, nil); err == nil || err.Error() != "ENOTDIR" {
+		t.Fatalf("got %v, expected ENOTDIR", err)
+	}
+}
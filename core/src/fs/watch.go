@@ -0,0 +1,158 @@
+package fs
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	glob "fullstackedorg/fullstacked/src/glob"
+	serialize "fullstackedorg/fullstacked/src/serialize"
+)
+
+// Changes made outside of the core, by an external editor,
+// the git CLI or a sync client, are reported by an OS watcher
+// as FileEvents with the ExternalOrigin,
+// through fsnotify on every OS
+
+var WatchSkip = []string{".git", "node_modules", "/.build"}
+
+type osWatcher interface {
+	close()
+}
+
+var watchersMutex = sync.Mutex{}
+
+// watched directory => its OS watcher, nil when
+// under another watched directory reporting its events
+var watchers = map[string]osWatcher{}
+
+// must hold watchersMutex
+func watchCovered(directory string) bool {
+	skip := glob.New(WatchSkip)
+
+	for watched, watcher := range watchers {
+		if watcher == nil || !strings.HasPrefix(directory, watched+"/") {
+			continue
+		}
+		if !skip.Match(watchRelative(watched, directory), true) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// watching an already watched directory does nothing
+func Watch(directory string) error {
+	// the virtual fs has no outside changes
+	if WASM {
+		return nil
+	}
+
+	directory = path.Clean(filepath.ToSlash(directory))
+
+	exists, isFile := Exists(directory)
+	if !exists {
+		return errors.New("ENOENT")
+	}
+	if isFile {
+		return errors.New("ENOTDIR")
+	}
+
+	watchersMutex.Lock()
+	defer watchersMutex.Unlock()
+
+	if _, ok := watchers[directory]; ok {
+		return nil
+	}
+
+	if watchCovered(directory) {
+		watchers[directory] = nil
+		return nil
+	}
+
+	watcher, err := newOSWatcher(directory, glob.New(WatchSkip))
+	if err != nil {
+		return err
+	}
+
+	watchers[directory] = watcher
+
+	// now reported by this watcher
+	for watched, w := range watchers {
+		if w != nil && watched != directory && watchCovered(watched) {
+			w.close()
+			watchers[watched] = nil
+		}
+	}
+
+	return nil
+}
+
+func watching() bool {
+	watchersMutex.Lock()
+	defer watchersMutex.Unlock()
+	return len(watchers) > 0
+}
+
+func WatchSerialized(directory string) []byte {
+	err := Watch(directory)
+	if err != nil {
+		return serialize.SerializeError(err)
+	}
+	return nil
+}
+
+func Unwatch(directory string) {
+	directory = path.Clean(filepath.ToSlash(directory))
+
+	watchersMutex.Lock()
+	defer watchersMutex.Unlock()
+
+	watcher, ok := watchers[directory]
+	if !ok {
+		return
+	}
+	delete(watchers, directory)
+
+	if watcher == nil {
+		return
+	}
+	watcher.close()
+
+	// the directories it reported for, parents first
+	uncovered := []string{}
+	for watched, w := range watchers {
+		if w == nil && strings.HasPrefix(watched, directory+"/") {
+			uncovered = append(uncovered, watched)
+		}
+	}
+	slices.SortFunc(uncovered, func(a, b string) int {
+		return len(a) - len(b)
+	})
+
+	for _, watched := range uncovered {
+		if watchCovered(watched) {
+			continue
+		}
+		w, err := newOSWatcher(watched, glob.New(WatchSkip))
+		if err != nil {
+			// gone since
+			delete(watchers, watched)
+			continue
+		}
+		watchers[watched] = w
+	}
+}
+
+// relative to the watched directory, for the skip list
+func watchRelative(directory string, p string) string {
+	relative, err := filepath.Rel(directory, p)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(relative)
+}
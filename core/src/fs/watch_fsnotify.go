@@ -0,0 +1,302 @@
+package fs
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	glob "fullstackedorg/fullstacked/src/glob"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// inotify on Linux and Android, kqueue on macOS and iOS,
+// ReadDirectoryChangesW on Windows, all through fsnotify.
+// Not recursive, one watch per directory.
+//
+// Every OS reports a rename as a Rename of the old path
+// and a Create of the new one, in either order.
+// Both are held for renamePairWindow to be paired
+// back into one RENAME, unpaired they are DELETED and CREATED.
+const renamePairWindow = 50 * time.Millisecond
+
+type heldEvent struct {
+	op    fsnotify.Op
+	path  string
+	isDir bool
+	time  time.Time
+}
+
+type fsnotifyWatcher struct {
+	directory string
+	skip      *glob.Matcher
+	watcher   *fsnotify.Watcher
+
+	mutex       sync.Mutex
+	directories map[string]bool
+
+	// only used by the read goroutine
+	held []heldEvent
+	// a moved directory also reports
+	// the Rename of its own watch
+	lastRenamed string
+}
+
+func newOSWatcher(directory string, skip *glob.Matcher) (osWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &fsnotifyWatcher{
+		directory:   directory,
+		skip:        skip,
+		watcher:     watcher,
+		directories: map[string]bool{},
+	}
+
+	err = w.addRecursive(directory, false)
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go w.read()
+
+	return w, nil
+}
+
+func (w *fsnotifyWatcher) close() {
+	w.watcher.Close()
+}
+
+func (w *fsnotifyWatcher) skipped(p string, isDir bool) bool {
+	relative := watchRelative(w.directory, p)
+	return relative != "." && w.skip.Match(relative, isDir)
+}
+
+// watches directory and its subdirectories,
+// emitCreated reports their content for directories
+// created or moved in after the parent watch
+func (w *fsnotifyWatcher) addRecursive(directory string, emitCreated bool) error {
+	if w.skipped(directory, true) {
+		return nil
+	}
+
+	err := w.watcher.Add(filepath.FromSlash(directory))
+	if err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	w.directories[directory] = true
+	w.mutex.Unlock()
+
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil
+	}
+
+	for _, entry := range entries {
+		p := path.Join(directory, entry.Name())
+
+		if w.skipped(p, entry.IsDir()) {
+			continue
+		}
+
+		if emitCreated {
+			externalEvent(FileEvent{
+				Type:   CREATED,
+				Paths:  []string{p},
+				IsFile: !entry.IsDir(),
+			})
+		}
+
+		if entry.IsDir() {
+			w.addRecursive(p, emitCreated)
+		}
+	}
+
+	return nil
+}
+
+// returns if p was a watched directory
+func (w *fsnotifyWatcher) removed(p string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	isDir := w.directories[p]
+
+	for directory := range w.directories {
+		if directory == p || strings.HasPrefix(directory, p+"/") {
+			delete(w.directories, directory)
+			// already gone with the directory most of the time
+			w.watcher.Remove(filepath.FromSlash(directory))
+		}
+	}
+
+	return isDir
+}
+
+func (w *fsnotifyWatcher) read() {
+	timer := time.NewTimer(renamePairWindow)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				w.release(time.Time{})
+				return
+			}
+			w.handle(event)
+		case <-timer.C:
+			w.release(time.Now().Add(-renamePairWindow))
+		case _, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+		}
+
+		if len(w.held) > 0 {
+			timer.Reset(time.Until(w.held[0].time.Add(renamePairWindow)))
+		}
+	}
+}
+
+func (w *fsnotifyWatcher) handle(event fsnotify.Event) {
+	p := filepath.ToSlash(event.Name)
+
+	switch {
+	case event.Has(fsnotify.Create):
+		info, err := os.Lstat(p)
+		if err != nil || w.skipped(p, info.IsDir()) {
+			return
+		}
+
+		if p == w.lastRenamed {
+			w.lastRenamed = ""
+		}
+
+		w.hold(fsnotify.Create, p, info.IsDir())
+	case event.Has(fsnotify.Rename):
+		if p == w.lastRenamed || w.isHeld(fsnotify.Rename, p) {
+			return
+		}
+
+		isDir := w.removed(p)
+		if w.skipped(p, isDir) {
+			return
+		}
+
+		w.hold(fsnotify.Rename, p, isDir)
+	case event.Has(fsnotify.Write):
+		info, err := os.Lstat(p)
+		if err != nil || info.IsDir() || w.skipped(p, false) {
+			return
+		}
+
+		// keeps the events in order
+		w.release(time.Time{})
+
+		externalEvent(FileEvent{
+			Type:   MODIFIED,
+			Paths:  []string{p},
+			IsFile: true,
+		})
+	case event.Has(fsnotify.Remove):
+		isDir := w.removed(p)
+		if w.skipped(p, isDir) {
+			return
+		}
+
+		w.release(time.Time{})
+
+		externalEvent(FileEvent{
+			Type:   DELETED,
+			Paths:  []string{p},
+			IsFile: !isDir,
+		})
+	}
+}
+
+func (w *fsnotifyWatcher) isHeld(op fsnotify.Op, p string) bool {
+	for _, held := range w.held {
+		if held.op == op && held.path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// pairs a Rename with a held Create, or the other way around
+func (w *fsnotifyWatcher) hold(op fsnotify.Op, p string, isDir bool) {
+	for i, held := range w.held {
+		if held.op == op || held.isDir != isDir {
+			continue
+		}
+
+		w.held = append(w.held[:i], w.held[i+1:]...)
+
+		oldPath, newPath := held.path, p
+		if op == fsnotify.Rename {
+			oldPath, newPath = p, held.path
+		}
+
+		w.lastRenamed = oldPath
+
+		externalEvent(FileEvent{
+			Type:   RENAME,
+			Paths:  []string{oldPath, newPath},
+			IsFile: !isDir,
+		})
+
+		if isDir {
+			w.addRecursive(newPath, false)
+		}
+
+		return
+	}
+
+	w.held = append(w.held, heldEvent{
+		op:    op,
+		path:  p,
+		isDir: isDir,
+		time:  time.Now(),
+	})
+}
+
+// emits the events held before the given time unpaired,
+// all of them for the zero time
+func (w *fsnotifyWatcher) release(before time.Time) {
+	for len(w.held) > 0 {
+		held := w.held[0]
+		if !before.IsZero() && held.time.After(before) {
+			return
+		}
+		w.held = w.held[1:]
+
+		if held.op == fsnotify.Rename {
+			externalEvent(FileEvent{
+				Type:   DELETED,
+				Paths:  []string{held.path},
+				IsFile: !held.isDir,
+			})
+			continue
+		}
+
+		externalEvent(FileEvent{
+			Type:   CREATED,
+			Paths:  []string{held.path},
+			IsFile: !held.isDir,
+		})
+
+		if held.isDir {
+			w.addRecursive(held.path, true)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package fs
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	glob "fullstackedorg/fullstacked/src/glob"
+	setup "fullstackedorg/fullstacked/src/setup"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// OS events are debounced, then coalesced by the event bus
+const watchSettle = 400 * time.Millisecond
+
+type externalEvents struct {
+	mutex  sync.Mutex
+	events []FileEvent
+}
+
+func recordExternalEvents(t *testing.T) *externalEvents {
+	recorded := &externalEvents{}
+
+	callback := setup.Callback
+	t.Cleanup(func() {
+		setup.Callback = callback
+	})
+
+	setup.Callback = func(projectId string, messageType string, message string) {
+		if projectId != "" || messageType != "file-event" {
+			return
+		}
+
+		batch := []FileEvent{}
+		json.Unmarshal([]byte(message), &batch)
+
+		recorded.mutex.Lock()
+		defer recorded.mutex.Unlock()
+		for _, event := range batch {
+			if event.Origin == ExternalOrigin {
+				recorded.events = append(recorded.events, event)
+			}
+		}
+	}
+
+	return recorded
+}
+
+// the events since the last take
+func (r *externalEvents) take() []FileEvent {
+	time.Sleep(watchSettle)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func hasEvent(events []FileEvent, eventType FileEventType, paths ...string) bool {
+	return slices.ContainsFunc(events, func(event FileEvent) bool {
+		return event.Type == eventType && slices.Equal(event.Paths, paths)
+	})
+}
+
+func watchDirectory(t *testing.T, directory string) {
+	if err := Watch(directory); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		Unwatch(directory)
+	})
+}
+
+func TestWatchRenamePairing(t *testing.T) {
+	recorded := recordExternalEvents(t)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	w := &fsnotifyWatcher{
+		directory:   "/project",
+		skip:        glob.New(WatchSkip),
+		watcher:     watcher,
+		directories: map[string]bool{},
+	}
+
+	// inotify and Windows order
+	w.hold(fsnotify.Rename, "/project/a.txt", false)
+	w.hold(fsnotify.Create, "/project/b.txt", false)
+	// kqueue can report the new path first
+	w.hold(fsnotify.Create, "/project/d.txt", false)
+	w.hold(fsnotify.Rename, "/project/c.txt", false)
+	// a directory only pairs with a directory
+	w.hold(fsnotify.Rename, "/project/e.txt", false)
+	w.hold(fsnotify.Create, "/project/f", true)
+	w.release(time.Time{})
+
+	events := recorded.take()
+
+	expected := []FileEvent{
+		{Type: RENAME, Paths: []string{"/project/a.txt", "/project/b.txt"}, IsFile: true},
+		{Type: RENAME, Paths: []string{"/project/c.txt", "/project/d.txt"}, IsFile: true},
+		{Type: DELETED, Paths: []string{"/project/e.txt"}, IsFile: true},
+		{Type: CREATED, Paths: []string{"/project/f"}, IsFile: false},
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("unexpected %+v", events)
+	}
+	for i, event := range expected {
+		if events[i].Type != event.Type || !slices.Equal(events[i].Paths, event.Paths) || events[i].IsFile != event.IsFile {
+			t.Fatalf("got %+v, expected %+v", events[i], event)
+		}
+	}
+}
+
+func TestWatchExternalChanges(t *testing.T) {
+	recorded := recordExternalEvents(t)
+
+	directory := t.TempDir()
+	os.MkdirAll(path.Join(directory, "src"), 0755)
+	watchDirectory(t, directory)
+
+	file := path.Join(directory, "src", "index.ts")
+	os.WriteFile(file, []byte("1"), 0644)
+
+	if events := recorded.take(); !hasEvent(events, CREATED, file) {
+		t.Fatalf("no creation in %+v", events)
+	}
+
+	renamed := path.Join(directory, "src", "main.ts")
+	os.Rename(file, renamed)
+
+	if events := recorded.take(); len(events) != 1 || !hasEvent(events, RENAME, file, renamed) {
+		t.Fatalf("not a single rename %+v", events)
+	}
+
+	lib := path.Join(directory, "lib")
+	os.Rename(path.Join(directory, "src"), lib)
+
+	events := recorded.take()
+	if len(events) != 1 || !hasEvent(events, RENAME, path.Join(directory, "src"), lib) {
+		t.Fatalf("not a single rename %+v", events)
+	}
+
+	// the moved directory is still watched
+	os.WriteFile(path.Join(lib, "main.ts"), []byte("2"), 0644)
+
+	if events := recorded.take(); !hasEvent(events, MODIFIED, path.Join(lib, "main.ts")) {
+		t.Fatalf("no modification in %+v", events)
+	}
+
+	os.RemoveAll(lib)
+
+	if events := recorded.take(); !hasEvent(events, DELETED, lib) {
+		t.Fatalf("no deletion in %+v", events)
+	}
+}
+
+func TestWatchOwnChanges(t *testing.T) {
+	recorded := recordExternalEvents(t)
+
+	directory := t.TempDir()
+	watchDirectory(t, directory)
+
+	Mkdir(path.Join(directory, "a", "b"), "")
+	WriteFile(path.Join(directory, "a", "b", "file"), []byte("1"), "")
+	Rename(path.Join(directory, "a", "b", "file"), path.Join(directory, "a", "file"), "")
+	Rmdir(path.Join(directory, "a"), "")
+
+	if events := recorded.take(); len(events) != 0 {
+		t.Fatalf("own changes reported %+v", events)
+	}
+}
+
+func TestWatchNested(t *testing.T) {
+	recorded := recordExternalEvents(t)
+
+	directory := t.TempDir()
+	sub := path.Join(directory, "sub")
+	os.MkdirAll(sub, 0755)
+
+	watchDirectory(t, directory)
+	watchDirectory(t, sub)
+
+	os.WriteFile(path.Join(sub, "a"), []byte("1"), 0644)
+
+	events := recorded.take()
+	if len(events) != 1 || !hasEvent(events, CREATED, path.Join(sub, "a")) {
+		t.Fatalf("expected a single creation, got %+v", events)
+	}
+
+	// sub keeps its own watch
+	Unwatch(directory)
+
+	os.WriteFile(path.Join(sub, "b"), []byte("1"), 0644)
+	os.WriteFile(path.Join(directory, "c"), []byte("1"), 0644)
+
+	events = recorded.take()
+	if len(events) != 1 || !hasEvent(events, CREATED, path.Join(sub, "b")) {
+		t.Fatalf("expected a single creation, got %+v", events)
+	}
+}
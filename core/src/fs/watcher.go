@@ -1,10 +1,8 @@
 package fs
 
 import (
-	"encoding/json"
-	"fullstackedorg/fullstacked/src/setup"
-	"fullstackedorg/fullstacked/src/utils"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
@@ -18,6 +16,9 @@ const (
 	DELETED  FileEventType = 4
 )
 
+// origin of the events reported by the OS watchers
+const ExternalOrigin = "external"
+
 type FileEvent struct {
 	Type   FileEventType `json:"type"`
 	Paths  []string      `json:"paths"`
@@ -25,24 +26,85 @@ type FileEvent struct {
 	Origin string        `json:"origin"`
 }
 
-var eventsBuf = []FileEvent{}
-var debounce = utils.NewDebouncer(time.Millisecond * 100) // 100ms
+func watchEvent(event FileEvent) {
+	for i, p := range event.Paths {
+		event.Paths[i] = filepath.ToSlash(p)
+	}
+
+	if event.Origin != ExternalOrigin {
+		recordOwnPaths(event.Paths...)
+	}
+
+	events.push(event)
+}
+
+// The OS watchers also see the changes made through this package.
+// Paths touched by our own events are remembered for ownEventWindow
+// and the OS events on those exact paths are dropped.
+// Recorded before the change too, the OS watchers can be faster
+// than the event emitted after it
+const ownEventWindow = time.Second
+
+type ownEvent struct {
+	path string
+	time time.Time
+}
+
+var ownEventsMutex = sync.Mutex{}
+var ownEvents = map[string]time.Time{}
+
+// oldest first, to expire ownEvents
+var ownEventsQueue = []ownEvent{}
 
-var sendEvents = func() func() {
-	return func() {
-		if setup.Callback == nil {
-			return
+func recordOwnPaths(paths ...string) {
+	ownEventsMutex.Lock()
+	defer ownEventsMutex.Unlock()
+
+	now := time.Now()
+
+	expired := 0
+	for _, e := range ownEventsQueue {
+		if now.Sub(e.time) <= ownEventWindow {
+			break
 		}
-		jsonData, _ := json.Marshal(eventsBuf)
-		setup.Callback("", "file-event", string(jsonData))
-		eventsBuf = []FileEvent{}
+		// unless recorded again since
+		if ownEvents[e.path].Equal(e.time) {
+			delete(ownEvents, e.path)
+		}
+		expired++
+	}
+	ownEventsQueue = ownEventsQueue[expired:]
+
+	for _, p := range paths {
+		p = filepath.ToSlash(p)
+		ownEvents[p] = now
+		ownEventsQueue = append(ownEventsQueue, ownEvent{path: p, time: now})
 	}
 }
 
-func watchEvent(event FileEvent) {
+func isOwnEvent(p string) bool {
+	ownEventsMutex.Lock()
+	defer ownEventsMutex.Unlock()
+
+	t, ok := ownEvents[p]
+	return ok && time.Since(t) <= ownEventWindow
+}
+
+// from the OS watchers
+func externalEvent(event FileEvent) {
 	for i, p := range event.Paths {
 		event.Paths[i] = filepath.ToSlash(p)
 	}
-	eventsBuf = append(eventsBuf, event)
-	debounce(sendEvents())
+
+	own := true
+	for _, p := range event.Paths {
+		own = own && isOwnEvent(p)
+	}
+
+	if own {
+		return
+	}
+
+	event.Origin = ExternalOrigin
+	watchEvent(event)
 }
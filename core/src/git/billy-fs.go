@@ -24,6 +24,7 @@ import (
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/helper/chroot"
 	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 
 	realFs "fullstackedorg/fullstacked/src/fs"
 )
@@ -31,13 +32,14 @@ import (
 const separator = filepath.Separator
 
 type Memory struct {
-	ignore []string
+	// nil for no FullStacked defaults
+	ignore *defaultsMatcher
 
 	s *storage
 }
 
 // New returns a new Memory filesystem.
-func NewBillyFS(storage *storage, ignore []string) billy.Filesystem {
+func NewBillyFS(storage *storage, ignore *defaultsMatcher) billy.Filesystem {
 	fs := &Memory{
 		s:      storage,
 		ignore: ignore,
@@ -148,20 +150,27 @@ func (a ByName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 
 func (fs *Memory) ReadDir(path string) ([]os.FileInfo, error) {
 	// Read with fs and populate memory storage
-	// skip ignored files
+	// skip the directories of FullStacked artifacts
 	filePath := filepath.Join(fs.s.Root, path)
 	exists, isFile := realFs.Exists(filePath)
 	if exists && !isFile {
-		contents, _ := realFs.ReadDir(filePath, false, false, []string{})
+		contents, _ := realFs.ReadDir(filePath, false, false, nil, nil)
+
+		ignore := (gitignore.Matcher)(nil)
+		if fs.ignore != nil {
+			ignore = fs.ignore.current()
+		}
+
 		for _, item := range contents {
 			filePath := filepath.Join(path, item.Name)
 
+			// only skip the FullStacked defaults, .gitignore files
+			// are handled by go-git and tracked files can be in
+			// the directories they ignore
 			isIgnored := false
-			for _, ignored := range fs.ignore {
-				if filepath.ToSlash(filePath) == ignored {
-					isIgnored = true
-					break
-				}
+			if item.IsDir && ignore != nil {
+				pathComponents := strings.Split(strings.Trim(filepath.ToSlash(filePath), "/"), "/")
+				isIgnored = ignore.Match(pathComponents, true)
 			}
 
 			if !isIgnored {
@@ -0,0 +1,71 @@
+package git
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	serialize "fullstackedorg/fullstacked/src/serialize"
+)
+
+// blame of the file at HEAD,
+// uncommitted changes are not accounted for
+func Blame(directory string, file string) []byte {
+	wg := sync.WaitGroup{}
+
+	repo, err := getRepo(directory, &wg)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	head, err := repo.Head()
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	file = strings.TrimPrefix(filepath.ToSlash(file), "/")
+
+	result, err := git.Blame(commit, file)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	// many lines share the same commit
+	summaries := map[plumbing.Hash]string{}
+
+	data := []byte{}
+
+	for _, line := range result.Lines {
+		summary, ok := summaries[line.Hash]
+
+		if !ok {
+			lineCommit, err := repo.CommitObject(line.Hash)
+			if err == nil {
+				summary = strings.TrimSpace(strings.SplitN(lineCommit.Message, "\n", 2)[0])
+			}
+			summaries[line.Hash] = summary
+		}
+
+		data = append(data, serialize.SerializeString(line.Hash.String())...)
+		data = append(data, serialize.SerializeString(line.AuthorName)...)
+		data = append(data, serialize.SerializeString(line.Author)...)
+		data = append(data, serialize.SerializeNumber(float64(line.Date.UnixMilli()))...)
+		data = append(data, serialize.SerializeString(summary)...)
+	}
+
+	wg.Wait()
+
+	return data
+}
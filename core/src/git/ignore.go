@@ -0,0 +1,102 @@
+package git
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+
+	config "fullstackedorg/fullstacked/src/config"
+	fs "fullstackedorg/fullstacked/src/fs"
+	glob "fullstackedorg/fullstacked/src/glob"
+	setup "fullstackedorg/fullstacked/src/setup"
+)
+
+// FullStacked artifacts ignored by default.
+// A project can replace this list in the git-ignore config
+// e.g.: { "my-project": ["/.build", "/node_modules"] }
+var defaultIgnored = []string{
+	"/.build",
+	"/data",
+	"/node_modules",
+	"/chat",
+	"/tsconfig.json",
+}
+
+type GitIgnoreConfig = map[string][]string
+
+func fullstackedIgnored(directory string) []string {
+	if setup.Directories == nil {
+		return defaultIgnored
+	}
+
+	gitIgnoreConfigData, err := config.Get("git-ignore")
+
+	if err != nil {
+		return defaultIgnored
+	}
+
+	gitIgnoreConfig := GitIgnoreConfig{}
+	err = json.Unmarshal(gitIgnoreConfigData, &gitIgnoreConfig)
+
+	if err != nil {
+		return defaultIgnored
+	}
+
+	projectId := strings.TrimPrefix(path.Clean(directory), path.Clean(setup.Directories.Root)+"/")
+	ignored, ok := gitIgnoreConfig[projectId]
+
+	if !ok {
+		return defaultIgnored
+	}
+
+	return ignored
+}
+
+// the ReadDir filter of the billy fs, only the FullStacked defaults.
+// The .gitignore files are left to go-git,
+// tracked files can live in the directories they ignore.
+// Rebuilt when the git-ignore config changes
+type defaultsMatcher struct {
+	mutex     sync.Mutex
+	directory string
+	version   string
+	matcher   gitignore.Matcher
+}
+
+func ignoreConfigVersion() string {
+	if setup.Directories == nil {
+		return ""
+	}
+
+	stats, err := fs.Stat(path.Join(setup.Directories.Config, "git-ignore.json"))
+
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%d:%d", stats.MTime.UnixNano(), stats.Size)
+}
+
+// the config is checked on each call,
+// once per listing rather than per entry
+func (m *defaultsMatcher) current() gitignore.Matcher {
+	version := ignoreConfigVersion()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.matcher == nil || m.version != version {
+		m.matcher = gitignore.NewMatcher(glob.Parse(fullstackedIgnored(m.directory), nil))
+		m.version = version
+	}
+
+	return m.matcher
+}
+
+func ignoreMatcher(directory string) *defaultsMatcher {
+	return &defaultsMatcher{directory: directory}
+}
@@ -2,7 +2,6 @@ package git
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/url"
 	"path"
@@ -16,7 +15,6 @@ import (
 	gitConfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/cache"
-	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
@@ -24,19 +22,12 @@ import (
 
 	config "fullstackedorg/fullstacked/src/config"
 	fs "fullstackedorg/fullstacked/src/fs"
+	glob "fullstackedorg/fullstacked/src/glob"
 	serialize "fullstackedorg/fullstacked/src/serialize"
 	setup "fullstackedorg/fullstacked/src/setup"
 	utils "fullstackedorg/fullstacked/src/utils"
 )
 
-var ignored = []string{
-	"/.build",
-	"/data",
-	"/node_modules",
-	"/chat",
-	"/tsconfig.json",
-}
-
 type GitMessageJSON struct {
 	Url      string `json:"url"`
 	Data     string `json:"data"`
@@ -62,13 +53,13 @@ func getRepo(directory string, wg *sync.WaitGroup) (*git.Repository, error) {
 	gitFs := (billy.Filesystem)(nil)
 	if fs.WASM {
 		gitStorage := newStorage(dotDir, wg)
-		gitFs = NewBillyFS(gitStorage, []string{})
+		gitFs = NewBillyFS(gitStorage, nil)
 	} else {
 		gitFs = osfs.New(dotDir)
 	}
 
 	repoStorage := newStorage(directory, wg)
-	repoFs := NewBillyFS(repoStorage, ignored)
+	repoFs := NewBillyFS(repoStorage, ignoreMatcher(directory))
 
 	repo, err = git.Open(filesystem.NewStorage(gitFs, cache.NewObjectLRUDefault()), repoFs)
 
@@ -79,17 +70,16 @@ func getRepo(directory string, wg *sync.WaitGroup) (*git.Repository, error) {
 	return repo, nil
 }
 
-func getWorktree(repo *git.Repository) (*git.Worktree, error) {
+func getWorktree(repo *git.Repository, directory string) (*git.Worktree, error) {
 	worktree, err := repo.Worktree()
 
 	if err != nil {
 		return nil, err
 	}
 
-	// always ignore FullStacked artifacts
-	for _, d := range ignored {
-		worktree.Excludes = append(worktree.Excludes, gitignore.ParsePattern(d, []string{}))
-	}
+	// ignore FullStacked artifacts,
+	// .gitignore files are picked up by go-git
+	worktree.Excludes = append(worktree.Excludes, glob.Parse(fullstackedIgnored(directory), nil)...)
 
 	return worktree, nil
 }
@@ -233,7 +223,7 @@ func HasGit(dir string) bool {
 	return exists && !isFile
 }
 
-func RemoteURL(dir string) string {
+func RemoteURL(dir string, remoteName string) string {
 	if !HasGit(dir) {
 		return ""
 	}
@@ -246,7 +236,7 @@ func RemoteURL(dir string) string {
 		return ""
 	}
 
-	remote, err := repo.Remote("origin")
+	remote, err := getRemote(repo, remoteName)
 
 	if err != nil {
 		return ""
@@ -269,13 +259,13 @@ func Clone(into string, url string) {
 	gitFs := (billy.Filesystem)(nil)
 	if fs.WASM {
 		gitStorage := newStorage(dotDir, &wg)
-		gitFs = NewBillyFS(gitStorage, []string{})
+		gitFs = NewBillyFS(gitStorage, nil)
 	} else {
 		gitFs = osfs.New(dotDir)
 	}
 
 	repoStorage := newStorage(into, &wg)
-	repoFs := NewBillyFS(repoStorage, ignored)
+	repoFs := NewBillyFS(repoStorage, ignoreMatcher(into))
 
 	storage := filesystem.NewStorage(gitFs, cache.NewObjectLRUDefault())
 
@@ -320,9 +310,13 @@ func Clone(into string, url string) {
 	progress.Write([]byte("done"))
 }
 
+// [branch, hash, ahead, behind]
+// ahead and behind are -1 without upstream
 func HeadSerialized(directory string) []byte {
 	branch := ""
 	hash := ""
+	ahead := -1
+	behind := -1
 
 	head, err := Head(directory)
 	if err != nil {
@@ -335,11 +329,16 @@ func HeadSerialized(directory string) []byte {
 	} else {
 		branch = head.Name().Short()
 		hash = head.Hash().String()
+		if head.Name().IsBranch() {
+			ahead, behind = AheadBehind(directory, branch, head.Hash())
+		}
 	}
 
 	data := []byte{}
 	data = append(data, serialize.SerializeString(branch)...)
 	data = append(data, serialize.SerializeString(hash)...)
+	data = append(data, serialize.SerializeNumber(float64(ahead))...)
+	data = append(data, serialize.SerializeNumber(float64(behind))...)
 	return data
 }
 
@@ -372,7 +371,7 @@ func Status(directory string) []byte {
 		return serialize.SerializeString(errorFmt(err))
 	}
 
-	worktree, err := getWorktree(repo)
+	worktree, err := getWorktree(repo, directory)
 
 	if err != nil {
 		return serialize.SerializeString(errorFmt(err))
@@ -411,7 +410,7 @@ func Status(directory string) []byte {
 	return data
 }
 
-func Pull(directory string, isEditor bool, projectId string) {
+func Pull(directory string, isEditor bool, projectId string, remoteName string) {
 	progress := GitProgress{
 		ProjectId: projectId,
 		Name:      "git-pull",
@@ -426,7 +425,7 @@ func Pull(directory string, isEditor bool, projectId string) {
 		return
 	}
 
-	remote, err := repo.Remote("origin")
+	remote, err := getRemote(repo, remoteName)
 
 	if err != nil {
 		progress.Error(err.Error())
@@ -435,7 +434,7 @@ func Pull(directory string, isEditor bool, projectId string) {
 
 	progress.Url = remote.Config().URLs[0]
 
-	worktree, err := getWorktree(repo)
+	worktree, err := getWorktree(repo, directory)
 
 	if err != nil {
 		progress.Error(err.Error())
@@ -489,6 +488,7 @@ func Pull(directory string, isEditor bool, projectId string) {
 	wg.Wait()
 
 	err = worktree.Pull(&git.PullOptions{
+		RemoteName:    remote.Config().Name,
 		Auth:          checkForGitAuth(progress.Url),
 		ReferenceName: head.Name(),
 		Progress:      &progress,
@@ -499,6 +499,7 @@ func Pull(directory string, isEditor bool, projectId string) {
 	if err != nil && strings.HasPrefix(err.Error(), "authentication required") && isEditor {
 		if requestGitAuthentication(progress.Url) {
 			err = worktree.Pull(&git.PullOptions{
+				RemoteName:    remote.Config().Name,
 				Auth:          checkForGitAuth(progress.Url),
 				ReferenceName: head.Name(),
 				Progress:      &progress,
@@ -528,7 +529,38 @@ func Pull(directory string, isEditor bool, projectId string) {
 	progress.End(pullResponse, err != nil)
 }
 
-func Push(directory string) {
+type PushOptions struct {
+	Remote      string   `json:"remote"`
+	Branch      string   `json:"branch"`
+	Force       bool     `json:"force"`
+	SetUpstream bool     `json:"setUpstream"`
+	Tags        []string `json:"tags"`
+	AllTags     bool     `json:"allTags"`
+}
+
+// defaults to all local branches
+func pushBranches(repo *git.Repository, opts PushOptions) ([]string, error) {
+	if opts.Branch != "" {
+		return []string{opts.Branch}, nil
+	}
+
+	branches := []string{}
+
+	localBranches, err := repo.Branches()
+
+	if err != nil {
+		return nil, err
+	}
+
+	localBranches.ForEach(func(r *plumbing.Reference) error {
+		branches = append(branches, r.Name().Short())
+		return nil
+	})
+
+	return branches, nil
+}
+
+func Push(directory string, opts PushOptions) {
 	wg := sync.WaitGroup{}
 
 	progress := GitProgress{
@@ -542,7 +574,14 @@ func Push(directory string) {
 		return
 	}
 
-	remote, err := repo.Remote("origin")
+	remote, err := getRemote(repo, opts.Remote)
+
+	if err != nil {
+		progress.Error(err.Error())
+		return
+	}
+
+	branches, err := pushBranches(repo, opts)
 
 	if err != nil {
 		progress.Error(err.Error())
@@ -555,21 +594,69 @@ func Push(directory string) {
 
 	progress.Write([]byte("start"))
 
-	err = repo.Push(&git.PushOptions{
-		Auth: checkForGitAuth(progress.Url),
-		Progress: &GitProgress{
-			Name: "git-push",
-		},
-	})
+	// force-with-lease protects against overwriting commits
+	// we haven't fetched. The lease is checked against the
+	// remote-tracking ref of each branch, a branch never
+	// pushed has none and is pushed without force,
+	// like the tags
+	leasedRefSpecs := []gitConfig.RefSpec{}
+	refSpecs := []gitConfig.RefSpec{}
+	for _, b := range branches {
+		branchRefName := plumbing.NewBranchReferenceName(b).String()
+		refSpec := gitConfig.RefSpec(branchRefName + ":" + branchRefName)
+
+		if opts.Force {
+			_, err = repo.Reference(plumbing.NewRemoteReferenceName(remote.Config().Name, b), true)
+			if err == nil {
+				leasedRefSpecs = append(leasedRefSpecs, refSpec)
+				continue
+			}
+		}
 
-	if err != nil && strings.HasPrefix(err.Error(), "authentication required") {
-		if requestGitAuthentication(progress.Url) {
-			err = repo.Push(&git.PushOptions{
-				Auth: checkForGitAuth(progress.Url),
-				Progress: &GitProgress{
-					Name: "git-push",
-				},
-			})
+		refSpecs = append(refSpecs, refSpec)
+	}
+	refSpecs = append(refSpecs, tagsRefSpecs(opts.Tags, opts.AllTags)...)
+
+	push := func(refSpecs []gitConfig.RefSpec, forceWithLease *git.ForceWithLease) error {
+		pushOptions := &git.PushOptions{
+			RemoteName:     remote.Config().Name,
+			Auth:           checkForGitAuth(progress.Url),
+			RefSpecs:       refSpecs,
+			ForceWithLease: forceWithLease,
+			Progress:       &progress,
+		}
+
+		err := repo.Push(pushOptions)
+
+		if err != nil && strings.HasPrefix(err.Error(), "authentication required") {
+			if requestGitAuthentication(progress.Url) {
+				pushOptions.Auth = checkForGitAuth(progress.Url)
+				err = repo.Push(pushOptions)
+			}
+		}
+
+		if err == git.NoErrAlreadyUpToDate {
+			return nil
+		}
+
+		return err
+	}
+
+	err = nil
+	if len(leasedRefSpecs) > 0 {
+		err = push(leasedRefSpecs, &git.ForceWithLease{})
+	}
+	if err == nil && (len(refSpecs) > 0 || len(leasedRefSpecs) == 0) {
+		err = push(refSpecs, nil)
+	}
+
+	if err == nil && opts.SetUpstream {
+		for _, b := range branches {
+			upstreamErr := setUpstream(repo, b, remote.Config().Name)
+			if upstreamErr != nil {
+				progress.Error(upstreamErr.Error())
+				return
+			}
 		}
 	}
 
@@ -592,7 +679,7 @@ func Restore(directory string, files []string) []byte {
 		return serialize.SerializeString(errorFmt(err))
 	}
 
-	worktree, err := getWorktree(repo)
+	worktree, err := getWorktree(repo, directory)
 
 	if err != nil {
 		return serialize.SerializeString(errorFmt(err))
@@ -613,7 +700,7 @@ func Restore(directory string, files []string) []byte {
 	return nil
 }
 
-func Fetch(directory string) []byte {
+func Fetch(directory string, remoteName string) []byte {
 	wg := sync.WaitGroup{}
 
 	repo, err := getRepo(directory, &wg)
@@ -622,16 +709,22 @@ func Fetch(directory string) []byte {
 		return serialize.SerializeString(errorFmt(err))
 	}
 
-	remote, _ := repo.Remote("origin")
+	remote, err := getRemote(repo, remoteName)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
 
 	err = repo.Fetch(&git.FetchOptions{
-		Auth: checkForGitAuth(remote.Config().URLs[0]),
+		RemoteName: remote.Config().Name,
+		Auth:       checkForGitAuth(remote.Config().URLs[0]),
 	})
 
 	if err != nil && strings.HasPrefix(err.Error(), "authentication required") {
 		if requestGitAuthentication(remote.Config().URLs[0]) {
 			err = repo.Fetch(&git.FetchOptions{
-				Auth: checkForGitAuth(remote.Config().URLs[0]),
+				RemoteName: remote.Config().Name,
+				Auth:       checkForGitAuth(remote.Config().URLs[0]),
 			})
 		}
 	}
@@ -654,7 +747,7 @@ func Commit(directory string, commitMessage string, authorName string, authorEma
 		return serialize.SerializeString(errorFmt(err))
 	}
 
-	worktree, err := getWorktree(repo)
+	worktree, err := getWorktree(repo, directory)
 
 	if err != nil {
 		return serialize.SerializeString(errorFmt(err))
@@ -678,7 +771,7 @@ func Commit(directory string, commitMessage string, authorName string, authorEma
 	return nil
 }
 
-func getRemoteBranches(directory string) ([]plumbing.Reference, error) {
+func getRemoteBranches(directory string, remoteName string) ([]plumbing.Reference, error) {
 	wg := sync.WaitGroup{}
 
 	repo, err := getRepo(directory, &wg)
@@ -687,7 +780,7 @@ func getRemoteBranches(directory string) ([]plumbing.Reference, error) {
 		return nil, err
 	}
 
-	remote, err := repo.Remote("origin")
+	remote, err := getRemote(repo, remoteName)
 
 	if err != nil {
 		return nil, err
@@ -725,10 +818,12 @@ type Branch struct {
 	Name   string
 	Local  bool
 	Remote bool
+	Ahead  int
+	Behind int
 }
 
-func Branches(directory string) []byte {
-	remoteBranches, err := getRemoteBranches(directory)
+func Branches(directory string, remoteName string) []byte {
+	remoteBranches, err := getRemoteBranches(directory, remoteName)
 
 	if err != nil {
 		return serialize.SerializeString(errorFmt(err))
@@ -741,6 +836,8 @@ func Branches(directory string) []byte {
 			Name:   r.Name().Short(),
 			Remote: true,
 			Local:  false,
+			Ahead:  -1,
+			Behind: -1,
 		})
 	}
 
@@ -760,9 +857,13 @@ func Branches(directory string) []byte {
 	wg.Wait()
 
 	localRefs.ForEach(func(r *plumbing.Reference) error {
+		ahead, behind := branchAheadBehind(repo, r.Name().Short(), r.Hash())
+
 		for i := range branches {
 			if branches[i].Name == r.Name().Short() {
 				branches[i].Local = true
+				branches[i].Ahead = ahead
+				branches[i].Behind = behind
 				return nil
 			}
 		}
@@ -771,6 +872,8 @@ func Branches(directory string) []byte {
 			Name:   r.Name().Short(),
 			Remote: false,
 			Local:  true,
+			Ahead:  ahead,
+			Behind: behind,
 		})
 		return nil
 	})
@@ -781,6 +884,8 @@ func Branches(directory string) []byte {
 		branchesSerialized = append(branchesSerialized, serialize.SerializeString(b.Name)...)
 		branchesSerialized = append(branchesSerialized, serialize.SerializeBoolean(b.Remote)...)
 		branchesSerialized = append(branchesSerialized, serialize.SerializeBoolean(b.Local)...)
+		branchesSerialized = append(branchesSerialized, serialize.SerializeNumber(float64(b.Ahead))...)
+		branchesSerialized = append(branchesSerialized, serialize.SerializeNumber(float64(b.Behind))...)
 	}
 
 	return branchesSerialized
@@ -823,18 +928,14 @@ func IsOnRef(directory string, ref string, refType RefType) bool {
 	}
 
 	// GIT_TAG
-	isOnTag := false
-	tags, err := repo.Tags()
-	if err == nil {
-		tags.ForEach(func(r *plumbing.Reference) error {
-			if r.Name().Short() == ref && r.Hash().String() == head.Hash().String() {
-				isOnTag = true
-			}
-			return nil
-		})
+	tagRef, err := repo.Tag(ref)
+	if err != nil {
+		return false
 	}
 
-	return isOnTag
+	tagCommit, _ := resolveTagCommit(repo, tagRef)
+
+	return tagCommit.String() == head.Hash().String()
 }
 
 func findRefType(directory string, ref string) RefType {
@@ -852,7 +953,7 @@ func findRefType(directory string, ref string) RefType {
 
 	wg.Wait()
 
-	remoteBranches, err := getRemoteBranches(directory)
+	remoteBranches, err := getRemoteBranches(directory, "")
 	if err == nil {
 		for _, b := range remoteBranches {
 			if b.Name().Short() == ref {
@@ -901,7 +1002,7 @@ func CheckoutRef(
 
 	wg.Wait()
 
-	worktree, err := getWorktree(repo)
+	worktree, err := getWorktree(repo, directory)
 
 	if err != nil {
 		return refType
@@ -920,27 +1021,7 @@ func CheckoutRef(
 			Hash: plumbing.NewHash(ref),
 		})
 	case GIT_TAG:
-		tags, tagsErr := repo.Tags()
-		if tagsErr == nil {
-			hash := plumbing.Hash{}
-
-			tags.ForEach(func(r *plumbing.Reference) error {
-				if r.Name().Short() == ref {
-					hash = r.Hash()
-				}
-				return nil
-			})
-
-			if hash.IsZero() {
-				err = errors.New("could not find tag in repository")
-			} else {
-				err = worktree.Checkout(&git.CheckoutOptions{
-					Hash: hash,
-				})
-			}
-		} else {
-			err = tagsErr
-		}
+		err = checkoutTag(repo, worktree, ref)
 	}
 
 	if err != nil {
@@ -956,6 +1037,7 @@ func Checkout(
 	directory string,
 	branch string,
 	create bool,
+	remoteName string,
 ) []byte {
 	wg := sync.WaitGroup{}
 	branchRefName := (*plumbing.ReferenceName)(nil)
@@ -981,7 +1063,34 @@ func Checkout(
 		return nil
 	})
 
-	remoteBranches, err := getRemoteBranches(directory)
+	worktree, err := getWorktree(repo, directory)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	// not a local branch, try for a local tag before
+	// reaching the remote and checkout in detached HEAD
+	if branchRefName == nil && !create {
+		_, err = repo.Tag(branch)
+
+		if err == nil {
+			worktree.AddGlob(".")
+			wg.Wait()
+
+			err = checkoutTag(repo, worktree, branch)
+
+			if err != nil {
+				return serialize.SerializeString(errorFmt(err))
+			}
+
+			wg.Wait()
+
+			return nil
+		}
+	}
+
+	remoteBranches, err := getRemoteBranches(directory, remoteName)
 
 	if err != nil {
 		return serialize.SerializeString(errorFmt(err))
@@ -998,7 +1107,7 @@ func Checkout(
 	}
 
 	if refOnRemote {
-		remote, err := repo.Remote("origin")
+		remote, err := getRemote(repo, remoteName)
 
 		if err != nil {
 			return serialize.SerializeString(errorFmt(err))
@@ -1027,12 +1136,6 @@ func Checkout(
 		wg.Wait()
 	}
 
-	worktree, err := getWorktree(repo)
-
-	if err != nil {
-		return serialize.SerializeString(errorFmt(err))
-	}
-
 	if branchRefName == nil {
 		rName := plumbing.NewBranchReferenceName(branch)
 		branchRefName = &rName
@@ -0,0 +1,269 @@
+package git
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	git "github.com/go-git/go-git/v5"
+	gitConfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	serialize "fullstackedorg/fullstacked/src/serialize"
+)
+
+// empty remote name falls back to origin
+func getRemote(repo *git.Repository, remoteName string) (*git.Remote, error) {
+	if remoteName == "" {
+		remoteName = git.DefaultRemoteName
+	}
+
+	return repo.Remote(remoteName)
+}
+
+type Remote struct {
+	Name string
+	Url  string
+}
+
+func Remotes(directory string) []byte {
+	wg := sync.WaitGroup{}
+
+	repo, err := getRepo(directory, &wg)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	remotesConfigs, err := repo.Remotes()
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	wg.Wait()
+
+	remotes := []Remote{}
+	for _, r := range remotesConfigs {
+		remote := Remote{
+			Name: r.Config().Name,
+		}
+
+		if len(r.Config().URLs) > 0 {
+			remote.Url = r.Config().URLs[0]
+		}
+
+		remotes = append(remotes, remote)
+	}
+
+	sort.Slice(remotes, func(i, j int) bool {
+		return remotes[i].Name < remotes[j].Name
+	})
+
+	remotesSerialized := []byte{}
+
+	for _, r := range remotes {
+		remotesSerialized = append(remotesSerialized, serialize.SerializeString(r.Name)...)
+		remotesSerialized = append(remotesSerialized, serialize.SerializeString(r.Url)...)
+	}
+
+	return remotesSerialized
+}
+
+func RemoteAdd(directory string, name string, url string) []byte {
+	wg := sync.WaitGroup{}
+
+	repo, err := getRepo(directory, &wg)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	_, err = repo.CreateRemote(&gitConfig.RemoteConfig{
+		Name: name,
+		URLs: []string{url},
+	})
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+func RemoteRemove(directory string, name string) []byte {
+	wg := sync.WaitGroup{}
+
+	repo, err := getRepo(directory, &wg)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	err = repo.DeleteRemote(name)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	// clean up remote-tracking branches
+	remoteRefs, err := remoteTrackingRefs(repo, name)
+	if err == nil {
+		for _, r := range remoteRefs {
+			repo.Storer.RemoveReference(r.Name())
+		}
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+func RemoteSetURL(directory string, name string, url string) []byte {
+	wg := sync.WaitGroup{}
+
+	repo, err := getRepo(directory, &wg)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	cfg, err := repo.Config()
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	remoteConfig, ok := cfg.Remotes[name]
+
+	if !ok {
+		return serialize.SerializeString(errorFmt(git.ErrRemoteNotFound))
+	}
+
+	remoteConfig.URLs = []string{url}
+
+	err = repo.Storer.SetConfig(cfg)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+// mimics `git remote rename`
+// moves the config, the fetch refspecs, the tracked branches
+// and the remote-tracking refs
+func RemoteRename(directory string, oldName string, newName string) []byte {
+	wg := sync.WaitGroup{}
+
+	repo, err := getRepo(directory, &wg)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	cfg, err := repo.Config()
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	oldRemoteConfig, ok := cfg.Remotes[oldName]
+
+	if !ok {
+		return serialize.SerializeString(errorFmt(git.ErrRemoteNotFound))
+	}
+
+	if _, exists := cfg.Remotes[newName]; exists {
+		return serialize.SerializeString(errorFmt(git.ErrRemoteExists))
+	}
+
+	oldPrefix := "refs/remotes/" + oldName + "/"
+	newPrefix := "refs/remotes/" + newName + "/"
+
+	fetch := []gitConfig.RefSpec{}
+	for _, refSpec := range oldRemoteConfig.Fetch {
+		fetch = append(fetch, gitConfig.RefSpec(strings.ReplaceAll(refSpec.String(), oldPrefix, newPrefix)))
+	}
+
+	newRemoteConfig := &gitConfig.RemoteConfig{
+		Name:  newName,
+		URLs:  oldRemoteConfig.URLs,
+		Fetch: fetch,
+	}
+
+	err = newRemoteConfig.Validate()
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	delete(cfg.Remotes, oldName)
+	cfg.Remotes[newName] = newRemoteConfig
+
+	for _, b := range cfg.Branches {
+		if b.Remote == oldName {
+			b.Remote = newName
+		}
+	}
+
+	err = repo.Storer.SetConfig(cfg)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	remoteRefs, err := remoteTrackingRefs(repo, oldName)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	for _, r := range remoteRefs {
+		newRefName := plumbing.ReferenceName(newPrefix + strings.TrimPrefix(r.Name().String(), oldPrefix))
+
+		newRef := (*plumbing.Reference)(nil)
+		if r.Type() == plumbing.SymbolicReference {
+			target := plumbing.ReferenceName(strings.Replace(r.Target().String(), oldPrefix, newPrefix, 1))
+			newRef = plumbing.NewSymbolicReference(newRefName, target)
+		} else {
+			newRef = plumbing.NewHashReference(newRefName, r.Hash())
+		}
+
+		err = repo.Storer.SetReference(newRef)
+		if err != nil {
+			return serialize.SerializeString(errorFmt(err))
+		}
+
+		repo.Storer.RemoveReference(r.Name())
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+func remoteTrackingRefs(repo *git.Repository, remoteName string) ([]*plumbing.Reference, error) {
+	refs, err := repo.References()
+
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := "refs/remotes/" + remoteName + "/"
+
+	remoteRefs := []*plumbing.Reference{}
+	refs.ForEach(func(r *plumbing.Reference) error {
+		if strings.HasPrefix(r.Name().String(), prefix) {
+			remoteRefs = append(remoteRefs, r)
+		}
+		return nil
+	})
+
+	return remoteRefs, nil
+}
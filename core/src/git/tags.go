@@ -0,0 +1,202 @@
+package git
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	gitConfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	serialize "fullstackedorg/fullstacked/src/serialize"
+)
+
+type Tag struct {
+	Name      string
+	Hash      string
+	Annotated bool
+	Message   string
+}
+
+// annotated tags points to a tag object,
+// lightweight tags points directly to the commit
+func resolveTagCommit(repo *git.Repository, ref *plumbing.Reference) (plumbing.Hash, *object.Tag) {
+	tagObject, err := repo.TagObject(ref.Hash())
+
+	if err != nil {
+		return ref.Hash(), nil
+	}
+
+	commit, err := tagObject.Commit()
+
+	if err != nil {
+		return tagObject.Target, tagObject
+	}
+
+	return commit.Hash, tagObject
+}
+
+func getTags(repo *git.Repository) ([]Tag, error) {
+	refs, err := repo.Tags()
+
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []Tag{}
+
+	refs.ForEach(func(r *plumbing.Reference) error {
+		hash, tagObject := resolveTagCommit(repo, r)
+
+		tag := Tag{
+			Name:      r.Name().Short(),
+			Hash:      hash.String(),
+			Annotated: tagObject != nil,
+		}
+
+		if tagObject != nil {
+			tag.Message = tagObject.Message
+		}
+
+		tags = append(tags, tag)
+		return nil
+	})
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+
+	return tags, nil
+}
+
+func Tags(directory string) []byte {
+	wg := sync.WaitGroup{}
+
+	repo, err := getRepo(directory, &wg)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	tags, err := getTags(repo)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	wg.Wait()
+
+	tagsSerialized := []byte{}
+
+	for _, t := range tags {
+		tagsSerialized = append(tagsSerialized, serialize.SerializeString(t.Name)...)
+		tagsSerialized = append(tagsSerialized, serialize.SerializeString(t.Hash)...)
+		tagsSerialized = append(tagsSerialized, serialize.SerializeBoolean(t.Annotated)...)
+		tagsSerialized = append(tagsSerialized, serialize.SerializeString(t.Message)...)
+	}
+
+	return tagsSerialized
+}
+
+// empty message creates a lightweight tag,
+// empty ref tags the current HEAD
+func TagCreate(
+	directory string,
+	name string,
+	ref string,
+	message string,
+	authorName string,
+	authorEmail string,
+) []byte {
+	wg := sync.WaitGroup{}
+
+	repo, err := getRepo(directory, &wg)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	if ref == "" {
+		ref = plumbing.HEAD.String()
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	opts := (*git.CreateTagOptions)(nil)
+	if message != "" {
+		opts = &git.CreateTagOptions{
+			Message: message,
+			Tagger: &object.Signature{
+				Name:  authorName,
+				Email: authorEmail,
+				When:  time.Now(),
+			},
+		}
+	}
+
+	_, err = repo.CreateTag(name, *hash, opts)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+func TagDelete(directory string, name string) []byte {
+	wg := sync.WaitGroup{}
+
+	repo, err := getRepo(directory, &wg)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	err = repo.DeleteTag(name)
+
+	if err != nil {
+		return serialize.SerializeString(errorFmt(err))
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+// checkout tag in detached HEAD
+func checkoutTag(repo *git.Repository, worktree *git.Worktree, name string) error {
+	ref, err := repo.Tag(name)
+
+	if err != nil {
+		return err
+	}
+
+	hash, _ := resolveTagCommit(repo, ref)
+
+	return worktree.Checkout(&git.CheckoutOptions{
+		Hash: hash,
+	})
+}
+
+func tagsRefSpecs(tags []string, allTags bool) []gitConfig.RefSpec {
+	if allTags {
+		return []gitConfig.RefSpec{"refs/tags/*:refs/tags/*"}
+	}
+
+	refSpecs := []gitConfig.RefSpec{}
+
+	for _, t := range tags {
+		tagRefName := plumbing.NewTagReferenceName(t).String()
+		refSpecs = append(refSpecs, gitConfig.RefSpec(tagRefName+":"+tagRefName))
+	}
+
+	return refSpecs
+}
@@ -0,0 +1,158 @@
+package git
+
+import (
+	"slices"
+	"sync"
+
+	git "github.com/go-git/go-git/v5"
+	gitConfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// remote-tracking ref of a local branch,
+// from the branch config, else refs/remotes/origin/<branch>
+func upstreamRef(repo *git.Repository, branch string) (*plumbing.Reference, error) {
+	remoteName := git.DefaultRemoteName
+	merge := plumbing.NewBranchReferenceName(branch)
+
+	cfg, err := repo.Config()
+	if err == nil {
+		branchConfig, ok := cfg.Branches[branch]
+		if ok && branchConfig.Remote != "" {
+			remoteName = branchConfig.Remote
+			if branchConfig.Merge != "" {
+				merge = branchConfig.Merge
+			}
+		}
+	}
+
+	return repo.Reference(plumbing.NewRemoteReferenceName(remoteName, merge.Short()), true)
+}
+
+func setUpstream(repo *git.Repository, branch string, remoteName string) error {
+	cfg, err := repo.Config()
+
+	if err != nil {
+		return err
+	}
+
+	branchConfig, ok := cfg.Branches[branch]
+
+	if !ok {
+		branchConfig = &gitConfig.Branch{
+			Name: branch,
+		}
+		cfg.Branches[branch] = branchConfig
+	}
+
+	branchConfig.Remote = remoteName
+	branchConfig.Merge = plumbing.NewBranchReferenceName(branch)
+
+	return repo.Storer.SetConfig(cfg)
+}
+
+// every commit reachable from the heads,
+// without going into the stop commits
+func walkCommits(repo *git.Repository, heads []plumbing.Hash, stop func(plumbing.Hash) bool, onCommit func(*object.Commit)) error {
+	visited := map[plumbing.Hash]bool{}
+	pending := slices.Clone(heads)
+
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if visited[hash] || stop(hash) {
+			continue
+		}
+		visited[hash] = true
+
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			return err
+		}
+
+		onCommit(commit)
+		pending = append(pending, commit.ParentHashes...)
+	}
+
+	return nil
+}
+
+// Commits on local not on upstream,
+// and commits on upstream not on local.
+// Commit dates can be skewed, so the counts come
+// from the whole upstream history rather than
+// a walk by date stopping at the merge base
+func aheadBehind(repo *git.Repository, local plumbing.Hash, upstream plumbing.Hash) (int, int, error) {
+	if local == upstream {
+		return 0, 0, nil
+	}
+
+	upstreamCommits := map[plumbing.Hash]bool{}
+	err := walkCommits(repo, []plumbing.Hash{upstream}, func(plumbing.Hash) bool { return false }, func(commit *object.Commit) {
+		upstreamCommits[commit.Hash] = true
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// the upstream commits where the local walk stops
+	// lead to every commit both sides have
+	ahead := 0
+	common := []plumbing.Hash{}
+	err = walkCommits(repo, []plumbing.Hash{local}, func(hash plumbing.Hash) bool {
+		if upstreamCommits[hash] {
+			common = append(common, hash)
+			return true
+		}
+		return false
+	}, func(*object.Commit) {
+		ahead++
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	commonCount := 0
+	err = walkCommits(repo, common, func(plumbing.Hash) bool { return false }, func(*object.Commit) {
+		commonCount++
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return ahead, len(upstreamCommits) - commonCount, nil
+}
+
+// -1, -1 when the branch has no upstream
+// or the upstream commits are not fetched
+func branchAheadBehind(repo *git.Repository, branch string, hash plumbing.Hash) (int, int) {
+	upstream, err := upstreamRef(repo, branch)
+
+	if err != nil {
+		return -1, -1
+	}
+
+	ahead, behind, err := aheadBehind(repo, hash, upstream.Hash())
+
+	if err != nil {
+		return -1, -1
+	}
+
+	return ahead, behind
+}
+
+func AheadBehind(directory string, branch string, hash plumbing.Hash) (int, int) {
+	wg := sync.WaitGroup{}
+
+	repo, err := getRepo(directory, &wg)
+
+	if err != nil {
+		return -1, -1
+	}
+
+	wg.Wait()
+
+	return branchAheadBehind(repo, branch, hash)
+}
@@ -0,0 +1,226 @@
+package git
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+type history struct {
+	t       *testing.T
+	storage *memory.Storage
+	repo    *git.Repository
+	start   time.Time
+	count   int
+}
+
+func newHistory(t *testing.T) *history {
+	storage := memory.NewStorage()
+	repo, err := git.Init(storage, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &history{
+		t:       t,
+		storage: storage,
+		repo:    repo,
+		start:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// committed minutes after the start,
+// which can be before the parents
+func (h *history) commit(minutes int, parents ...plumbing.Hash) plumbing.Hash {
+	h.count++
+
+	signature := object.Signature{
+		Name:  "test",
+		Email: "test@test",
+		When:  h.start.Add(time.Duration(minutes) * time.Minute),
+	}
+	commit := &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      fmt.Sprint("commit ", h.count),
+		ParentHashes: parents,
+	}
+
+	encoded := h.storage.NewEncodedObject()
+	err := commit.Encode(encoded)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	hash, err := h.storage.SetEncodedObject(encoded)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	return hash
+}
+
+// every commit reachable from hash
+func (h *history) ancestors(hash plumbing.Hash) map[plumbing.Hash]bool {
+	reachable := map[plumbing.Hash]bool{}
+
+	var walk func(hash plumbing.Hash)
+	walk = func(hash plumbing.Hash) {
+		if reachable[hash] {
+			return
+		}
+		reachable[hash] = true
+
+		commit, err := h.repo.CommitObject(hash)
+		if err != nil {
+			h.t.Fatal(err)
+		}
+		for _, parent := range commit.ParentHashes {
+			walk(parent)
+		}
+	}
+	walk(hash)
+
+	return reachable
+}
+
+// counted from the whole histories
+func (h *history) expected(local plumbing.Hash, upstream plumbing.Hash) (int, int) {
+	localAncestors := h.ancestors(local)
+	upstreamAncestors := h.ancestors(upstream)
+
+	ahead := 0
+	for hash := range localAncestors {
+		if !upstreamAncestors[hash] {
+			ahead++
+		}
+	}
+
+	behind := 0
+	for hash := range upstreamAncestors {
+		if !localAncestors[hash] {
+			behind++
+		}
+	}
+
+	return ahead, behind
+}
+
+func (h *history) check(name string, local plumbing.Hash, upstream plumbing.Hash, ahead int, behind int) {
+	h.t.Helper()
+
+	gotAhead, gotBehind, err := aheadBehind(h.repo, local, upstream)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	if gotAhead != ahead || gotBehind != behind {
+		h.t.Errorf("%s: got %d ahead %d behind, expected %d ahead %d behind", name, gotAhead, gotBehind, ahead, behind)
+	}
+}
+
+func TestAheadBehind(t *testing.T) {
+	h := newHistory(t)
+
+	root := h.commit(0)
+	base := h.commit(1, root)
+
+	// fast-forward
+	upstream1 := h.commit(2, base)
+	upstream2 := h.commit(3, upstream1)
+	h.check("same commit", base, base, 0, 0)
+	h.check("behind", base, upstream2, 0, 2)
+	h.check("ahead", upstream2, base, 2, 0)
+
+	// diverged
+	local1 := h.commit(4, base)
+	local2 := h.commit(5, local1)
+	local3 := h.commit(6, local2)
+	h.check("diverged", local3, upstream2, 3, 2)
+
+	// upstream merged into local
+	merge := h.commit(7, local3, upstream2)
+	h.check("merged", merge, upstream2, 4, 0)
+
+	// then upstream moves on
+	upstream3 := h.commit(8, upstream2)
+	h.check("merged then diverged", merge, upstream3, 4, 1)
+
+	// the upstream merges local back
+	upstreamMerge := h.commit(9, upstream3, merge)
+	h.check("merged back", merge, upstreamMerge, 0, 2)
+
+	// criss-cross, two merge bases
+	left := h.commit(10, local3, upstream2)
+	right := h.commit(10, upstream2, local3)
+	h.check("criss-cross", left, right, 1, 1)
+
+	// unrelated histories
+	other := h.commit(11)
+	h.check("unrelated", other, base, 1, 2)
+}
+
+func TestAheadBehindClockSkew(t *testing.T) {
+	h := newHistory(t)
+
+	root := h.commit(100)
+	base := h.commit(100, root)
+
+	// local commits dated before the merge base
+	local1 := h.commit(10, base)
+	local2 := h.commit(20, local1)
+	upstream1 := h.commit(200, base)
+	upstream2 := h.commit(50, upstream1)
+
+	h.check("skewed", local2, upstream2, 2, 2)
+
+	// a long side reaching the base before the other
+	long := base
+	for i := range 20 {
+		long = h.commit(300+i, long)
+	}
+	short := h.commit(0, base)
+	h.check("long and short", long, short, 20, 1)
+	h.check("short and long", short, long, 1, 20)
+}
+
+func TestAheadBehindRandomHistories(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	for i := range 500 {
+		h := newHistory(t)
+
+		commits := []plumbing.Hash{h.commit(0)}
+		for range 60 {
+			parents := []plumbing.Hash{commits[random.Intn(len(commits))]}
+			if random.Intn(4) == 0 {
+				parents = append(parents, commits[random.Intn(len(commits))])
+				if parents[0] == parents[1] {
+					parents = parents[:1]
+				}
+			}
+
+			// mostly in order, sometimes skewed
+			minutes := len(commits)
+			if random.Intn(5) == 0 {
+				minutes = random.Intn(len(commits) + 1)
+			}
+
+			commits = append(commits, h.commit(minutes, parents...))
+		}
+
+		for range 10 {
+			local := commits[random.Intn(len(commits))]
+			upstream := commits[random.Intn(len(commits))]
+
+			ahead, behind := h.expected(local, upstream)
+			h.check(fmt.Sprintf("history %d", i), local, upstream, ahead, behind)
+		}
+	}
+}
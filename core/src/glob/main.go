@@ -0,0 +1,78 @@
+package glob
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// Patterns with .gitignore semantics,
+// shared by the fs skip lists, archives, the build and git
+//
+//	node_modules   no slash, matches a name at any depth
+//	/.build        leading slash, anchored to the root
+//	data/          trailing slash, directories only
+//	src/**/test    ** matches any number of directories
+//	!keep.map      negates a previous match
+//
+// A matching directory matches everything under it.
+// Blank lines and # comments are ignored.
+
+func Parse(lines []string, domain []string) []gitignore.Pattern {
+	patterns := []gitignore.Pattern{}
+
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, domain))
+	}
+
+	return patterns
+}
+
+type Matcher struct {
+	matcher gitignore.Matcher
+}
+
+// nil for an empty list, a nil Matcher matches nothing
+func New(patterns []string) *Matcher {
+	parsed := Parse(patterns, nil)
+
+	if len(parsed) == 0 {
+		return nil
+	}
+
+	return &Matcher{
+		matcher: gitignore.NewMatcher(parsed),
+	}
+}
+
+func Split(name string) []string {
+	name = strings.Trim(filepath.ToSlash(name), "/")
+	if name == "" || name == "." {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// name is relative to where the patterns apply,
+// the last matching pattern wins
+func (m *Matcher) Match(name string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+
+	components := Split(name)
+	if len(components) == 0 {
+		return false
+	}
+
+	return m.matcher.Match(components, isDir)
+}
+
+func Match(patterns []string, name string, isDir bool) bool {
+	return New(patterns).Match(name, isDir)
+}
@@ -0,0 +1,84 @@
+package glob
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		name     string
+		isDir    bool
+		expected bool
+	}{
+		// no slash, any depth
+		{[]string{"node_modules"}, "node_modules", true, true},
+		{[]string{"node_modules"}, "a/b/node_modules", true, true},
+		{[]string{"node_modules"}, "node_modules/react/index.js", false, true},
+		{[]string{"node_modules"}, "node_modules_old", true, false},
+		{[]string{"*.map"}, "dist/index.js.map", false, true},
+
+		// leading slash, anchored to the root
+		{[]string{"/.build"}, ".build", true, true},
+		{[]string{"/.build"}, ".build/index.js", false, true},
+		{[]string{"/.build"}, "src/.build", true, false},
+		{[]string{"/data"}, "database", true, false},
+		{[]string{"src/lib"}, "src/lib/a.ts", false, true},
+		{[]string{"src/lib"}, "a/src/lib", true, false},
+
+		// **
+		{[]string{"src/**/test"}, "src/test", true, true},
+		{[]string{"src/**/test"}, "src/a/b/test", true, true},
+		{[]string{"src/**/test"}, "lib/a/test", true, false},
+		{[]string{"**/test"}, "a/b/test", true, true},
+		{[]string{"src/**"}, "src/a/b.ts", false, true},
+
+		// trailing slash, directories only
+		{[]string{"data/"}, "data", true, true},
+		{[]string{"data/"}, "data", false, false},
+		{[]string{"data/"}, "a/data", true, true},
+		{[]string{"data/"}, "data/file", false, true},
+
+		// the last matching pattern wins
+		{[]string{"*.map", "!keep.map"}, "keep.map", false, false},
+		{[]string{"*.map", "!keep.map"}, "other.map", false, true},
+		{[]string{"!keep.map", "*.map"}, "keep.map", false, true},
+		{[]string{"/dist/*", "!/dist/public"}, "dist/public", true, false},
+		{[]string{"/dist/*", "!/dist/public"}, "dist/private", true, true},
+
+		// comments and blank lines
+		{[]string{"# data", "", "  "}, "data", true, false},
+		{[]string{"\\#data"}, "#data", false, true},
+
+		{nil, "anything", false, false},
+		{[]string{"*"}, "", true, false},
+	}
+
+	for _, test := range tests {
+		got := Match(test.patterns, test.name, test.isDir)
+		if got != test.expected {
+			t.Errorf("%q on %q (dir %v): got %v, expected %v", test.patterns, test.name, test.isDir, got, test.expected)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected []string
+	}{
+		{"", nil},
+		{".", nil},
+		{"/", nil},
+		{"a", []string{"a"}},
+		{"/a/b/", []string{"a", "b"}},
+	}
+
+	for _, test := range tests {
+		got := Split(test.name)
+		if !slices.Equal(got, test.expected) {
+			t.Errorf("%q: got %q, expected %q", test.name, got, test.expected)
+		}
+	}
+}
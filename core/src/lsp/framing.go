@@ -0,0 +1,169 @@
+package ts_lsp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// Base protocol framing,
+// https://microsoft.github.io/language-server-protocol/specifications/base/0.9/specification/
+//
+//	Content-Length: <bytes>\r\n
+//	(other headers)\r\n
+//	\r\n
+//	<content>
+
+var startToken = "Content-Length: "
+var headerSplit = "\r\n\r\n"
+
+const contentLengthHeader = "content-length"
+
+// headers and messages above
+// these sizes are malformed
+var maxHeaderLength = 1024
+var maxMessageLength = 64 * 1024 * 1024
+
+var errMalformedFrame = errors.New("malformed frame")
+
+type messageReader struct {
+	reader *bufio.Reader
+}
+
+func newMessageReader(r io.Reader) *messageReader {
+	return &messageReader{
+		reader: bufio.NewReaderSize(r, 64*1024),
+	}
+}
+
+// one header line without its line ending,
+// valid until the next read.
+// Lines longer than maxHeaderLength are malformed
+func (m *messageReader) readHeaderLine() ([]byte, error) {
+	chunk, err := m.reader.ReadSlice('\n')
+
+	// the whole line is buffered
+	if err == nil && len(chunk) <= maxHeaderLength {
+		return trimLineEnding(chunk), nil
+	}
+
+	line := append([]byte{}, chunk...)
+	for err == bufio.ErrBufferFull && len(line) <= maxHeaderLength {
+		chunk, err = m.reader.ReadSlice('\n')
+		line = append(line, chunk...)
+	}
+
+	if len(line) > maxHeaderLength {
+		// drop the rest of the line
+		for err == bufio.ErrBufferFull {
+			_, err = m.reader.ReadSlice('\n')
+		}
+		if err != nil {
+			return nil, err
+		}
+		return nil, errMalformedFrame
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return trimLineEnding(line), nil
+}
+
+func trimLineEnding(line []byte) []byte {
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	return bytes.TrimSuffix(line, []byte{'\r'})
+}
+
+// reads headers up to the empty line,
+// returns the content length
+func (m *messageReader) readHeaders() (int, error) {
+	contentLength := -1
+	malformed := false
+
+	for {
+		line, err := m.readHeaderLine()
+
+		if err == errMalformedFrame {
+			malformed = true
+			continue
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		if len(line) == 0 {
+			// leading blank lines between frames
+			if contentLength == -1 && !malformed {
+				continue
+			}
+			break
+		}
+
+		name, value, ok := bytes.Cut(line, []byte{':'})
+		if !ok {
+			malformed = true
+			continue
+		}
+
+		name = bytes.TrimSpace(name)
+
+		// case-insensitive, with maybe
+		// garbage before the start of a frame
+		if len(name) < len(contentLengthHeader) ||
+			!bytes.EqualFold(name[len(name)-len(contentLengthHeader):], []byte(contentLengthHeader)) {
+			continue
+		}
+
+		length, err := strconv.Atoi(string(bytes.TrimSpace(value)))
+		if err != nil || length < 0 || length > maxMessageLength {
+			malformed = true
+			continue
+		}
+
+		// a valid Content-Length starts a new frame
+		contentLength = length
+		malformed = false
+	}
+
+	if malformed || contentLength == -1 {
+		return 0, errMalformedFrame
+	}
+
+	return contentLength, nil
+}
+
+// next message content,
+// errMalformedFrame if the headers of a frame are invalid,
+// the reader can be used again after it
+func (m *messageReader) next() (string, error) {
+	contentLength, err := m.readHeaders()
+
+	if err != nil {
+		return "", err
+	}
+
+	// copied once, straight from the buffer
+	if contentLength <= m.reader.Size() {
+		content, err := m.reader.Peek(contentLength)
+		if err != nil {
+			return "", err
+		}
+		message := string(content)
+		m.reader.Discard(contentLength)
+		return message, nil
+	}
+
+	message := make([]byte, contentLength)
+	_, err = io.ReadFull(m.reader, message)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(message), nil
+}
@@ -0,0 +1,191 @@
+package ts_lsp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// processBuffer from before messageReader,
+// kept to compare both in the benchmarks
+
+var legacyStartTokenBin = []byte(startToken)
+var legacyHeaderSplitBin = []byte(headerSplit)
+
+func legacyFindOccurence(buffer []byte, matching []byte, num int) int {
+	count := 0
+	for i := range buffer {
+		fullMatch := true
+		for j, m := range matching {
+			if i+j > len(buffer)-1 || m != buffer[i+j] {
+				fullMatch = false
+				break
+			}
+		}
+		if fullMatch {
+			count += 1
+		}
+		if count == num {
+			return i
+		}
+	}
+
+	return -1
+}
+
+type legacyBufferSlice struct {
+	From int
+	To   int
+}
+
+func legacyProcessBuffer(buffer []byte) (*legacyBufferSlice, error) {
+	if len(buffer) < len(legacyStartTokenBin) {
+		return nil, nil
+	}
+
+	if !slices.Equal(buffer[0:len(legacyStartTokenBin)], legacyStartTokenBin) {
+		return nil, errors.New("buffer does not contain start token")
+	}
+
+	posHeaderSplit := legacyFindOccurence(buffer, legacyHeaderSplitBin, 1)
+
+	numStr := buffer[len(legacyStartTokenBin):posHeaderSplit]
+	expectedLength, err := strconv.Atoi(string(numStr))
+
+	if err != nil {
+		return nil, err
+	}
+
+	posStartMessage := posHeaderSplit + len(headerSplit)
+
+	messageBuffer := buffer[posStartMessage:]
+
+	if len(messageBuffer) < expectedLength {
+		return nil, nil
+	}
+
+	return &legacyBufferSlice{
+		From: posStartMessage,
+		To:   posStartMessage + expectedLength,
+	}, nil
+}
+
+// Reads 1KB at a time like the session loop did.
+// Unlike that loop, it takes every complete message of
+// a read, the loop left the rest until more output came,
+// and it waits for the whole header, legacyProcessBuffer
+// panics on a header split across reads
+func legacyReadAll(r io.Reader, onMessage func(string)) {
+	buffer := []byte{}
+
+	for {
+		b := make([]byte, 1024)
+		n, err := r.Read(b)
+
+		if n > 0 {
+			buffer = append(buffer, b[0:n]...)
+			for bytes.Contains(buffer, legacyHeaderSplitBin) {
+				bSlice, err := legacyProcessBuffer(buffer)
+				if err != nil || bSlice == nil {
+					break
+				}
+				onMessage(string(buffer[bSlice.From:bSlice.To]))
+				buffer = buffer[bSlice.To:]
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func readAll(r io.Reader, onMessage func(string)) {
+	reader := newMessageReader(r)
+
+	for {
+		message, err := reader.next()
+
+		if err == errMalformedFrame {
+			continue
+		}
+
+		if err != nil {
+			return
+		}
+
+		onMessage(message)
+	}
+}
+
+func frames(count int, size int) []byte {
+	message := `{"jsonrpc":"2.0","method":"m","params":"` + strings.Repeat("a", size) + `"}`
+	frame := startToken + strconv.Itoa(len(message)) + headerSplit + message
+	return []byte(strings.Repeat(frame, count))
+}
+
+func TestReadersAgree(t *testing.T) {
+	data := frames(20, 5000)
+
+	legacy := []string{}
+	legacyReadAll(bytes.NewReader(data), func(m string) {
+		legacy = append(legacy, m)
+	})
+
+	messages := []string{}
+	readAll(bytes.NewReader(data), func(m string) {
+		messages = append(messages, m)
+	})
+
+	if len(messages) != 20 || len(legacy) != 20 {
+		t.Fatalf("expected 20 messages, got %d and %d", len(messages), len(legacy))
+	}
+
+	if !slices.Equal(messages, legacy) {
+		t.Fatal("messages differ")
+	}
+}
+
+func TestReaderSkipsMalformedFrames(t *testing.T) {
+	data := "garbage\r\n" +
+		"Content-Length: nope\r\n\r\n" +
+		"Content-Type: application/json\r\nContent-Length: 2\r\n\r\n{}" +
+		"\r\ncontent-length: 4\r\n\r\nnull"
+
+	messages := []string{}
+	readAll(strings.NewReader(data), func(m string) {
+		messages = append(messages, m)
+	})
+
+	if !slices.Equal(messages, []string{"{}", "null"}) {
+		t.Fatalf("unexpected %q", messages)
+	}
+}
+
+func benchmarkReaders(b *testing.B, data []byte) {
+	b.Run("legacy", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for b.Loop() {
+			legacyReadAll(bytes.NewReader(data), func(string) {})
+		}
+	})
+
+	b.Run("messageReader", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for b.Loop() {
+			readAll(bytes.NewReader(data), func(string) {})
+		}
+	})
+}
+
+func BenchmarkReadLargeMessage(b *testing.B) {
+	benchmarkReaders(b, frames(1, 1024*1024))
+}
+
+func BenchmarkReadSmallMessages(b *testing.B) {
+	benchmarkReaders(b, frames(1000, 200))
+}
@@ -31,7 +31,7 @@ func (w *WasmFS) FileExists(path string) bool {
 
 // GetAccessibleEntries implements vfs.FS.
 func (w *WasmFS) GetAccessibleEntries(path string) tsgo.FsEntries {
-	items, _ := fs.ReadDir(path, true, false, []string{})
+	items, _ := fs.ReadDir(path, true, false, nil, nil)
 	entries := tsgo.FsEntries{
 		Files:       []string{},
 		Directories: []string{},
@@ -0,0 +1,447 @@
+package jsonls
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Tolerant JSON parser keeping byte offsets,
+// an incomplete document still yields the nodes
+// parsed up to the first error
+
+type NodeType int
+
+const (
+	ObjectNode NodeType = iota
+	ArrayNode
+	StringNode
+	NumberNode
+	BooleanNode
+	NullNode
+)
+
+var nodeTypeNames = []string{"object", "array", "string", "number", "boolean", "null"}
+
+func (t NodeType) String() string {
+	return nodeTypeNames[t]
+}
+
+type Property struct {
+	Key       string
+	KeyStart  int
+	KeyEnd    int
+	KeyClosed bool
+	// -1 until the colon is parsed
+	Colon int
+	// nil until the value is parsed
+	Value *Node
+}
+
+type Node struct {
+	Type  NodeType
+	Start int
+	// end offset, exclusive,
+	// Closed is false for unterminated objects and arrays
+	End    int
+	Closed bool
+
+	// string, float64 or bool for scalars
+	Value any
+
+	Properties []*Property
+	Items      []*Node
+}
+
+type SyntaxError struct {
+	Start   int
+	End     int
+	Message string
+}
+
+type parser struct {
+	text   string
+	offset int
+	err    *SyntaxError
+	// comments and trailing commas, like tsconfig.json
+	jsonc bool
+}
+
+func Parse(text string, jsonc bool) (*Node, *SyntaxError) {
+	p := &parser{
+		text:  text,
+		jsonc: jsonc,
+	}
+
+	p.skipWhitespace()
+
+	if p.offset == len(p.text) {
+		return nil, nil
+	}
+
+	root := p.parseValue()
+
+	if p.err == nil {
+		p.skipWhitespace()
+		if p.offset < len(p.text) {
+			p.fail(p.offset, len(p.text), "end of file expected")
+		}
+	}
+
+	return root, p.err
+}
+
+func (p *parser) fail(start int, end int, message string) {
+	if p.err != nil {
+		return
+	}
+
+	p.err = &SyntaxError{
+		Start:   start,
+		End:     max(end, start+1),
+		Message: message,
+	}
+}
+
+func (p *parser) skipWhitespace() {
+	for p.offset < len(p.text) {
+		switch p.text[p.offset] {
+		case ' ', '\t', '\n', '\r':
+			p.offset++
+		case '/':
+			if !p.jsonc || !p.skipComment() {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) skipComment() bool {
+	rest := p.text[p.offset:]
+
+	switch {
+	case strings.HasPrefix(rest, "//"):
+		end := strings.IndexByte(rest, '\n')
+		if end == -1 {
+			end = len(rest)
+		}
+		p.offset += end
+	case strings.HasPrefix(rest, "/*"):
+		end := strings.Index(rest[2:], "*/")
+		if end == -1 {
+			p.fail(p.offset, len(p.text), "unterminated comment")
+			p.offset = len(p.text)
+			return true
+		}
+		p.offset += end + 4
+	default:
+		return false
+	}
+
+	return true
+}
+
+func (p *parser) parseValue() *Node {
+	if p.offset >= len(p.text) {
+		p.fail(p.offset, p.offset, "value expected")
+		return nil
+	}
+
+	switch c := p.text[p.offset]; {
+	case c == '{':
+		return p.parseObject()
+	case c == '[':
+		return p.parseArray()
+	case c == '"':
+		start := p.offset
+		value, ok := p.parseString()
+		node := &Node{
+			Type:   StringNode,
+			Start:  start,
+			End:    p.offset,
+			Closed: ok,
+			Value:  value,
+		}
+		return node
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	default:
+		return p.parseLiteral()
+	}
+}
+
+func (p *parser) parseObject() *Node {
+	node := &Node{
+		Type:       ObjectNode,
+		Start:      p.offset,
+		Properties: []*Property{},
+	}
+
+	// {
+	p.offset++
+
+	for {
+		p.skipWhitespace()
+
+		if p.offset >= len(p.text) {
+			p.fail(node.Start, node.Start+1, "unterminated object")
+			node.End = p.offset
+			return node
+		}
+
+		if p.text[p.offset] == '}' {
+			p.offset++
+			node.End = p.offset
+			node.Closed = true
+			return node
+		}
+
+		if len(node.Properties) > 0 {
+			if p.text[p.offset] != ',' {
+				p.fail(p.offset, p.offset+1, "comma expected")
+				node.End = len(p.text)
+				return node
+			}
+			p.offset++
+			p.skipWhitespace()
+
+			if p.offset < len(p.text) && p.text[p.offset] == '}' {
+				if p.jsonc {
+					continue
+				}
+				p.fail(p.offset-1, p.offset, "trailing comma")
+				node.End = len(p.text)
+				return node
+			}
+		}
+
+		if p.offset >= len(p.text) || p.text[p.offset] != '"' {
+			p.fail(p.offset, p.offset+1, "property name expected")
+			node.End = len(p.text)
+			return node
+		}
+
+		property := &Property{
+			KeyStart: p.offset,
+			Colon:    -1,
+		}
+		node.Properties = append(node.Properties, property)
+
+		key, ok := p.parseString()
+		property.Key = key
+		property.KeyEnd = p.offset
+		property.KeyClosed = ok
+
+		if !ok {
+			node.End = len(p.text)
+			return node
+		}
+
+		p.skipWhitespace()
+
+		if p.offset >= len(p.text) || p.text[p.offset] != ':' {
+			p.fail(p.offset, p.offset+1, "colon expected")
+			node.End = len(p.text)
+			return node
+		}
+
+		property.Colon = p.offset
+		p.offset++
+		p.skipWhitespace()
+
+		property.Value = p.parseValue()
+
+		if p.err != nil {
+			node.End = len(p.text)
+			return node
+		}
+	}
+}
+
+func (p *parser) parseArray() *Node {
+	node := &Node{
+		Type:  ArrayNode,
+		Start: p.offset,
+		Items: []*Node{},
+	}
+
+	// [
+	p.offset++
+
+	for {
+		p.skipWhitespace()
+
+		if p.offset >= len(p.text) {
+			p.fail(node.Start, node.Start+1, "unterminated array")
+			node.End = p.offset
+			return node
+		}
+
+		if p.text[p.offset] == ']' {
+			p.offset++
+			node.End = p.offset
+			node.Closed = true
+			return node
+		}
+
+		if len(node.Items) > 0 {
+			if p.text[p.offset] != ',' {
+				p.fail(p.offset, p.offset+1, "comma expected")
+				node.End = len(p.text)
+				return node
+			}
+			p.offset++
+			p.skipWhitespace()
+
+			if p.offset < len(p.text) && p.text[p.offset] == ']' {
+				if p.jsonc {
+					continue
+				}
+				p.fail(p.offset-1, p.offset, "trailing comma")
+				node.End = len(p.text)
+				return node
+			}
+		}
+
+		item := p.parseValue()
+		if item != nil {
+			node.Items = append(node.Items, item)
+		}
+
+		if p.err != nil {
+			node.End = len(p.text)
+			return node
+		}
+	}
+}
+
+// the offset is past the closing quote,
+// or at the end of the line for unterminated strings
+func (p *parser) parseString() (string, bool) {
+	start := p.offset
+	// "
+	p.offset++
+
+	value := strings.Builder{}
+
+	for p.offset < len(p.text) {
+		c := p.text[p.offset]
+
+		switch {
+		case c == '"':
+			p.offset++
+			return value.String(), true
+		case c == '\n' || c == '\r':
+			p.fail(start, p.offset, "unterminated string")
+			return value.String(), false
+		case c == '\\':
+			if p.offset+1 >= len(p.text) {
+				p.offset++
+				continue
+			}
+
+			escape := p.text[p.offset+1]
+			p.offset += 2
+
+			switch escape {
+			case '"', '\\', '/':
+				value.WriteByte(escape)
+			case 'b':
+				value.WriteByte('\b')
+			case 'f':
+				value.WriteByte('\f')
+			case 'n':
+				value.WriteByte('\n')
+			case 'r':
+				value.WriteByte('\r')
+			case 't':
+				value.WriteByte('\t')
+			case 'u':
+				if p.offset+4 > len(p.text) {
+					p.fail(p.offset-2, p.offset, "invalid unicode escape")
+					return value.String(), false
+				}
+				code, err := strconv.ParseUint(p.text[p.offset:p.offset+4], 16, 32)
+				if err != nil {
+					p.fail(p.offset-2, p.offset+4, "invalid unicode escape")
+					return value.String(), false
+				}
+				value.WriteRune(rune(code))
+				p.offset += 4
+			default:
+				p.fail(p.offset-2, p.offset, "invalid escape character")
+				return value.String(), false
+			}
+		default:
+			r, size := utf8.DecodeRuneInString(p.text[p.offset:])
+			value.WriteRune(r)
+			p.offset += size
+		}
+	}
+
+	p.fail(start, p.offset, "unterminated string")
+	return value.String(), false
+}
+
+func (p *parser) parseNumber() *Node {
+	start := p.offset
+
+	for p.offset < len(p.text) {
+		c := p.text[p.offset]
+		if (c >= '0' && c <= '9') || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E' {
+			p.offset++
+			continue
+		}
+		break
+	}
+
+	value, err := strconv.ParseFloat(p.text[start:p.offset], 64)
+	if err != nil {
+		p.fail(start, p.offset, "invalid number")
+	}
+
+	return &Node{
+		Type:   NumberNode,
+		Start:  start,
+		End:    p.offset,
+		Closed: true,
+		Value:  value,
+	}
+}
+
+func (p *parser) parseLiteral() *Node {
+	start := p.offset
+
+	for p.offset < len(p.text) {
+		c := p.text[p.offset]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+			p.offset++
+			continue
+		}
+		break
+	}
+
+	node := &Node{
+		Start:  start,
+		End:    p.offset,
+		Closed: true,
+	}
+
+	switch p.text[start:p.offset] {
+	case "true":
+		node.Type = BooleanNode
+		node.Value = true
+	case "false":
+		node.Type = BooleanNode
+		node.Value = false
+	case "null":
+		node.Type = NullNode
+	default:
+		p.fail(start, p.offset, "value expected")
+		return nil
+	}
+
+	return node
+}
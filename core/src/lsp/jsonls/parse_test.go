@@ -0,0 +1,136 @@
+package jsonls
+
+import (
+	"testing"
+)
+
+func TestParseValues(t *testing.T) {
+	text := `{"s": "a\"\\\/\né😀", "n": -1.5e2, "b": [true, false, null], "o": {}}`
+
+	root, err := Parse(text, false)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+
+	if root.Type != ObjectNode || !root.Closed || root.Start != 0 || root.End != len(text) {
+		t.Fatalf("unexpected root %+v", root)
+	}
+
+	if len(root.Properties) != 4 {
+		t.Fatalf("expected 4 properties, got %d", len(root.Properties))
+	}
+
+	s := root.Properties[0]
+	if s.Key != "s" || !s.KeyClosed || s.KeyStart != 1 || s.KeyEnd != 4 || s.Colon != 4 {
+		t.Fatalf("unexpected key %+v", s)
+	}
+	if s.Value.Value != "a\"\\/\né😀" {
+		t.Fatalf("unexpected string %q", s.Value.Value)
+	}
+
+	if n := root.Properties[1].Value; n.Type != NumberNode || n.Value != -150.0 {
+		t.Fatalf("unexpected number %+v", n)
+	}
+
+	array := root.Properties[2].Value
+	if array.Type != ArrayNode || len(array.Items) != 3 {
+		t.Fatalf("unexpected array %+v", array)
+	}
+	if array.Items[0].Value != true || array.Items[1].Value != false || array.Items[2].Type != NullNode {
+		t.Fatalf("unexpected items %+v %+v %+v", array.Items[0], array.Items[1], array.Items[2])
+	}
+
+	if o := root.Properties[3].Value; o.Type != ObjectNode || !o.Closed || len(o.Properties) != 0 {
+		t.Fatalf("unexpected object %+v", o)
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	root, err := Parse(" \n\t", false)
+	if root != nil || err != nil {
+		t.Fatalf("expected nothing, got %+v %+v", root, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		text    string
+		jsonc   bool
+		message string
+		start   int
+	}{
+		{`{"a": 1,}`, false, "trailing comma", 7},
+		{`[1, 2,]`, false, "trailing comma", 5},
+		{`{"a": 1 "b": 2}`, false, "comma expected", 8},
+		{`{"a" 1}`, false, "colon expected", 5},
+		{`{a: 1}`, false, "property name expected", 1},
+		{`{"a": "b`, false, "unterminated string", 6},
+		{"[\"a\n\"]", false, "unterminated string", 1},
+		{`{"a": 1`, false, "unterminated object", 0},
+		{`[1`, false, "unterminated array", 0},
+		{`{"a": tru}`, false, "value expected", 6},
+		{`{"a": 1.2.3}`, false, "invalid number", 6},
+		{`{"a": "\x"}`, false, "invalid escape character", 7},
+		{`{"a": "\u12"}`, false, "invalid unicode escape", 7},
+		{`{} {}`, false, "end of file expected", 3},
+		{`// comment` + "\n{}", false, "value expected", 0},
+		{`{} /* open`, true, "unterminated comment", 3},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.text, test.jsonc)
+
+		if err == nil {
+			t.Errorf("%s: expected %q", test.text, test.message)
+			continue
+		}
+
+		if err.Message != test.message || err.Start != test.start || err.End <= err.Start {
+			t.Errorf("%s: got %q at %d-%d, expected %q at %d", test.text, err.Message, err.Start, err.End, test.message, test.start)
+		}
+	}
+}
+
+func TestParseJSONC(t *testing.T) {
+	text := `{
+		// line comment
+		"a": [1, 2,], /* block */
+		"b": {"c": true,},
+	}`
+
+	root, err := Parse(text, true)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+
+	if len(root.Properties) != 2 || len(root.Properties[0].Value.Items) != 2 {
+		t.Fatalf("unexpected %+v", root)
+	}
+}
+
+func TestParseIncomplete(t *testing.T) {
+	// typing a new key
+	text := `{"a": [1, 2], "b`
+
+	root, err := Parse(text, false)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if root == nil || root.Closed || root.End != len(text) {
+		t.Fatalf("unexpected root %+v", root)
+	}
+
+	if len(root.Properties) != 2 {
+		t.Fatalf("expected 2 properties, got %d", len(root.Properties))
+	}
+
+	if items := root.Properties[0].Value.Items; len(items) != 2 {
+		t.Fatalf("the complete value is lost, got %+v", items)
+	}
+
+	b := root.Properties[1]
+	if b.Key != "b" || b.KeyClosed || b.Colon != -1 || b.Value != nil {
+		t.Fatalf("unexpected key %+v", b)
+	}
+}
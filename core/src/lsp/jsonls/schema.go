@@ -0,0 +1,292 @@
+package jsonls
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Subset of JSON Schema:
+// type, properties, additionalProperties, items,
+// required, enum, pattern, description and examples
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+type Schema struct {
+	// string or list of strings
+	Type        any                `json:"type"`
+	Description string             `json:"description"`
+	Properties  map[string]*Schema `json:"properties"`
+	// false, true or a schema
+	AdditionalProperties json.RawMessage `json:"additionalProperties"`
+	Items                *Schema         `json:"items"`
+	Required             []string        `json:"required"`
+	Enum                 []any           `json:"enum"`
+	Pattern              string          `json:"pattern"`
+	// suggested in completions, not validated
+	Examples []any `json:"examples"`
+
+	types      []string
+	additional *Schema
+	closed     bool
+	pattern    *regexp.Regexp
+}
+
+func (s *Schema) prepare() error {
+	switch t := s.Type.(type) {
+	case string:
+		s.types = []string{t}
+	case []any:
+		for _, item := range t {
+			if str, ok := item.(string); ok {
+				s.types = append(s.types, str)
+			}
+		}
+	}
+
+	if len(s.AdditionalProperties) > 0 {
+		switch strings.TrimSpace(string(s.AdditionalProperties)) {
+		case "false":
+			s.closed = true
+		case "true":
+		default:
+			s.additional = &Schema{}
+			err := json.Unmarshal(s.AdditionalProperties, s.additional)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = pattern
+	}
+
+	children := []*Schema{s.Items, s.additional}
+	for _, property := range s.Properties {
+		children = append(children, property)
+	}
+
+	for _, child := range children {
+		if child == nil {
+			continue
+		}
+		err := child.prepare()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var schemasMutex = sync.Mutex{}
+var schemas = map[string]*Schema{}
+
+func loadSchema(name string) *Schema {
+	schemasMutex.Lock()
+	defer schemasMutex.Unlock()
+
+	if schema, ok := schemas[name]; ok {
+		return schema
+	}
+
+	data, err := schemaFiles.ReadFile("schemas/" + name)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+
+	schema := &Schema{}
+	err = json.Unmarshal(data, schema)
+	if err == nil {
+		err = schema.prepare()
+	}
+
+	if err != nil {
+		fmt.Println("invalid schema", name, err)
+		schema = nil
+	}
+
+	schemas[name] = schema
+	return schema
+}
+
+// schema of a property, nil if unknown
+func (s *Schema) property(key string) *Schema {
+	if s == nil {
+		return nil
+	}
+
+	if property, ok := s.Properties[key]; ok {
+		return property
+	}
+
+	return s.additional
+}
+
+func (s *Schema) allows(t string) bool {
+	if len(s.types) == 0 {
+		return true
+	}
+
+	for _, allowed := range s.types {
+		if allowed == t || (allowed == "number" && t == "integer") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func nodeJSONType(node *Node) string {
+	if node.Type == NumberNode {
+		value := node.Value.(float64)
+		if value == float64(int64(value)) {
+			return "integer"
+		}
+	}
+
+	return node.Type.String()
+}
+
+type problem struct {
+	Start    int
+	End      int
+	Message  string
+	Severity int
+}
+
+const (
+	severityError   = 1
+	severityWarning = 2
+)
+
+func (s *Schema) validate(node *Node, problems []problem) []problem {
+	if s == nil || node == nil {
+		return problems
+	}
+
+	t := nodeJSONType(node)
+	if !s.allows(t) {
+		return append(problems, problem{
+			Start:    node.Start,
+			End:      node.End,
+			Message:  "Incorrect type. Expected \"" + strings.Join(s.types, " | ") + "\".",
+			Severity: severityWarning,
+		})
+	}
+
+	if len(s.Enum) > 0 && !slices.Contains(s.Enum, node.Value) {
+		values := []string{}
+		for _, value := range s.Enum {
+			data, _ := json.Marshal(value)
+			values = append(values, string(data))
+		}
+		problems = append(problems, problem{
+			Start:    node.Start,
+			End:      node.End,
+			Message:  "Value is not accepted. Valid values: " + strings.Join(values, ", ") + ".",
+			Severity: severityWarning,
+		})
+	}
+
+	if s.pattern != nil && node.Type == StringNode && !s.pattern.MatchString(node.Value.(string)) {
+		problems = append(problems, problem{
+			Start:    node.Start,
+			End:      node.End,
+			Message:  "String does not match the pattern of \"" + s.Pattern + "\".",
+			Severity: severityWarning,
+		})
+	}
+
+	switch node.Type {
+	case ObjectNode:
+		seen := map[string]bool{}
+
+		for _, property := range node.Properties {
+			if seen[property.Key] {
+				problems = append(problems, problem{
+					Start:    property.KeyStart,
+					End:      property.KeyEnd,
+					Message:  "Duplicate object key.",
+					Severity: severityWarning,
+				})
+			}
+			seen[property.Key] = true
+
+			_, known := s.Properties[property.Key]
+			if !known && s.closed {
+				problems = append(problems, problem{
+					Start:    property.KeyStart,
+					End:      property.KeyEnd,
+					Message:  "Property " + property.Key + " is not allowed.",
+					Severity: severityWarning,
+				})
+				continue
+			}
+
+			problems = s.property(property.Key).validate(property.Value, problems)
+		}
+
+		// only for complete objects,
+		// the missing property may be typed next
+		if node.Closed {
+			for _, required := range s.Required {
+				if !seen[required] {
+					problems = append(problems, problem{
+						Start:    node.Start,
+						End:      node.Start + 1,
+						Message:  "Missing property \"" + required + "\".",
+						Severity: severityWarning,
+					})
+				}
+			}
+		}
+	case ArrayNode:
+		for _, item := range node.Items {
+			problems = s.Items.validate(item, problems)
+		}
+	}
+
+	return problems
+}
+
+var projectSchemas = map[string]string{
+	"package.json":  "package.json",
+	"tsconfig.json": "tsconfig.json",
+	"lock.json":     "lock.json",
+}
+
+var configSchemas = map[string]string{
+	"git.json":        "config-git.json",
+	"git-ignore.json": "config-git-ignore.json",
+}
+
+// schema by file name, nil for plain JSON
+func schemaForFile(filePath string, configDirectory string) *Schema {
+	name := path.Base(filePath)
+
+	if configDirectory != "" && path.Dir(filePath) == path.Clean(configDirectory) {
+		if schemaFile, ok := configSchemas[name]; ok {
+			return loadSchema(schemaFile)
+		}
+		return nil
+	}
+
+	if schemaFile, ok := projectSchemas[name]; ok {
+		return loadSchema(schemaFile)
+	}
+
+	return nil
+}
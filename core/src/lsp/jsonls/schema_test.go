@@ -0,0 +1,147 @@
+package jsonls
+
+import (
+	"encoding/json"
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+)
+
+func newSchema(t *testing.T, data string) *Schema {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(data), schema)
+	if err == nil {
+		err = schema.prepare()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func validate(t *testing.T, schema *Schema, text string) []problem {
+	root, err := Parse(text, false)
+	if err != nil {
+		t.Fatalf("%s: %s", text, err.Message)
+	}
+	return schema.validate(root, []problem{})
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := newSchema(t, `{
+		"type": "object",
+		"required": ["name"],
+		"properties": {
+			"name": { "type": "string", "pattern": "^[a-z]+$" },
+			"count": { "type": "integer" },
+			"ratio": { "type": ["number", "null"] },
+			"mode": { "enum": ["a", "b"] },
+			"tags": { "type": "array", "items": { "type": "string" } },
+			"nested": {
+				"type": "object",
+				"additionalProperties": false,
+				"properties": { "ok": { "type": "boolean" } }
+			},
+			"map": { "type": "object", "additionalProperties": { "type": "number" } }
+		}
+	}`)
+
+	tests := []struct {
+		text     string
+		messages []string
+	}{
+		{`{"name": "abc", "count": 1, "ratio": 0.5, "mode": "a", "tags": ["x"], "nested": {"ok": true}, "map": {"x": 1}, "other": 1}`, nil},
+		{`{"name": "abc", "ratio": null}`, nil},
+		{`{}`, []string{`Missing property "name".`}},
+		{`{"name": 1}`, []string{`Incorrect type. Expected "string".`}},
+		{`{"name": "ABC"}`, []string{`String does not match the pattern of "^[a-z]+$".`}},
+		{`{"name": "a", "count": 1.5}`, []string{`Incorrect type. Expected "integer".`}},
+		{`{"name": "a", "mode": "c"}`, []string{`Value is not accepted. Valid values: "a", "b".`}},
+		{`{"name": "a", "tags": ["x", 1]}`, []string{`Incorrect type. Expected "string".`}},
+		{`{"name": "a", "nested": {"no": 1}}`, []string{`Property no is not allowed.`}},
+		{`{"name": "a", "map": {"x": "1"}}`, []string{`Incorrect type. Expected "number".`}},
+		{`{"name": "a", "name": "b"}`, []string{`Duplicate object key.`}},
+	}
+
+	for _, test := range tests {
+		problems := validate(t, schema, test.text)
+
+		messages := []string{}
+		for _, p := range problems {
+			messages = append(messages, p.Message)
+			if p.Severity != severityWarning {
+				t.Errorf("%s: expected a warning for %q", test.text, p.Message)
+			}
+		}
+
+		if strings.Join(messages, "\n") != strings.Join(test.messages, "\n") {
+			t.Errorf("%s: got %q, expected %q", test.text, messages, test.messages)
+		}
+	}
+}
+
+func TestSchemaProblemRange(t *testing.T) {
+	schema := newSchema(t, `{"properties": {"a": {"type": "string"}}}`)
+
+	text := `{"a": 12}`
+	problems := validate(t, schema, text)
+
+	if len(problems) != 1 || text[problems[0].Start:problems[0].End] != "12" {
+		t.Fatalf("unexpected %+v", problems)
+	}
+}
+
+func TestSchemaRequiredWhileTyping(t *testing.T) {
+	schema := newSchema(t, `{"required": ["name"]}`)
+
+	// unclosed, the property may be typed next
+	root, _ := Parse(`{"other": 1,`, false)
+	if problems := schema.validate(root, []problem{}); len(problems) != 0 {
+		t.Fatalf("unexpected %+v", problems)
+	}
+}
+
+func TestEmbeddedSchemas(t *testing.T) {
+	files, err := fs.ReadDir(schemaFiles, "schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		if loadSchema(file.Name()) == nil {
+			t.Errorf("schema %s does not load", file.Name())
+		}
+	}
+}
+
+func TestSchemaForFile(t *testing.T) {
+	config := "/root/.config/fullstacked"
+
+	tests := []struct {
+		file   string
+		schema string
+	}{
+		{"/root/project/package.json", "package.json"},
+		{"/root/project/tsconfig.json", "tsconfig.json"},
+		{"/root/project/lock.json", "lock.json"},
+		{"/root/project/data.json", ""},
+		{path.Join(config, "git.json"), "config-git.json"},
+		{path.Join(config, "git-ignore.json"), "config-git-ignore.json"},
+		{path.Join(config, "package.json"), ""},
+		{"/root/project/git.json", ""},
+	}
+
+	for _, test := range tests {
+		schema := schemaForFile(test.file, config)
+
+		var expected *Schema
+		if test.schema != "" {
+			expected = loadSchema(test.schema)
+		}
+
+		if schema != expected {
+			t.Errorf("%s: expected schema %q", test.file, test.schema)
+		}
+	}
+}
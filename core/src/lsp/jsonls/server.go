@@ -0,0 +1,565 @@
+package jsonls
+
+import (
+	"encoding/json"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Language server for JSON documents,
+// validated and completed against the schema
+// of known files, syntax only for the others.
+// Runs next to typescript-go on the same transport,
+// see IsJSONDocument. Document notifications reach both,
+// typescript-go resolves JSON modules from open documents
+
+type document struct {
+	uri     string
+	version int
+	text    string
+	jsonc   bool
+	schema  *Schema
+}
+
+type Server struct {
+	configDirectory string
+	send            func(message []byte)
+
+	mutex     sync.Mutex
+	documents map[string]*document
+}
+
+// send receives each message for the client
+func NewServer(configDirectory string, send func(message []byte)) *Server {
+	return &Server{
+		configDirectory: configDirectory,
+		send:            send,
+		documents:       map[string]*document{},
+	}
+}
+
+type message struct {
+	Id     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type textDocumentParams struct {
+	TextDocument struct {
+		Uri     string `json:"uri"`
+		Version int    `json:"version"`
+		Text    string `json:"text"`
+	} `json:"textDocument"`
+	ContentChanges []contentChange `json:"contentChanges"`
+	Position       Position        `json:"position"`
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	return u.Path
+}
+
+func IsJSONDocument(uri string) bool {
+	return strings.HasSuffix(strings.ToLower(uriToPath(uri)), ".json")
+}
+
+// true if the message concerns a JSON document
+// and was answered here. Other messages,
+// and JSON document notifications, go to the next server too
+func (s *Server) Handle(data []byte) bool {
+	msg := message{}
+	err := json.Unmarshal(data, &msg)
+
+	if err != nil || !strings.HasPrefix(msg.Method, "textDocument/") {
+		return false
+	}
+
+	params := textDocumentParams{}
+	err = json.Unmarshal(msg.Params, &params)
+
+	if err != nil || !IsJSONDocument(params.TextDocument.Uri) {
+		return false
+	}
+
+	uri := params.TextDocument.Uri
+
+	switch msg.Method {
+	case "textDocument/didOpen":
+		s.open(uri, params.TextDocument.Version, params.TextDocument.Text)
+		return false
+	case "textDocument/didChange":
+		s.change(uri, params.TextDocument.Version, params.ContentChanges)
+		return false
+	case "textDocument/didClose":
+		s.close(uri)
+		return false
+	case "textDocument/completion":
+		s.respond(msg.Id, s.completion(uri, params.Position))
+	case "textDocument/hover":
+		s.respond(msg.Id, s.hover(uri, params.Position))
+	default:
+		// other notifications
+		if len(msg.Id) == 0 {
+			return false
+		}
+		// unsupported requests still get a response
+		s.respond(msg.Id, nil)
+	}
+
+	return true
+}
+
+// true for diagnostics of a JSON document,
+// those of the next server are dropped
+func IsJSONDiagnostics(data string) bool {
+	if !strings.Contains(data, "textDocument/publishDiagnostics") {
+		return false
+	}
+
+	notification := struct {
+		Method string `json:"method"`
+		Params struct {
+			Uri string `json:"uri"`
+		} `json:"params"`
+	}{}
+	err := json.Unmarshal([]byte(data), &notification)
+
+	return err == nil &&
+		notification.Method == "textDocument/publishDiagnostics" &&
+		IsJSONDocument(notification.Params.Uri)
+}
+
+func (s *Server) respond(id json.RawMessage, result any) {
+	response, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"result":  result,
+	})
+	s.send(response)
+}
+
+func (s *Server) notify(method string, params any) {
+	notification, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	})
+	s.send(notification)
+}
+
+func (s *Server) open(uri string, version int, text string) {
+	filePath := uriToPath(uri)
+
+	d := &document{
+		uri:     uri,
+		version: version,
+		text:    text,
+		jsonc:   path.Base(filePath) == "tsconfig.json",
+		schema:  schemaForFile(filePath, s.configDirectory),
+	}
+
+	// diagnostics are computed and published under the lock,
+	// for the text they describe and in version order
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.documents[uri] = d
+	s.publishDiagnostics(d.uri, d.version, d.diagnostics())
+}
+
+func (s *Server) change(uri string, version int, changes []contentChange) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	d, ok := s.documents[uri]
+	if !ok {
+		return
+	}
+
+	for _, change := range changes {
+		d.text = applyChange(d.text, change)
+	}
+	d.version = version
+
+	s.publishDiagnostics(uri, version, d.diagnostics())
+}
+
+func (s *Server) close(uri string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.documents, uri)
+	s.publishDiagnostics(uri, 0, []diagnostic{})
+}
+
+func (s *Server) getDocument(uri string) (string, bool, *Schema, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	d, ok := s.documents[uri]
+	if !ok {
+		return "", false, nil, false
+	}
+
+	return d.text, d.jsonc, d.schema, true
+}
+
+type diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+func (s *Server) publishDiagnostics(uri string, version int, diagnostics []diagnostic) {
+	params := map[string]any{
+		"uri":         uri,
+		"diagnostics": diagnostics,
+	}
+	if version != 0 {
+		params["version"] = version
+	}
+	s.notify("textDocument/publishDiagnostics", params)
+}
+
+func (d *document) diagnostics() []diagnostic {
+	root, syntaxError := Parse(d.text, d.jsonc)
+
+	problems := []problem{}
+	if syntaxError != nil {
+		problems = append(problems, problem{
+			Start:    syntaxError.Start,
+			End:      min(syntaxError.End, len(d.text)),
+			Message:  syntaxError.Message,
+			Severity: severityError,
+		})
+	}
+
+	problems = d.schema.validate(root, problems)
+
+	diagnostics := []diagnostic{}
+	for _, p := range problems {
+		diagnostics = append(diagnostics, diagnostic{
+			Range:    offsetsToRange(d.text, p.Start, p.End),
+			Severity: p.Severity,
+			Source:   "json",
+			Message:  p.Message,
+		})
+	}
+
+	return diagnostics
+}
+
+type cursorKind int
+
+const (
+	noCursor cursorKind = iota
+	// property name of Object
+	keyCursor
+	// value of Property, or array item
+	valueCursor
+)
+
+type cursor struct {
+	kind cursorKind
+	// object schema for keys, value schema for values
+	schema   *Schema
+	object   *Node
+	property *Property
+	// text replaced by a completion
+	replaceStart int
+	replaceEnd   int
+}
+
+func inside(node *Node, offset int) bool {
+	if node.Type != ObjectNode && node.Type != ArrayNode {
+		return offset >= node.Start && offset <= node.End
+	}
+
+	if offset <= node.Start {
+		return false
+	}
+
+	return !node.Closed || offset < node.End
+}
+
+func valueCursorAt(node *Node, schema *Schema, property *Property, offset int) cursor {
+	c := cursor{
+		kind:         valueCursor,
+		schema:       schema,
+		property:     property,
+		replaceStart: offset,
+		replaceEnd:   offset,
+	}
+
+	if node != nil {
+		c.replaceStart = node.Start
+		c.replaceEnd = node.End
+		if !node.Closed {
+			c.replaceEnd = offset
+		}
+	}
+
+	return c
+}
+
+func locate(node *Node, schema *Schema, offset int) cursor {
+	switch node.Type {
+	case ObjectNode:
+		for _, property := range node.Properties {
+			inKey := offset > property.KeyStart &&
+				(offset < property.KeyEnd || (!property.KeyClosed && offset <= property.KeyEnd))
+
+			if inKey {
+				replaceEnd := property.KeyEnd
+				if !property.KeyClosed {
+					replaceEnd = offset
+				}
+				return cursor{
+					kind:         keyCursor,
+					schema:       schema,
+					object:       node,
+					property:     property,
+					replaceStart: property.KeyStart,
+					replaceEnd:   replaceEnd,
+				}
+			}
+
+			if property.Colon == -1 || offset <= property.Colon {
+				continue
+			}
+
+			value := property.Value
+			valueSchema := schema.property(property.Key)
+
+			if value == nil {
+				return valueCursorAt(nil, valueSchema, property, offset)
+			}
+
+			if !inside(value, offset) {
+				if offset < value.Start {
+					return valueCursorAt(nil, valueSchema, property, offset)
+				}
+				continue
+			}
+
+			if value.Type == ObjectNode || value.Type == ArrayNode {
+				return locate(value, valueSchema, offset)
+			}
+
+			return valueCursorAt(value, valueSchema, property, offset)
+		}
+
+		return cursor{
+			kind:         keyCursor,
+			schema:       schema,
+			object:       node,
+			replaceStart: offset,
+			replaceEnd:   offset,
+		}
+	case ArrayNode:
+		var itemSchema *Schema
+		if schema != nil {
+			itemSchema = schema.Items
+		}
+
+		for _, item := range node.Items {
+			if !inside(item, offset) {
+				continue
+			}
+
+			if item.Type == ObjectNode || item.Type == ArrayNode {
+				return locate(item, itemSchema, offset)
+			}
+
+			return valueCursorAt(item, itemSchema, nil, offset)
+		}
+
+		return valueCursorAt(nil, itemSchema, nil, offset)
+	}
+
+	return cursor{}
+}
+
+func (s *Server) cursorAt(uri string, position Position) (cursor, string) {
+	text, jsonc, schema, ok := s.getDocument(uri)
+	if !ok {
+		return cursor{}, ""
+	}
+
+	offset := positionToOffset(text, position)
+	root, _ := Parse(text, jsonc)
+
+	if root == nil {
+		return valueCursorAt(nil, schema, nil, offset), text
+	}
+
+	if !inside(root, offset) {
+		return cursor{}, text
+	}
+
+	if root.Type != ObjectNode && root.Type != ArrayNode {
+		return valueCursorAt(root, schema, nil, offset), text
+	}
+
+	return locate(root, schema, offset), text
+}
+
+type completionItem struct {
+	Label            string `json:"label"`
+	Kind             int    `json:"kind"`
+	Detail           string `json:"detail,omitempty"`
+	Documentation    string `json:"documentation,omitempty"`
+	InsertTextFormat int    `json:"insertTextFormat"`
+	TextEdit         struct {
+		Range   Range  `json:"range"`
+		NewText string `json:"newText"`
+	} `json:"textEdit"`
+}
+
+const (
+	completionKindValue    = 12
+	completionKindProperty = 10
+
+	insertTextPlain   = 1
+	insertTextSnippet = 2
+)
+
+func valueSnippet(schema *Schema) string {
+	if schema == nil || len(schema.types) != 1 {
+		return "$1"
+	}
+
+	switch schema.types[0] {
+	case "object":
+		return "{$1}"
+	case "array":
+		return "[$1]"
+	case "string":
+		return "\"$1\""
+	}
+
+	return "$1"
+}
+
+func (s *Server) completion(uri string, position Position) map[string]any {
+	c, text := s.cursorAt(uri, position)
+	replaceRange := offsetsToRange(text, c.replaceStart, c.replaceEnd)
+
+	items := []completionItem{}
+
+	switch c.kind {
+	case keyCursor:
+		if c.schema == nil {
+			break
+		}
+
+		existing := map[string]bool{}
+		for _, property := range c.object.Properties {
+			if property != c.property {
+				existing[property.Key] = true
+			}
+		}
+
+		keys := []string{}
+		for key := range c.schema.Properties {
+			if !existing[key] {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			propertySchema := c.schema.Properties[key]
+			encodedKey, _ := json.Marshal(key)
+
+			item := completionItem{
+				Label:            key,
+				Kind:             completionKindProperty,
+				Detail:           strings.Join(propertySchema.types, " | "),
+				Documentation:    propertySchema.Description,
+				InsertTextFormat: insertTextSnippet,
+			}
+			item.TextEdit.Range = replaceRange
+			item.TextEdit.NewText = string(encodedKey)
+
+			// new property, not renaming one
+			if c.property == nil || c.property.Colon == -1 {
+				item.TextEdit.NewText += ": " + valueSnippet(propertySchema)
+			}
+
+			items = append(items, item)
+		}
+	case valueCursor:
+		if c.schema == nil {
+			break
+		}
+
+		values := append([]any{}, c.schema.Enum...)
+		values = append(values, c.schema.Examples...)
+		if len(c.schema.Enum) == 0 && c.schema.allows("boolean") && len(c.schema.types) > 0 {
+			values = append(values, true, false)
+		}
+
+		seen := map[string]bool{}
+		for _, value := range values {
+			encoded, _ := json.Marshal(value)
+			if seen[string(encoded)] {
+				continue
+			}
+			seen[string(encoded)] = true
+
+			item := completionItem{
+				Label:            string(encoded),
+				Kind:             completionKindValue,
+				Documentation:    c.schema.Description,
+				InsertTextFormat: insertTextPlain,
+			}
+			item.TextEdit.Range = replaceRange
+			item.TextEdit.NewText = string(encoded)
+
+			items = append(items, item)
+		}
+	}
+
+	return map[string]any{
+		"isIncomplete": false,
+		"items":        items,
+	}
+}
+
+func (s *Server) hover(uri string, position Position) any {
+	c, text := s.cursorAt(uri, position)
+
+	if c.property == nil {
+		return nil
+	}
+
+	schema := c.schema
+	if c.kind == keyCursor {
+		schema = c.schema.property(c.property.Key)
+	}
+
+	if schema == nil || schema.Description == "" {
+		return nil
+	}
+
+	start, end := c.property.KeyStart, c.property.KeyEnd
+	if c.kind == valueCursor {
+		start, end = c.replaceStart, c.replaceEnd
+	}
+
+	return map[string]any{
+		"contents": map[string]string{
+			"kind":  "markdown",
+			"value": schema.Description,
+		},
+		"range": offsetsToRange(text, start, end),
+	}
+}
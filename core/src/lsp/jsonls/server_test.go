@@ -0,0 +1,277 @@
+package jsonls
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+type sent struct {
+	Id     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params struct {
+		Uri         string       `json:"uri"`
+		Version     int          `json:"version"`
+		Diagnostics []diagnostic `json:"diagnostics"`
+	} `json:"params"`
+	Result json.RawMessage `json:"result"`
+}
+
+type recorder struct {
+	mutex    sync.Mutex
+	messages []sent
+}
+
+func (r *recorder) send(message []byte) {
+	msg := sent{}
+	json.Unmarshal(message, &msg)
+
+	r.mutex.Lock()
+	r.messages = append(r.messages, msg)
+	r.mutex.Unlock()
+}
+
+func (r *recorder) last(t *testing.T) sent {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.messages) == 0 {
+		t.Fatal("nothing sent")
+	}
+	return r.messages[len(r.messages)-1]
+}
+
+func newTestServer() (*Server, *recorder) {
+	r := &recorder{}
+	return NewServer("/config", r.send), r
+}
+
+func request(id int, method string, params map[string]any) []byte {
+	msg := map[string]any{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	}
+	if id != 0 {
+		msg["id"] = id
+	}
+	data, _ := json.Marshal(msg)
+	return data
+}
+
+func textDocument(uri string, version int, text string) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{
+			"uri":     uri,
+			"version": version,
+			"text":    text,
+		},
+	}
+}
+
+const packageJSON = "file:///project/package.json"
+
+func TestServerDocumentLifecycle(t *testing.T) {
+	s, r := newTestServer()
+
+	// notifications go to typescript-go too
+	if s.Handle(request(0, "textDocument/didOpen", textDocument(packageJSON, 1, `{"type": "umd"}`))) {
+		t.Fatal("didOpen was not forwarded")
+	}
+
+	published := r.last(t)
+	if published.Method != "textDocument/publishDiagnostics" || published.Params.Version != 1 ||
+		len(published.Params.Diagnostics) != 1 || published.Params.Diagnostics[0].Source != "json" {
+		t.Fatalf("unexpected %+v", published)
+	}
+
+	d := published.Params.Diagnostics[0]
+	if d.Range.Start != (Position{0, 9}) || d.Range.End != (Position{0, 14}) {
+		t.Fatalf("unexpected range %+v", d.Range)
+	}
+
+	// "umd" to "module"
+	change := textDocument(packageJSON, 2, "")
+	change["contentChanges"] = []any{
+		map[string]any{
+			"range": Range{Start: Position{0, 10}, End: Position{0, 13}},
+			"text":  "module",
+		},
+	}
+	if s.Handle(request(0, "textDocument/didChange", change)) {
+		t.Fatal("didChange was not forwarded")
+	}
+
+	published = r.last(t)
+	if published.Params.Version != 2 || len(published.Params.Diagnostics) != 0 {
+		t.Fatalf("unexpected %+v", published)
+	}
+
+	text, _, _, _ := s.getDocument(packageJSON)
+	if text != `{"type": "module"}` {
+		t.Fatalf("unexpected text %q", text)
+	}
+
+	if s.Handle(request(0, "textDocument/didClose", textDocument(packageJSON, 0, ""))) {
+		t.Fatal("didClose was not forwarded")
+	}
+
+	if _, _, _, ok := s.getDocument(packageJSON); ok {
+		t.Fatal("document still open")
+	}
+
+	published = r.last(t)
+	if published.Params.Uri != packageJSON || len(published.Params.Diagnostics) != 0 {
+		t.Fatalf("unexpected %+v", published)
+	}
+}
+
+func TestServerSyntaxError(t *testing.T) {
+	s, r := newTestServer()
+
+	s.Handle(request(0, "textDocument/didOpen", textDocument("file:///project/data.json", 1, `{"a": }`)))
+
+	diagnostics := r.last(t).Params.Diagnostics
+	if len(diagnostics) != 1 || diagnostics[0].Severity != severityError || diagnostics[0].Message != "value expected" {
+		t.Fatalf("unexpected %+v", diagnostics)
+	}
+}
+
+func TestServerRequests(t *testing.T) {
+	s, r := newTestServer()
+
+	s.Handle(request(0, "textDocument/didOpen", textDocument(packageJSON, 1, `{"type": ""}`)))
+
+	position := textDocument(packageJSON, 0, "")
+	position["position"] = Position{0, 10}
+
+	if !s.Handle(request(1, "textDocument/completion", position)) {
+		t.Fatal("completion was forwarded")
+	}
+
+	response := r.last(t)
+	completion := struct {
+		Items []completionItem `json:"items"`
+	}{}
+	json.Unmarshal(response.Result, &completion)
+
+	if string(response.Id) != "1" || len(completion.Items) != 2 ||
+		completion.Items[0].Label != `"module"` || completion.Items[1].Label != `"commonjs"` {
+		t.Fatalf("unexpected %s", response.Result)
+	}
+
+	position["position"] = Position{0, 3}
+	if !s.Handle(request(2, "textDocument/hover", position)) {
+		t.Fatal("hover was forwarded")
+	}
+
+	hover := struct {
+		Contents struct {
+			Value string `json:"value"`
+		} `json:"contents"`
+	}{}
+	json.Unmarshal(r.last(t).Result, &hover)
+
+	if hover.Contents.Value == "" {
+		t.Fatalf("no hover for type, got %s", r.last(t).Result)
+	}
+
+	// unsupported requests get a null result
+	if !s.Handle(request(3, "textDocument/definition", position)) {
+		t.Fatal("definition was forwarded")
+	}
+
+	if response := r.last(t); string(response.Id) != "3" || string(response.Result) != "null" {
+		t.Fatalf("unexpected %+v", response)
+	}
+
+	// other notifications are forwarded
+	if s.Handle(request(0, "textDocument/didSave", textDocument(packageJSON, 0, ""))) {
+		t.Fatal("didSave was not forwarded")
+	}
+}
+
+func TestServerIgnoresOtherDocuments(t *testing.T) {
+	s, r := newTestServer()
+
+	if s.Handle(request(0, "textDocument/didOpen", textDocument("file:///project/index.ts", 1, "{"))) {
+		t.Fatal("handled a TypeScript document")
+	}
+
+	if s.Handle(request(1, "initialize", map[string]any{})) {
+		t.Fatal("handled initialize")
+	}
+
+	if len(r.messages) != 0 {
+		t.Fatalf("unexpected %+v", r.messages)
+	}
+}
+
+func TestServerConcurrentChanges(t *testing.T) {
+	s, r := newTestServer()
+
+	s.Handle(request(0, "textDocument/didOpen", textDocument(packageJSON, 1, "")))
+
+	wait := sync.WaitGroup{}
+	for i := range 50 {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			change := textDocument(packageJSON, i+2, "")
+			change["contentChanges"] = []any{
+				map[string]any{"text": `{"name": "v` + strconv.Itoa(i) + `"}`},
+			}
+			s.Handle(request(0, "textDocument/didChange", change))
+		}()
+	}
+	wait.Wait()
+
+	// published in the order the changes were applied
+	text, _, _, _ := s.getDocument(packageJSON)
+	last := r.last(t)
+
+	s.mutex.Lock()
+	version := s.documents[packageJSON].version
+	s.mutex.Unlock()
+
+	if last.Params.Version != version {
+		t.Fatalf("last diagnostics for version %d, document at %d (%s)", last.Params.Version, version, text)
+	}
+}
+
+func TestIsJSONDiagnostics(t *testing.T) {
+	tests := []struct {
+		message string
+		json    bool
+	}{
+		{`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file:///p/tsconfig.json","diagnostics":[]}}`, true},
+		{`{"jsonrpc":"2.0","method":"textDocument/publishDiagnostics","params":{"uri":"file:///p/index.ts","diagnostics":[]}}`, false},
+		{`{"jsonrpc":"2.0","id":1,"result":{"uri":"file:///p/a.json"}}`, false},
+	}
+
+	for _, test := range tests {
+		if IsJSONDiagnostics(test.message) != test.json {
+			t.Errorf("%s: expected %t", test.message, test.json)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	// 😀 is two UTF-16 code units
+	text := "{\n  \"😀\": 1\n}"
+
+	offset := positionToOffset(text, Position{1, 5})
+	if text[offset:offset+2] != `":` {
+		t.Fatalf("unexpected offset %d", offset)
+	}
+
+	if position := offsetToPosition(text, offset); position != (Position{1, 5}) {
+		t.Fatalf("unexpected position %+v", position)
+	}
+
+	// past the end of the line
+	if offset := positionToOffset(text, Position{0, 10}); offset != 1 {
+		t.Fatalf("unexpected offset %d", offset)
+	}
+}
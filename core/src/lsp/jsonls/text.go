@@ -0,0 +1,86 @@
+package jsonls
+
+import (
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// LSP positions count UTF-16 code units
+
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+func offsetToPosition(text string, offset int) Position {
+	position := Position{}
+
+	for i, r := range text {
+		if i >= offset {
+			break
+		}
+
+		if r == '\n' {
+			position.Line++
+			position.Character = 0
+			continue
+		}
+
+		position.Character += utf16.RuneLen(r)
+	}
+
+	return position
+}
+
+func positionToOffset(text string, position Position) int {
+	line := 0
+	offset := 0
+
+	for line < position.Line && offset < len(text) {
+		if text[offset] == '\n' {
+			line++
+		}
+		offset++
+	}
+
+	character := 0
+	for offset < len(text) && character < position.Character {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		if r == '\n' {
+			break
+		}
+		character += utf16.RuneLen(r)
+		offset += size
+	}
+
+	return offset
+}
+
+func offsetsToRange(text string, start int, end int) Range {
+	return Range{
+		Start: offsetToPosition(text, start),
+		End:   offsetToPosition(text, end),
+	}
+}
+
+type contentChange struct {
+	// nil replaces the whole document
+	Range *Range `json:"range"`
+	Text  string `json:"text"`
+}
+
+func applyChange(text string, change contentChange) string {
+	if change.Range == nil {
+		return change.Text
+	}
+
+	start := positionToOffset(text, change.Range.Start)
+	end := max(start, positionToOffset(text, change.Range.End))
+
+	return text[:start] + change.Text + text[end:]
+}
@@ -1,175 +1,177 @@
 package ts_lsp
 
 import (
-	"errors"
 	"fmt"
 	"fullstackedorg/fullstacked/src/fs"
+	"fullstackedorg/fullstacked/src/lsp/jsonls"
 	"fullstackedorg/fullstacked/src/setup"
 	"fullstackedorg/fullstacked/src/utils"
 	"io"
-	"slices"
-	"strconv"
+	"time"
 
 	tsgo "github.com/microsoft/typescript-go/cmd/module"
 )
 
-var startToken = "Content-Length: "
-var startTokenBin = []byte(startToken)
-var headerSplit = "\r\n\r\n"
-var headerSplitBin = []byte(headerSplit)
-
-func findOccurence(buffer []byte, matching []byte, num int) int {
-	count := 0
-	for i := range buffer {
-		fullMatch := true
-		for j, m := range matching {
-			if i+j > len(buffer)-1 || m != buffer[i+j] {
-				fullMatch = false
-				break
-			}
-		}
-		if fullMatch {
-			count += 1
-		}
-		if count == num {
-			return i
-		}
-	}
+func (s *session) handleMessage(message string) {
+	s.touch()
 
-	return -1
-}
+	if s.isClosing() && s.isShutdownResponse(message) {
+		s.ackOnce.Do(func() {
+			close(s.shutdownAck)
+		})
+		return
+	}
 
-type BufferSlice struct {
-	From int
-	To   int
+	setup.Callback("", "lsp-"+s.Id, message)
 }
 
-func processBuffer(buffer []byte) (*BufferSlice, error) {
-	if len(buffer) < len(startTokenBin) {
-		return nil, nil
-	}
-
-	if !slices.Equal(buffer[0:len(startTokenBin)], startTokenBin) {
-		return nil, errors.New("buffer does not contain start token")
-	}
+// reads the server output until it stops
+func (s *session) read() {
+	defer s.closed()
 
-	posHeaderSplit := findOccurence(buffer, headerSplitBin, 1)
+	reader := newMessageReader(s.output)
 
-	numStr := buffer[len(startTokenBin):posHeaderSplit]
-	expectedLength, err := strconv.Atoi(string(numStr))
+	for {
+		message, err := reader.next()
 
-	if err != nil {
-		return nil, err
-	}
+		if err == errMalformedFrame {
+			fmt.Println("LSP malformed frame", s.Id)
+			continue
+		}
 
-	posStartMessage := posHeaderSplit + len(headerSplit)
+		if err != nil {
+			return
+		}
 
-	messageBuffer := buffer[posStartMessage:]
+		// the JSON server owns diagnostics of JSON documents
+		if jsonls.IsJSONDiagnostics(message) {
+			continue
+		}
 
-	if len(messageBuffer) < expectedLength {
-		return nil, nil
+		s.handleMessage(message)
 	}
-
-	return &BufferSlice{
-		From: posStartMessage,
-		To:   posStartMessage + expectedLength,
-	}, nil
 }
 
-type LspInstance struct {
-	PipeWriter *io.PipeWriter
-}
-
-var LSPs = make(map[string]*LspInstance)
-
-func Start(directory string) string {
+func Start(projectId string, directory string) string {
 	transportId := utils.RandString(6)
 
 	end := make(chan struct{})
 
-	callbackMessageType := "lsp-" + transportId
-
 	inRead, inWrite := io.Pipe()
 	outRead, outWrite := io.Pipe()
 
-	LSPs[transportId] = &LspInstance{
-		PipeWriter: inWrite,
+	s := &session{
+		Id:           transportId,
+		ProjectId:    projectId,
+		Directory:    directory,
+		input:        inWrite,
+		output:       outRead,
+		lastActivity: time.Now(),
+		shutdownAck:  make(chan struct{}),
+		done:         make(chan struct{}),
 	}
 
+	configDirectory := ""
+	if setup.Directories != nil {
+		configDirectory = setup.Directories.Config
+	}
+
+	s.json = jsonls.NewServer(configDirectory, func(message []byte) {
+		s.handleMessage(string(message))
+	})
+
+	addSession(s)
+
 	fmt.Println("STARTING ", transportId)
 
-	if fs.WASM {
-		go tsgo.RunLSP_WASM(
-			&WasmFS{},
-			directory,
-			inRead,
-			outWrite,
-			end,
-		)
-	} else {
-		go tsgo.RunLSP(
-			directory,
-			inRead,
-			outWrite,
-			end,
-		)
+	// a crashing server only ends its own session
+	run := func() {
+		defer func() {
+			if r := recover(); r != nil {
+				fmt.Println("LSP crashed", transportId, r)
+			}
+			inRead.Close()
+			outWrite.Close()
+		}()
+
+		if fs.WASM {
+			tsgo.RunLSP_WASM(
+				&WasmFS{},
+				directory,
+				inRead,
+				outWrite,
+				end,
+			)
+		} else {
+			tsgo.RunLSP(
+				directory,
+				inRead,
+				outWrite,
+				end,
+			)
+		}
 	}
 
-	buffer := []byte{}
+	go run()
 
 	go func() {
-		for {
-			select {
-			case <-end:
-				fmt.Println("CLOSING ", transportId)
-				setup.Callback("", "lsp-close", transportId)
-				return
-			default:
-				b := make([]byte, 1024)
-				n, _ := outRead.Read(b)
-
-				if n > 0 {
-					buffer = append(buffer, b[0:n]...)
-					bSlice, err := processBuffer(buffer)
-					if err != nil {
-						panic(err)
-					}
-					if bSlice != nil {
-						message := string(buffer[bSlice.From:bSlice.To])
-						setup.Callback("", callbackMessageType, message)
-						buffer = buffer[bSlice.To:]
-					}
-				}
-			}
+		select {
+		case <-end:
+			outWrite.Close()
+		case <-s.done:
 		}
 	}()
 
+	go s.read()
+
 	return transportId
 }
 
 func Request(transportId string, message string) {
-	lspInstance, ok := LSPs[transportId]
+	s := getSession(transportId)
 
-	if !ok {
+	if s == nil {
 		fmt.Println("could not find lsp for " + transportId)
 		return
 	}
 
-	messageData := []byte(message)
-	contentLength := len(messageData)
-	payload := startToken + strconv.Itoa(contentLength) + headerSplit + message
-	lspInstance.PipeWriter.Write([]byte(payload))
+	if s.isClosing() {
+		return
+	}
+
+	s.touch()
+
+	if s.json.Handle([]byte(message)) {
+		return
+	}
+
+	s.write(message)
 }
 
 func End(transportId string) {
-	lspInstance, ok := LSPs[transportId]
+	s := getSession(transportId)
 
-	if !ok {
+	if s == nil {
 		return
 	}
 
-	lspInstance.PipeWriter.Close()
-	delete(LSPs, transportId)
+	s.shutdown()
+}
+
+// [transportId, projectId, idle seconds] for each live session
+func List() []any {
+	sessionsMutex.Lock()
+	defer sessionsMutex.Unlock()
+
+	list := []any{}
+	for _, s := range sessions {
+		if s.isClosing() {
+			continue
+		}
+		list = append(list, s.Id, s.ProjectId, s.idleFor().Seconds())
+	}
+
+	return list
 }
 
 func Version() string {
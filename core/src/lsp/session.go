@@ -0,0 +1,183 @@
+package ts_lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fullstackedorg/fullstacked/src/lsp/jsonls"
+	"fullstackedorg/fullstacked/src/setup"
+)
+
+// sessions without requests or messages
+// for that long are shut down, the editor
+// starts a new one after the lsp-close callback
+var IdleTimeout = time.Minute * 15
+var reapInterval = time.Minute
+var shutdownTimeout = time.Second * 5
+
+const shutdownRequestId = "fullstacked-shutdown"
+
+type session struct {
+	Id        string
+	ProjectId string
+	Directory string
+
+	input  *io.PipeWriter
+	output *io.PipeReader
+
+	// JSON documents never reach typescript-go
+	json *jsonls.Server
+
+	// serializes frames written to the server
+	writeMutex sync.Mutex
+
+	mutex        sync.Mutex
+	lastActivity time.Time
+	closing      bool
+
+	// closed when the shutdown response arrives
+	shutdownAck chan struct{}
+	ackOnce     sync.Once
+	// closed when the reader returns
+	done chan struct{}
+}
+
+var sessionsMutex = sync.Mutex{}
+var sessions = map[string]*session{}
+var reaper = sync.Once{}
+
+func getSession(transportId string) *session {
+	sessionsMutex.Lock()
+	defer sessionsMutex.Unlock()
+	return sessions[transportId]
+}
+
+func addSession(s *session) {
+	sessionsMutex.Lock()
+	sessions[s.Id] = s
+	sessionsMutex.Unlock()
+
+	reaper.Do(func() {
+		go reapIdleSessions()
+	})
+}
+
+func removeSession(transportId string) {
+	sessionsMutex.Lock()
+	delete(sessions, transportId)
+	sessionsMutex.Unlock()
+}
+
+func reapIdleSessions() {
+	for {
+		time.Sleep(reapInterval)
+
+		sessionsMutex.Lock()
+		idle := []*session{}
+		for _, s := range sessions {
+			if s.idleFor() > IdleTimeout {
+				idle = append(idle, s)
+			}
+		}
+		sessionsMutex.Unlock()
+
+		for _, s := range idle {
+			fmt.Println("LSP idle, shutting down", s.Id)
+			s.shutdown()
+		}
+	}
+}
+
+func (s *session) touch() {
+	s.mutex.Lock()
+	s.lastActivity = time.Now()
+	s.mutex.Unlock()
+}
+
+func (s *session) idleFor() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return time.Since(s.lastActivity)
+}
+
+func (s *session) isClosing() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closing
+}
+
+func (s *session) write(message string) error {
+	payload := startToken + strconv.Itoa(len(message)) + headerSplit + message
+
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	_, err := s.input.Write([]byte(payload))
+	return err
+}
+
+// true if the message is the response
+// to our shutdown request
+func (s *session) isShutdownResponse(message string) bool {
+	if !strings.Contains(message, shutdownRequestId) {
+		return false
+	}
+
+	response := struct {
+		Id any `json:"id"`
+	}{}
+	err := json.Unmarshal([]byte(message), &response)
+
+	return err == nil && response.Id == shutdownRequestId
+}
+
+// shutdown request, exit notification,
+// then closes the pipes if the server doesn't stop by itself
+func (s *session) shutdown() {
+	s.mutex.Lock()
+	if s.closing {
+		s.mutex.Unlock()
+		return
+	}
+	s.closing = true
+	s.mutex.Unlock()
+
+	go func() {
+		err := s.write(`{"jsonrpc":"2.0","id":"` + shutdownRequestId + `","method":"shutdown"}`)
+		if err == nil {
+			select {
+			case <-s.shutdownAck:
+			case <-s.done:
+			case <-time.After(shutdownTimeout):
+			}
+			s.write(`{"jsonrpc":"2.0","method":"exit"}`)
+		}
+
+		s.input.Close()
+
+		select {
+		case <-s.done:
+		case <-time.After(shutdownTimeout):
+			s.output.Close()
+		}
+	}()
+}
+
+// reader ended, the server is gone
+func (s *session) closed() {
+	removeSession(s.Id)
+
+	s.mutex.Lock()
+	s.closing = true
+	s.mutex.Unlock()
+
+	s.input.Close()
+	close(s.done)
+
+	fmt.Println("CLOSING ", s.Id)
+	setup.Callback("", "lsp-close", s.Id)
+}
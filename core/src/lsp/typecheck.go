@@ -0,0 +1,438 @@
+package ts_lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fullstackedorg/fullstacked/src/fs"
+
+	tsgo "github.com/microsoft/typescript-go/cmd/module"
+)
+
+// Full project check on a private typescript-go LSP server,
+// started like the sessions through RunLSP.
+// Every source file is opened first, so they all are in
+// one program, then their diagnostics are pulled
+// with textDocument/diagnostic.
+
+var typeCheckTimeout = time.Minute * 5
+
+// not walked for source files
+var typeCheckSkip = []string{".*", "node_modules", "/.build", "/data"}
+
+var typeCheckLanguages = map[string]string{
+	".ts":  "typescript",
+	".mts": "typescript",
+	".cts": "typescript",
+	".tsx": "typescriptreact",
+	".js":  "javascript",
+	".mjs": "javascript",
+	".cjs": "javascript",
+	".jsx": "javascriptreact",
+}
+
+type DiagnosticPosition struct {
+	// zero-based
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Diagnostic struct {
+	// relative to the project directory
+	File     string             `json:"file"`
+	Start    DiagnosticPosition `json:"start"`
+	End      DiagnosticPosition `json:"end"`
+	Code     int                `json:"code"`
+	Message  string             `json:"message"`
+	Severity string             `json:"severity"`
+}
+
+type TypeCheckResult struct {
+	Id          float64      `json:"id"`
+	ProjectId   string       `json:"projectId"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+	Error       string       `json:"error,omitempty"`
+}
+
+func TypeCheck(projectId string, directory string, id float64) (result TypeCheckResult) {
+	result = TypeCheckResult{
+		Id:          id,
+		ProjectId:   projectId,
+		Diagnostics: []Diagnostic{},
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			result.Error = fmt.Sprint(r)
+		}
+	}()
+
+	diagnostics, err := typeCheck(directory)
+
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Diagnostics = diagnostics
+	}
+
+	return result
+}
+
+func typeCheck(directory string) ([]Diagnostic, error) {
+	items, err := fs.ReadDir(directory, true, true, typeCheckSkip, typeCheckIncluded())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), typeCheckTimeout)
+	defer cancel()
+
+	client := startTypeCheckServer(directory)
+	defer client.stop()
+
+	_, err = client.request(ctx, "initialize", map[string]any{
+		"processId": nil,
+		"rootUri":   fileUri(directory),
+		"workspaceFolders": []any{
+			map[string]any{"uri": fileUri(directory), "name": path.Base(directory)},
+		},
+		"capabilities": map[string]any{
+			"textDocument": map[string]any{
+				"diagnostic": map[string]any{},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	client.notify("initialized", map[string]any{})
+
+	diagnostics := []Diagnostic{}
+
+	for _, item := range items {
+		err = client.open(directory, item.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, item := range items {
+		fileDiagnostics, err := client.fileDiagnostics(ctx, directory, item.Name)
+		if err != nil {
+			return nil, err
+		}
+		diagnostics = append(diagnostics, fileDiagnostics...)
+	}
+
+	return diagnostics, nil
+}
+
+func typeCheckIncluded() []string {
+	include := []string{}
+	for extension := range typeCheckLanguages {
+		include = append(include, "*"+extension)
+	}
+	return include
+}
+
+func fileUri(filePath string) string {
+	filePath = filepath.ToSlash(filePath)
+	// windows drive letter
+	if !strings.HasPrefix(filePath, "/") {
+		filePath = "/" + filePath
+	}
+	return (&url.URL{Scheme: "file", Path: filePath}).String()
+}
+
+type typeCheckClient struct {
+	input  *io.PipeWriter
+	output *io.PipeReader
+
+	writeMutex sync.Mutex
+
+	mutex   sync.Mutex
+	nextId  int
+	pending map[int]chan typeCheckMessage
+	stopped bool
+}
+
+type typeCheckMessage struct {
+	Id     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+var errTypeCheckServerStopped = errors.New("typescript-go server stopped")
+
+func startTypeCheckServer(directory string) *typeCheckClient {
+	inRead, inWrite := io.Pipe()
+	outRead, outWrite := io.Pipe()
+	end := make(chan struct{})
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				fmt.Println("typecheck LSP crashed", r)
+			}
+			inRead.Close()
+			outWrite.Close()
+		}()
+
+		if fs.WASM {
+			tsgo.RunLSP_WASM(&WasmFS{}, directory, inRead, outWrite, end)
+		} else {
+			tsgo.RunLSP(directory, inRead, outWrite, end)
+		}
+	}()
+
+	client := &typeCheckClient{
+		input:   inWrite,
+		output:  outRead,
+		pending: map[int]chan typeCheckMessage{},
+	}
+
+	go client.read()
+
+	return client
+}
+
+func (c *typeCheckClient) write(message any) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	payload := startToken + strconv.Itoa(len(data)) + headerSplit + string(data)
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_, err = c.input.Write([]byte(payload))
+	return err
+}
+
+func (c *typeCheckClient) notify(method string, params any) error {
+	return c.write(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	})
+}
+
+func (c *typeCheckClient) request(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	response := make(chan typeCheckMessage, 1)
+
+	c.mutex.Lock()
+	if c.stopped {
+		c.mutex.Unlock()
+		return nil, errTypeCheckServerStopped
+	}
+	id := c.nextId
+	c.nextId++
+	c.pending[id] = response
+	c.mutex.Unlock()
+
+	err := c.write(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  method,
+		"params":  params,
+	})
+
+	if err == nil {
+		select {
+		case msg, ok := <-response:
+			if !ok {
+				return nil, errTypeCheckServerStopped
+			}
+			if msg.Error != nil {
+				return nil, errors.New(method + ": " + msg.Error.Message)
+			}
+			return msg.Result, nil
+		case <-ctx.Done():
+			err = errors.New("typecheck timed out")
+		}
+	}
+
+	c.mutex.Lock()
+	delete(c.pending, id)
+	c.mutex.Unlock()
+
+	return nil, err
+}
+
+func (c *typeCheckClient) read() {
+	reader := newMessageReader(c.output)
+
+	defer func() {
+		c.mutex.Lock()
+		c.stopped = true
+		for id, response := range c.pending {
+			close(response)
+			delete(c.pending, id)
+		}
+		c.mutex.Unlock()
+	}()
+
+	for {
+		message, err := reader.next()
+
+		if err == errMalformedFrame {
+			continue
+		}
+
+		if err != nil {
+			return
+		}
+
+		msg := typeCheckMessage{}
+		if json.Unmarshal([]byte(message), &msg) != nil {
+			continue
+		}
+
+		if msg.Method != "" {
+			if msg.Id != nil {
+				c.replyToServer(msg)
+			}
+			continue
+		}
+
+		id, err := strconv.Atoi(string(msg.Id))
+		if err != nil {
+			continue
+		}
+
+		c.mutex.Lock()
+		response, ok := c.pending[id]
+		delete(c.pending, id)
+		c.mutex.Unlock()
+
+		if ok {
+			response <- msg
+		}
+	}
+}
+
+// server requests get empty results,
+// one per item for workspace/configuration
+func (c *typeCheckClient) replyToServer(msg typeCheckMessage) {
+	var result any
+
+	if msg.Method == "workspace/configuration" {
+		params := struct {
+			Items []any `json:"items"`
+		}{}
+		json.Unmarshal(msg.Params, &params)
+		result = make([]any, len(params.Items))
+	}
+
+	go c.write(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      msg.Id,
+		"result":  result,
+	})
+}
+
+func (c *typeCheckClient) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	_, err := c.request(ctx, "shutdown", nil)
+	if err == nil {
+		c.notify("exit", nil)
+	}
+
+	c.input.Close()
+	c.output.Close()
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspDiagnostic struct {
+	Range struct {
+		Start lspPosition `json:"start"`
+		End   lspPosition `json:"end"`
+	} `json:"range"`
+	Severity int             `json:"severity"`
+	Code     json.RawMessage `json:"code"`
+	Message  string          `json:"message"`
+}
+
+// LSP DiagnosticSeverity to the TypeScript category names
+var lspSeverities = map[int]string{
+	1: "error",
+	2: "warning",
+	3: "message",
+	4: "suggestion",
+}
+
+// stays open until the server stops
+func (c *typeCheckClient) open(directory string, file string) error {
+	contents, err := fs.ReadFile(path.Join(directory, file))
+	if err != nil {
+		return err
+	}
+
+	return c.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{
+			"uri":        fileUri(path.Join(directory, file)),
+			"languageId": typeCheckLanguages[path.Ext(file)],
+			"version":    1,
+			"text":       string(contents),
+		},
+	})
+}
+
+func (c *typeCheckClient) fileDiagnostics(ctx context.Context, directory string, file string) ([]Diagnostic, error) {
+	result, err := c.request(ctx, "textDocument/diagnostic", map[string]any{
+		"textDocument": map[string]any{"uri": fileUri(path.Join(directory, file))},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := struct {
+		Items []lspDiagnostic `json:"items"`
+	}{}
+	err = json.Unmarshal(result, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	diagnostics := []Diagnostic{}
+	for _, d := range report.Items {
+		severity, ok := lspSeverities[d.Severity]
+		if !ok {
+			severity = "error"
+		}
+
+		code, _ := strconv.Atoi(strings.Trim(string(d.Code), `"`))
+
+		diagnostics = append(diagnostics, Diagnostic{
+			File:     file,
+			Start:    DiagnosticPosition(d.Range.Start),
+			End:      DiagnosticPosition(d.Range.End),
+			Code:     code,
+			Message:  d.Message,
+			Severity: severity,
+		})
+	}
+
+	return diagnostics, nil
+}
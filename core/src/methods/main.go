@@ -20,6 +20,7 @@ import (
 	setup "fullstackedorg/fullstacked/src/setup"
 	staticFiles "fullstackedorg/fullstacked/src/staticFiles"
 	utils "fullstackedorg/fullstacked/src/utils"
+	ws "fullstackedorg/fullstacked/src/ws"
 )
 
 type tsgo struct{}
@@ -37,12 +38,30 @@ const (
 	FS_EXISTS    = 8
 	FS_RENAME    = 9
 	FS_STAT      = 10
+	FS_SEARCH    = 11
+	FS_REPLACE   = 12
+	FS_WATCH     = 13
+	FS_UNWATCH   = 14
 
-	FETCH  = 15
-	FETCH2 = 16
+	FS_READDIR2           = 27
+	FS_EVENTS_SUBSCRIBE   = 28
+	FS_EVENTS_UNSUBSCRIBE = 29
 
-	CONNECT      = 20
-	CONNECT_SEND = 21
+	FETCH       = 15
+	FETCH2      = 16
+	FETCH2_BODY = 17
+
+	FETCH_COOKIES       = 18
+	FETCH_COOKIES_CLEAR = 19
+
+	FETCH_MOCK   = 24
+	FETCH_RECORD = 25
+	FETCH_REPLAY = 26
+
+	CONNECT       = 20
+	CONNECT_SEND  = 21
+	CONNECT_CLOSE = 22
+	CONNECT_CALL  = 23
 
 	ARCHIVE_UNZIP_BIN_TO_FILE  = 30
 	ARCHIVE_UNZIP_BIN_TO_BIN   = 31
@@ -86,14 +105,33 @@ const (
 	GIT_AUTH_RESPONSE = 81
 	GIT_HAS_GIT       = 82
 	GIT_REMOTE_URL    = 83
+	GIT_TAGS          = 84
+	GIT_TAG_CREATE    = 85
+	GIT_TAG_DELETE    = 86
+
+	GIT_REMOTES        = 110
+	GIT_REMOTE_ADD     = 111
+	GIT_REMOTE_RENAME  = 112
+	GIT_REMOTE_REMOVE  = 113
+	GIT_REMOTE_SET_URL = 114
+	GIT_BLAME          = 115
 
 	LSP_START     = 90
 	LSP_REQUEST   = 91
 	LSP_END       = 92
 	LSP_VERSION   = 93
 	LSP_AVAILABLE = 94
+	LSP_LIST      = 95
+	TYPECHECK     = 96
 
 	OPEN = 100
+
+	SERVER_START = 101
+	SERVER_STOP  = 102
+
+	WS_OPEN  = 103
+	WS_SEND  = 104
+	WS_CLOSE = 105
 )
 
 var EDITOR_ONLY = []int{
@@ -126,8 +164,20 @@ var EDITOR_ONLY = []int{
 	GIT_AUTH_RESPONSE,
 	// GIT_HAS_GIT,
 	// GIT_REMOTE_URL,
+	GIT_TAGS,
+	GIT_TAG_CREATE,
+	GIT_TAG_DELETE,
+	GIT_REMOTES,
+	GIT_REMOTE_ADD,
+	GIT_REMOTE_RENAME,
+	GIT_REMOTE_REMOVE,
+	GIT_REMOTE_SET_URL,
+	GIT_BLAME,
 
 	OPEN,
+
+	SERVER_START,
+	SERVER_STOP,
 }
 
 func Call(payload []byte) []byte {
@@ -164,14 +214,19 @@ func Call(payload []byte) []byte {
 			baseDir = setup.Directories.Editor
 		}
 		return staticFiles.Serve(baseDir, args[0].(string))
-	case method >= 2 && method <= 10:
-		return fsSwitch(method, baseDir, args)
+	case method >= 2 && method <= 14 || method == FS_READDIR2:
+		return fsSwitch(projectId, method, baseDir, args)
 	case method == FETCH:
 		headers := (map[string]string)(nil)
 		if args[3].(string) != "" {
 			_ = json.Unmarshal([]byte(args[3].(string)), &headers)
 		}
 
+		cookieJar := ""
+		if len(args) > 7 {
+			cookieJar = args[7].(string)
+		}
+
 		go fetch.FetchSerialized(
 			projectId,
 			args[0].(float64),
@@ -181,6 +236,7 @@ func Call(payload []byte) []byte {
 			args[4].([]byte),
 			int(args[5].(float64)),
 			args[6].(bool),
+			cookieJar,
 		)
 	case method == FETCH2:
 		headers := (map[string]string)(nil)
@@ -188,6 +244,15 @@ func Call(payload []byte) []byte {
 			_ = json.Unmarshal([]byte(args[3].(string)), &headers)
 		}
 
+		requestOptions := fetch.RequestOptions{}
+		if len(args) > 5 && args[5].(string) != "" {
+			_ = json.Unmarshal([]byte(args[5].(string)), &requestOptions)
+		}
+
+		if requestOptions.BodyStream {
+			fetch.OpenBodyStream(args[0].(float64))
+		}
+
 		go fetch.Fetch2(
 			projectId,
 			args[0].(float64),
@@ -195,13 +260,106 @@ func Call(payload []byte) []byte {
 			args[2].(string),
 			&headers,
 			args[4].([]byte),
+			baseDir,
+			requestOptions,
 		)
+	case method == FETCH2_BODY:
+		return fetch.WriteBodyStream(
+			args[0].(float64),
+			args[1].([]byte),
+			args[2].(bool),
+		)
+	case method == FETCH_COOKIES:
+		jarName := ""
+		if len(args) > 0 {
+			jarName = args[0].(string)
+		}
+		return fetch.CookiesSerialized(projectId, jarName)
+	case method == FETCH_COOKIES_CLEAR:
+		jarName := ""
+		if len(args) > 0 {
+			jarName = args[0].(string)
+		}
+		fetch.ClearCookies(projectId, jarName)
+	case method == FETCH_MOCK:
+		rules := []fetch.MockRule{}
+		if args[0].(string) != "" {
+			err := json.Unmarshal([]byte(args[0].(string)), &rules)
+			if err != nil {
+				return serialize.SerializeError(err)
+			}
+		}
+
+		err := fetch.SetMockRules(projectId, baseDir, rules)
+		if err != nil {
+			return serialize.SerializeError(err)
+		}
+	case method == FETCH_RECORD:
+		err := (error)(nil)
+		if args[0].(string) == "" {
+			err = fetch.StopRecording(projectId)
+		} else {
+			err = fetch.StartRecording(projectId, baseDir, args[0].(string))
+		}
+
+		if err != nil {
+			return serialize.SerializeError(err)
+		}
+	case method == FETCH_REPLAY:
+		err := fetch.Replay(projectId, baseDir, args[0].(string))
+		if err != nil {
+			return serialize.SerializeError(err)
+		}
 	case method == CONNECT:
-		channelId := connect.Connect(projectId, args[0].(string), args[1].(float64), args[2].(string), args[3].(bool))
+		reconnect := len(args) > 4 && args[4].(bool)
+		token := ""
+		if len(args) > 5 {
+			token = args[5].(string)
+		}
+		useTLS := len(args) > 6 && args[6].(bool)
+		tlsCA, tlsFingerprint := "", ""
+		if len(args) > 8 {
+			tlsCA = args[7].(string)
+			tlsFingerprint = args[8].(string)
+		}
+		channelId, err := connect.Connect(projectId, args[0].(string), args[1].(float64), args[2].(string), args[3].(bool), reconnect, token, useTLS, tlsCA, tlsFingerprint)
+		if err != nil {
+			return serialize.SerializeError(err)
+		}
 		return serialize.SerializeString(channelId)
 	case method == CONNECT_SEND:
 		connect.Send(args[0].(string), args[1].([]byte))
 		return nil
+	case method == CONNECT_CLOSE:
+		connect.Close(args[0].(string))
+		return nil
+	case method == CONNECT_CALL:
+		err := connect.Call(args[0].(string), args[1].(float64), args[3].(string), args[4:], args[2].(float64))
+		if err != nil {
+			return serialize.SerializeError(err)
+		}
+		return nil
+	case method == WS_OPEN:
+		headers := (map[string]string)(nil)
+		if args[1].(string) != "" {
+			_ = json.Unmarshal([]byte(args[1].(string)), &headers)
+		}
+
+		protocols := []string{}
+		for _, p := range args[2:] {
+			protocols = append(protocols, p.(string))
+		}
+
+		wsId := ws.Open(projectId, args[0].(string), headers, protocols)
+		return serialize.SerializeString(wsId)
+	case method == WS_SEND:
+		return ws.Send(args[0].(string), args[1])
+	case method == WS_CLOSE:
+		return ws.Close(args[0].(string), int(args[1].(float64)), args[2].(string))
+	case method == FS_EVENTS_SUBSCRIBE:
+		return fs.SubscribeSerialized(projectId, args[0].(string))
+	case method == FS_EVENTS_UNSUBSCRIBE:
+		fs.Unsubscribe(projectId)
 	case method == SET_TITLE:
 		setup.Callback(projectId, "title", args[0].(string))
 		return nil
@@ -260,7 +418,28 @@ func Call(payload []byte) []byte {
 	case method == OPEN:
 		setup.Callback("", "open", args[0].(string))
 		return nil
-	case method >= 70 && method <= 83:
+	case method == SERVER_START || method == SERVER_STOP:
+		serverProjectId := args[0].(string)
+		args = args[1:]
+
+		if method == SERVER_STOP {
+			staticFiles.StopServer(serverProjectId)
+			return nil
+		}
+
+		port, err := staticFiles.StartServer(
+			serverProjectId,
+			path.Join(setup.Directories.Root, serverProjectId),
+			args[1].(string),
+			int(args[0].(float64)),
+		)
+
+		if err != nil {
+			return serialize.SerializeError(err)
+		}
+
+		return serialize.SerializeNumber(float64(port))
+	case (method >= 70 && method <= 86) || (method >= 110 && method <= 115):
 		return gitSwitch(isEditor, projectId, method, args)
 	case method == FULLSTACKED_MODULES_FILE:
 		filePath := args[0].(string)
@@ -274,10 +453,10 @@ func Call(payload []byte) []byte {
 		}
 		return fs.ReadFileSerialized(filePathAbs, true)
 	case method == FULLSTACKED_MODULES_LIST:
-		return fs.ReadDirSerialized(path.Join(setup.Directories.Editor, "fullstacked_modules"), true, false, false, []string{})
+		return fs.ReadDirSerialized(path.Join(setup.Directories.Editor, "fullstacked_modules"), true, false, false, nil, nil)
 	case method == LSP_START:
 		if TSGOptr != nil {
-			return serialize.SerializeString((*TSGOptr).start(path.Join(setup.Directories.Root, args[0].(string))))
+			return serialize.SerializeString((*TSGOptr).start(args[0].(string), path.Join(setup.Directories.Root, args[0].(string))))
 		}
 	case method == LSP_REQUEST:
 		if TSGOptr != nil {
@@ -293,12 +472,74 @@ func Call(payload []byte) []byte {
 		}
 	case method == LSP_AVAILABLE:
 		return serialize.SerializeBoolean(TSGOptr != nil)
+	case method == LSP_LIST:
+		if TSGOptr != nil {
+			return serialize.SerializeArgs((*TSGOptr).list())
+		}
+	case method == TYPECHECK:
+		if TSGOptr == nil {
+			return serialize.SerializeError(errors.New("typecheck is not available in this build"))
+		}
+
+		checkProjectId := projectId
+		checkId := 0.0
+
+		if isEditor {
+			checkProjectId = args[0].(string)
+			checkId = args[1].(float64)
+		} else {
+			checkId = args[0].(float64)
+		}
+
+		// result is sent to "typecheck"
+		go func() {
+			result := (*TSGOptr).typecheck(checkProjectId, path.Join(setup.Directories.Root, checkProjectId), checkId)
+			setup.Callback(projectId, "typecheck", result)
+		}()
 	}
 
 	return nil
 }
 
-func fsSwitch(method int, baseDir string, args []any) []byte {
+// variadic skip args were path prefixes from the root,
+// plain names stay anchored there, e.g. "data" => "/data"
+func skipPatterns(args []any) []string {
+	skip := []string{}
+	for _, arg := range args {
+		pattern := arg.(string)
+		negate := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if pattern == "" {
+			continue
+		}
+		if !strings.ContainsAny(pattern, "/*?[") {
+			pattern = "/" + pattern
+		}
+		if negate {
+			pattern = "!" + pattern
+		}
+		skip = append(skip, pattern)
+	}
+	return skip
+}
+
+// glob patterns as a JSON array of strings, empty for none
+func globPatterns(arg any) ([]string, error) {
+	data, ok := arg.(string)
+	if !ok {
+		return nil, errors.New("not a string")
+	}
+
+	patterns := []string{}
+	if data == "" {
+		return patterns, nil
+	}
+
+	err := json.Unmarshal([]byte(data), &patterns)
+	return patterns, err
+}
+
+func fsSwitch(projectId string, method int, baseDir string, args []any) []byte {
 	fileName := ""
 	if args[0] != nil {
 		fileName = args[0].(string)
@@ -328,11 +569,22 @@ func fsSwitch(method int, baseDir string, args []any) []byte {
 	case FS_READDIR:
 		skip := []string{}
 		if len(args) > 3 {
-			for _, arg := range args[4:] {
-				skip = append(skip, arg.(string))
-			}
+			skip = skipPatterns(args[4:])
+		}
+		return fs.ReadDirSerialized(filePath, args[1].(bool), args[2].(bool), args[3].(bool), skip, nil)
+	case FS_READDIR2:
+		if len(args) != 6 {
+			return serialize.SerializeError(errors.New("readdir expects skip and include patterns"))
 		}
-		return fs.ReadDirSerialized(filePath, args[1].(bool), args[2].(bool), args[3].(bool), skip)
+		skip, err := globPatterns(args[4])
+		if err != nil {
+			return serialize.SerializeError(errors.New("invalid skip patterns: " + err.Error()))
+		}
+		include, err := globPatterns(args[5])
+		if err != nil {
+			return serialize.SerializeError(errors.New("invalid include patterns: " + err.Error()))
+		}
+		return fs.ReadDirSerialized(filePath, args[1].(bool), args[2].(bool), args[3].(bool), skip, include)
 	case FS_MKDIR:
 		fileEventOrigin := ""
 		if len(args) > 1 {
@@ -356,6 +608,33 @@ func fsSwitch(method int, baseDir string, args []any) []byte {
 		return fs.RenameSerialized(filePath, newPath, fileEventOrigin)
 	case FS_STAT:
 		return fs.StatSerialized(filePath)
+	case FS_SEARCH:
+		options := fs.SearchOptions{}
+		err := json.Unmarshal([]byte(args[2].(string)), &options)
+		if err != nil {
+			return serialize.SerializeError(err)
+		}
+
+		// results are sent to "fs-search"
+		go fs.SearchAsync(projectId, filePath, options, args[1].(float64))
+	case FS_REPLACE:
+		options := fs.SearchOptions{}
+		err := json.Unmarshal([]byte(args[2].(string)), &options)
+		if err != nil {
+			return serialize.SerializeError(err)
+		}
+
+		fileEventOrigin := ""
+		if len(args) > 4 {
+			fileEventOrigin = args[4].(string)
+		}
+
+		// the result is sent to "fs-replace"
+		go fs.ReplaceAsync(projectId, filePath, options, args[3].(string), fileEventOrigin, args[1].(float64))
+	case FS_WATCH:
+		return fs.WatchSerialized(filePath)
+	case FS_UNWATCH:
+		fs.Unwatch(filePath)
 	}
 
 	return nil
@@ -369,6 +648,14 @@ func gitSwitch(isEditor bool, projectId string, method int, args []any) []byte {
 		directory = path.Join(setup.Directories.Root, args[0].(string))
 	}
 
+	// optional remote name as trailing argument
+	remoteName := func(i int) string {
+		if len(args) > i && args[i] != nil {
+			return args[i].(string)
+		}
+		return ""
+	}
+
 	switch method {
 	case GIT_CLONE:
 		go git.Clone(directory, args[1].(string))
@@ -377,9 +664,13 @@ func gitSwitch(isEditor bool, projectId string, method int, args []any) []byte {
 	case GIT_STATUS:
 		return git.Status(directory)
 	case GIT_PULL:
-		go git.Pull(directory, isEditor, projectId)
+		go git.Pull(directory, isEditor, projectId, remoteName(1))
 	case GIT_PUSH:
-		go git.Push(directory)
+		pushOptions := git.PushOptions{}
+		if len(args) > 1 && args[1].(string) != "" {
+			_ = json.Unmarshal([]byte(args[1].(string)), &pushOptions)
+		}
+		go git.Push(directory, pushOptions)
 	case GIT_RESTORE:
 		files := []string{}
 		for _, file := range args[1:] {
@@ -387,13 +678,13 @@ func gitSwitch(isEditor bool, projectId string, method int, args []any) []byte {
 		}
 		return git.Restore(directory, files)
 	case GIT_CHECKOUT:
-		return git.Checkout(directory, args[1].(string), args[2].(bool))
+		return git.Checkout(directory, args[1].(string), args[2].(bool), remoteName(3))
 	case GIT_FETCH:
-		return git.Fetch(directory)
+		return git.Fetch(directory, remoteName(1))
 	case GIT_COMMIT:
 		return git.Commit(directory, args[1].(string), args[2].(string), args[3].(string))
 	case GIT_BRANCHES:
-		return git.Branches(directory)
+		return git.Branches(directory, remoteName(1))
 	case GIT_BRANCH_DELETE:
 		return git.BranchDelete(directory, args[1].(string))
 	case GIT_AUTH_RESPONSE:
@@ -401,7 +692,25 @@ func gitSwitch(isEditor bool, projectId string, method int, args []any) []byte {
 	case GIT_HAS_GIT:
 		return serialize.SerializeBoolean(git.HasGit(directory))
 	case GIT_REMOTE_URL:
-		return serialize.SerializeString(git.RemoteURL(directory))
+		return serialize.SerializeString(git.RemoteURL(directory, remoteName(1)))
+	case GIT_TAGS:
+		return git.Tags(directory)
+	case GIT_TAG_CREATE:
+		return git.TagCreate(directory, args[1].(string), args[2].(string), args[3].(string), args[4].(string), args[5].(string))
+	case GIT_TAG_DELETE:
+		return git.TagDelete(directory, args[1].(string))
+	case GIT_REMOTES:
+		return git.Remotes(directory)
+	case GIT_REMOTE_ADD:
+		return git.RemoteAdd(directory, args[1].(string), args[2].(string))
+	case GIT_REMOTE_RENAME:
+		return git.RemoteRename(directory, args[1].(string), args[2].(string))
+	case GIT_REMOTE_REMOVE:
+		return git.RemoteRemove(directory, args[1].(string))
+	case GIT_REMOTE_SET_URL:
+		return git.RemoteSetURL(directory, args[1].(string), args[2].(string))
+	case GIT_BLAME:
+		return git.Blame(directory, args[1].(string))
 	}
 
 	return nil
@@ -441,18 +750,14 @@ func archiveSwitch(isEditor bool, method int, baseDir string, args []any) []byte
 		out := path.Join(baseDir, args[1].(string))
 		skip := []string{}
 		if len(args) > 2 {
-			for i := 2; i < len(args); i++ {
-				skip = append(skip, args[i].(string))
-			}
+			skip = skipPatterns(args[2:])
 		}
 		return archive.ZipFileToFileSerialized(entry, out, skip)
 	case ARCHIVE_ZIP_FILE_TO_BIN:
 		entry := path.Join(baseDir, args[0].(string))
 		skip := []string{}
 		if len(args) > 1 {
-			for i := 1; i < len(args); i++ {
-				skip = append(skip, args[i].(string))
-			}
+			skip = skipPatterns(args[1:])
 		}
 		return archive.ZipFileToDataSerialized(entry, skip)
 	}
@@ -5,7 +5,7 @@ package methods
 
 var TSGOptr = (*tsgo)(nil)
 
-func (t *tsgo) start(directory string) string {
+func (t *tsgo) start(projectId string, directory string) string {
 	return ""
 }
 func (t *tsgo) request(transportId string, message string) {
@@ -15,3 +15,9 @@ func (t *tsgo) end(transportId string) {
 func (t *tsgo) version() string {
 	return ""
 }
+func (t *tsgo) list() []any {
+	return []any{}
+}
+func (t *tsgo) typecheck(projectId string, directory string, id float64) string {
+	return ""
+}
@@ -4,14 +4,15 @@
 package methods
 
 import (
+	"encoding/json"
 	ts_lsp "fullstackedorg/fullstacked/src/lsp"
 )
 
 var TSGO = tsgo{}
 var TSGOptr = &TSGO
 
-func (t *tsgo) start(directory string) string {
-	return ts_lsp.Start(directory)
+func (t *tsgo) start(projectId string, directory string) string {
+	return ts_lsp.Start(projectId, directory)
 }
 func (t *tsgo) request(transportId string, message string) {
 	ts_lsp.Request(transportId, message)
@@ -22,3 +23,10 @@ func (t *tsgo) end(transportId string) {
 func (t *tsgo) version() string {
 	return ts_lsp.Version()
 }
+func (t *tsgo) list() []any {
+	return ts_lsp.List()
+}
+func (t *tsgo) typecheck(projectId string, directory string, id float64) string {
+	result, _ := json.Marshal(ts_lsp.TypeCheck(projectId, directory, id))
+	return string(result)
+}
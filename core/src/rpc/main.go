@@ -0,0 +1,227 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	serialize "fullstackedorg/fullstacked/src/serialize"
+)
+
+// Request/response over connect channel frames,
+// multiplexed by call id:
+//   - ["call", id, method, ...args]
+//   - ["result", id, ...results]
+//   - ["error", id, message]
+// Channel frames are [4 bytes body length][body],
+// rpc frames set the high bit of the length,
+// so regular channel data is never mistaken for rpc.
+
+// uint32, 1 << 31 overflows int on 32-bit targets
+const frameFlag uint32 = 1 << 31
+
+const (
+	KindCall   = "call"
+	KindResult = "result"
+	KindError  = "error"
+)
+
+var ErrTimeout = errors.New("rpc call timed out")
+
+type Message struct {
+	Kind   string
+	Id     float64
+	Method string
+	// call args, or results
+	Args []any
+}
+
+// body length and rpc flag of a frame header
+func ParseHeader(header []byte) (int, bool) {
+	length := binary.BigEndian.Uint32(header[0:4])
+	return int(length &^ frameFlag), length&frameFlag != 0
+}
+
+// serialized rpc frame, header included
+func Frame(args []any) []byte {
+	body := serialize.SerializeArgs(args)
+	header := binary.BigEndian.AppendUint32(nil, uint32(len(body))|frameFlag)
+	return append(header, body...)
+}
+
+// body of an rpc frame
+func Parse(args []any) (Message, bool) {
+	msg := Message{}
+
+	if len(args) < 2 {
+		return msg, false
+	}
+
+	kind, ok := args[0].(string)
+	if !ok {
+		return msg, false
+	}
+
+	id, ok := args[1].(float64)
+	if !ok {
+		return msg, false
+	}
+
+	msg.Kind = kind
+	msg.Id = id
+
+	switch kind {
+	case KindCall:
+		if len(args) < 3 {
+			return msg, false
+		}
+		method, ok := args[2].(string)
+		if !ok {
+			return msg, false
+		}
+		msg.Method = method
+		msg.Args = args[3:]
+	case KindResult, KindError:
+		msg.Args = args[2:]
+	default:
+		return msg, false
+	}
+
+	return msg, true
+}
+
+func CallFrame(id float64, method string, args []any) []byte {
+	return Frame(append([]any{KindCall, id, method}, args...))
+}
+
+func ResultFrame(id float64, results []any) []byte {
+	return Frame(append([]any{KindResult, id}, results...))
+}
+
+func ErrorFrame(id float64, message string) []byte {
+	return Frame([]any{KindError, id, message})
+}
+
+// error message of an error frame
+func (msg Message) Err() error {
+	if msg.Kind != KindError {
+		return nil
+	}
+
+	message := "rpc error"
+	if len(msg.Args) > 0 {
+		if m, ok := msg.Args[0].(string); ok {
+			message = m
+		}
+	}
+
+	return errors.New(message)
+}
+
+type Handler func(args []any) ([]any, error)
+
+// runs the handler and replies with its result,
+// unknown methods reply with an error
+func Serve(msg Message, handler Handler, reply func([]byte) error) {
+	if handler == nil {
+		reply(ErrorFrame(msg.Id, "unknown method ["+msg.Method+"]"))
+		return
+	}
+
+	results, err := handler(msg.Args)
+	if err != nil {
+		reply(ErrorFrame(msg.Id, err.Error()))
+		return
+	}
+
+	reply(ResultFrame(msg.Id, results))
+}
+
+// in-flight calls of one peer
+type Calls struct {
+	mutex   sync.Mutex
+	nextId  float64
+	pending map[float64]chan Message
+}
+
+// blocks until the result, an error or the timeout,
+// 0 waits until resolved or cancelled
+func (c *Calls) Call(send func([]byte) error, method string, args []any, timeout time.Duration) ([]any, error) {
+	response := make(chan Message, 1)
+
+	c.mutex.Lock()
+	if c.pending == nil {
+		c.pending = map[float64]chan Message{}
+	}
+	id := c.nextId
+	c.nextId++
+	c.pending[id] = response
+	c.mutex.Unlock()
+
+	err := send(CallFrame(id, method, args))
+	if err != nil {
+		c.remove(id)
+		return nil, err
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case msg := <-response:
+		if msg.Kind == KindError {
+			return nil, msg.Err()
+		}
+		return msg.Args, nil
+	case <-expired:
+		c.remove(id)
+		return nil, ErrTimeout
+	}
+}
+
+func (c *Calls) remove(id float64) {
+	c.mutex.Lock()
+	delete(c.pending, id)
+	c.mutex.Unlock()
+}
+
+// delivers a result or error frame,
+// false if no call is waiting for it
+func (c *Calls) Resolve(msg Message) bool {
+	if msg.Kind != KindResult && msg.Kind != KindError {
+		return false
+	}
+
+	c.mutex.Lock()
+	response, ok := c.pending[msg.Id]
+	delete(c.pending, msg.Id)
+	c.mutex.Unlock()
+
+	if ok {
+		response <- msg
+	}
+
+	return ok
+}
+
+// fails all in-flight calls,
+// used when the connection drops
+func (c *Calls) Cancel(reason string) {
+	c.mutex.Lock()
+	pending := c.pending
+	c.pending = nil
+	c.mutex.Unlock()
+
+	for id, response := range pending {
+		response <- Message{
+			Kind: KindError,
+			Id:   id,
+			Args: []any{reason},
+		}
+	}
+}
@@ -11,13 +11,22 @@ import (
 	serialize "fullstackedorg/fullstacked/src/serialize"
 )
 
-func Serve(baseDir string, filePath string) []byte {
+// resolves a request path in the project directory,
+// the .build directory has precedence
+func resolve(baseDir string, filePath string) (string, bool, bool) {
 	filePath, _ = url.PathUnescape(filePath)
 	filePath = strings.TrimLeft(filePath, "/")
 	filePath = strings.TrimRight(filePath, "/")
 
 	// check if file exists
 	filePathAbs := path.Join(baseDir, filePath)
+
+	// stay in baseDir, not in a sibling sharing its prefix
+	baseDir = path.Clean(baseDir)
+	if filePathAbs != baseDir && !strings.HasPrefix(filePathAbs, baseDir+"/") {
+		return "", false, false
+	}
+
 	exists, isFile := fs.Exists(filePathAbs)
 
 	// then try in .build directory,
@@ -31,20 +40,10 @@ func Serve(baseDir string, filePath string) []byte {
 		exists = buildFileExists
 	}
 
-	if !exists {
-		return nil
-	}
-
-	// path is directory,
-	// look for index.html
-	// if exists, parse and inject `<script type="module" src="/index.js"></script>`
-	// else, send base HTML index file that includes `<script type="module" src="/index.js"></script>`
-	if !isFile {
-		data := serialize.SerializeString("text/html")
-		data = append(data, serialize.SerializeBuffer(build.SetupHTML(path.Join(filePathAbs, "index.html")))...)
-		return data
-	}
+	return filePathAbs, exists, isFile
+}
 
+func mimeType(filePathAbs string) string {
 	fileExtComponents := strings.Split(filePathAbs, ".")
 	ext := fileExtComponents[len(fileExtComponents)-1]
 
@@ -62,7 +61,27 @@ func Serve(baseDir string, filePath string) []byte {
 		mimeType = "text/plain"
 	}
 
-	data := serialize.SerializeString(mimeType)
+	return mimeType
+}
+
+func Serve(baseDir string, filePath string) []byte {
+	filePathAbs, exists, isFile := resolve(baseDir, filePath)
+
+	if !exists {
+		return nil
+	}
+
+	// path is directory,
+	// look for index.html
+	// if exists, parse and inject `<script type="module" src="/index.js"></script>`
+	// else, send base HTML index file that includes `<script type="module" src="/index.js"></script>`
+	if !isFile {
+		data := serialize.SerializeString("text/html")
+		data = append(data, serialize.SerializeBuffer(build.SetupHTML(path.Join(filePathAbs, "index.html")))...)
+		return data
+	}
+
+	data := serialize.SerializeString(mimeType(filePathAbs))
 	data = append(data, fs.ReadFileSerialized(filePathAbs, false)...)
 
 	return data
@@ -0,0 +1,141 @@
+package staticFiles
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fullstackedorg/fullstacked/src/build"
+	fs "fullstackedorg/fullstacked/src/fs"
+)
+
+// Serves a project like Serve does, over http,
+// to open the app in external browsers.
+// One server per project, started by the editor.
+// The dot directories (.git, .build, ...) and data
+// are never served, the server can be reachable from the LAN
+
+var serversMutex = sync.Mutex{}
+var servers = map[string]*http.Server{}
+
+type handler struct {
+	baseDir string
+}
+
+func denied(requestPath string) bool {
+	requestPath, _ = url.PathUnescape(requestPath)
+	components := strings.Split(strings.Trim(path.Clean("/"+requestPath), "/"), "/")
+
+	if components[0] == "data" {
+		return true
+	}
+
+	for _, component := range components {
+		if strings.HasPrefix(component, ".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if denied(r.URL.EscapedPath()) {
+		http.NotFound(w, r)
+		return
+	}
+
+	// always serve the latest build
+	w.Header().Set("Cache-Control", "no-cache")
+
+	filePathAbs, exists, isFile := resolve(h.baseDir, r.URL.EscapedPath())
+
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !isFile {
+		html := build.SetupHTML(path.Join(filePathAbs, "index.html"))
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", strconv.Itoa(len(html)))
+		if r.Method == http.MethodGet {
+			w.Write(html)
+		}
+		return
+	}
+
+	file, size, err := fs.Open(filePathAbs)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	defer file.Close()
+
+	w.Header().Set("Content-Type", mimeType(filePathAbs))
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+
+	if r.Method == http.MethodGet {
+		io.Copy(w, file)
+	}
+}
+
+// port 0 picks a free port,
+// returns the port listened to
+func StartServer(projectId string, baseDir string, host string, port int) (int, error) {
+	StopServer(projectId)
+
+	if host == "" {
+		host = "localhost"
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+
+	if err != nil {
+		return 0, err
+	}
+
+	server := &http.Server{
+		Handler: &handler{
+			baseDir: baseDir,
+		},
+		ReadHeaderTimeout: time.Second * 10,
+	}
+
+	serversMutex.Lock()
+	servers[projectId] = server
+	serversMutex.Unlock()
+
+	go server.Serve(listener)
+
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+func StopServer(projectId string) {
+	serversMutex.Lock()
+	server, ok := servers[projectId]
+	delete(servers, projectId)
+	serversMutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	server.Shutdown(ctx)
+}
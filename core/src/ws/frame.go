@@ -0,0 +1,241 @@
+package ws
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RFC 6455 client side only.
+// golang.org/x/net/websocket drops the code and reason of
+// the close frames it receives and always closes with 1000,
+// the close event and WS_CLOSE need both
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+const (
+	CLOSE_NORMAL         = 1000
+	CLOSE_NO_STATUS      = 1005
+	CLOSE_ABNORMAL       = 1006
+	CLOSE_TOO_BIG        = 1009
+	CLOSE_PROTOCOL_ERROR = 1002
+)
+
+var maxMessageSize = 64 << 20 // 64MB
+
+var dialTimeout = time.Second * 30
+
+var acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func dial(u *url.URL) (net.Conn, error) {
+	host := u.Hostname()
+	port := u.Port()
+
+	switch u.Scheme {
+	case "ws":
+		if port == "" {
+			port = "80"
+		}
+		return net.DialTimeout("tcp", net.JoinHostPort(host, port), dialTimeout)
+	case "wss":
+		if port == "" {
+			port = "443"
+		}
+		dialer := &net.Dialer{Timeout: dialTimeout}
+		return tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host, port), &tls.Config{
+			ServerName: host,
+		})
+	}
+
+	return nil, errors.New("unsupported scheme: " + u.Scheme)
+}
+
+// returns the negotiated sub-protocol
+func handshake(conn net.Conn, reader *bufio.Reader, u *url.URL, headers map[string]string, protocols []string) (string, error) {
+	keyBytes := make([]byte, 16)
+	rand.Read(keyBytes)
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+
+	httpUrl := *u
+	if u.Scheme == "wss" {
+		httpUrl.Scheme = "https"
+	} else {
+		httpUrl.Scheme = "http"
+	}
+
+	request, err := http.NewRequest("GET", httpUrl.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Sec-WebSocket-Key", key)
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	if len(protocols) > 0 {
+		request.Header.Set("Sec-WebSocket-Protocol", strings.Join(protocols, ", "))
+	}
+
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	err = request.Write(conn)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		return "", errors.New("unexpected response status: " + response.Status)
+	}
+
+	if !strings.EqualFold(response.Header.Get("Upgrade"), "websocket") ||
+		response.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return "", errors.New("invalid upgrade response")
+	}
+
+	return response.Header.Get("Sec-WebSocket-Protocol"), nil
+}
+
+// client frames are always masked
+func writeFrame(w io.Writer, opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+
+	length := len(payload)
+	switch {
+	case length < 126:
+		header = append(header, 0x80|byte(length))
+	case length <= 0xFFFF:
+		header = append(header, 0x80|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header = append(header, 0x80|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	mask := make([]byte, 4)
+	rand.Read(mask)
+	header = append(header, mask...)
+
+	masked := make([]byte, length)
+	for i := range payload {
+		masked[i] = payload[i] ^ mask[i%4]
+	}
+
+	_, err := w.Write(append(header, masked...))
+	return err
+}
+
+type frame struct {
+	fin     bool
+	opcode  byte
+	payload []byte
+}
+
+func readFrame(r io.Reader) (*frame, error) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &frame{
+		fin:    header[0]&0x80 != 0,
+		opcode: header[0] & 0x0F,
+	}
+
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		_, err = io.ReadFull(r, ext)
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		_, err = io.ReadFull(r, ext)
+		length = binary.BigEndian.Uint64(ext)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if length > uint64(maxMessageSize) {
+		return nil, errMessageTooBig
+	}
+
+	mask := make([]byte, 4)
+	if masked {
+		_, err = io.ReadFull(r, mask)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f.payload = make([]byte, length)
+	_, err = io.ReadFull(r, f.payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if masked {
+		for i := range f.payload {
+			f.payload[i] ^= mask[i%4]
+		}
+	}
+
+	return f, nil
+}
+
+var errMessageTooBig = errors.New("message too big")
+
+func closePayload(code int, reason string) []byte {
+	if code == CLOSE_NO_STATUS {
+		return nil
+	}
+
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	return append(payload, []byte(reason)...)
+}
+
+func parseClosePayload(payload []byte) (int, string) {
+	if len(payload) < 2 {
+		return CLOSE_NO_STATUS, ""
+	}
+
+	return int(binary.BigEndian.Uint16(payload[:2])), string(payload[2:])
+}
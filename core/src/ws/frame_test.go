@@ -0,0 +1,128 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestWriteFrameMasksPayload(t *testing.T) {
+	payload := []byte("hello websocket")
+
+	buffer := &bytes.Buffer{}
+	err := writeFrame(buffer, opText, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := buffer.Bytes()
+
+	if data[0] != 0x80|opText {
+		t.Fatalf("expected FIN and text opcode, got %#x", data[0])
+	}
+
+	if data[1]&0x80 == 0 {
+		t.Fatal("client frames must be masked")
+	}
+
+	if int(data[1]&0x7F) != len(payload) {
+		t.Fatalf("expected length %d, got %d", len(payload), data[1]&0x7F)
+	}
+
+	mask := data[2:6]
+	masked := data[6:]
+
+	if bytes.Equal(masked, payload) {
+		t.Fatal("payload is sent unmasked")
+	}
+
+	for i := range masked {
+		if masked[i]^mask[i%4] != payload[i] {
+			t.Fatalf("wrong masking at byte %d", i)
+		}
+	}
+
+	f, err := readFrame(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !f.fin || f.opcode != opText || !bytes.Equal(f.payload, payload) {
+		t.Fatalf("unexpected frame %+v", f)
+	}
+}
+
+func TestFrameLengths(t *testing.T) {
+	for _, length := range []int{0, 125, 126, 0xFFFF, 0x10000} {
+		payload := bytes.Repeat([]byte{'a'}, length)
+
+		buffer := &bytes.Buffer{}
+		err := writeFrame(buffer, opBinary, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lengthByte := buffer.Bytes()[1] & 0x7F
+		switch {
+		case length < 126 && int(lengthByte) != length,
+			length >= 126 && length <= 0xFFFF && lengthByte != 126,
+			length > 0xFFFF && lengthByte != 127:
+			t.Fatalf("length %d encoded as %d", length, lengthByte)
+		}
+
+		f, err := readFrame(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(f.payload) != length {
+			t.Fatalf("expected %d bytes, got %d", length, len(f.payload))
+		}
+	}
+}
+
+func TestReadFrameUnmasked(t *testing.T) {
+	data := append([]byte{0x00 | opText, 3}, []byte("abc")...)
+
+	f, err := readFrame(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.fin || f.opcode != opText || string(f.payload) != "abc" {
+		t.Fatalf("unexpected frame %+v", f)
+	}
+}
+
+func TestReadFrameTooBig(t *testing.T) {
+	data := []byte{0x80 | opBinary, 127}
+	data = binary.BigEndian.AppendUint64(data, uint64(maxMessageSize)+1)
+
+	_, err := readFrame(bytes.NewReader(data))
+	if err != errMessageTooBig {
+		t.Fatalf("expected errMessageTooBig, got %v", err)
+	}
+}
+
+func TestClosePayload(t *testing.T) {
+	code, reason := parseClosePayload(closePayload(CLOSE_NORMAL, "bye"))
+	if code != CLOSE_NORMAL || reason != "bye" {
+		t.Fatalf("got %d %q", code, reason)
+	}
+
+	if closePayload(CLOSE_NO_STATUS, "") != nil {
+		t.Fatal("no status must send an empty close payload")
+	}
+
+	code, reason = parseClosePayload(nil)
+	if code != CLOSE_NO_STATUS || reason != "" {
+		t.Fatalf("got %d %q", code, reason)
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// RFC 6455 section 1.3
+	if acceptKey("dGhlIHNhbXBsZSBub25jZQ==") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatal("wrong accept key")
+	}
+}
@@ -0,0 +1,292 @@
+package ws
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	serialize "fullstackedorg/fullstacked/src/serialize"
+	setup "fullstackedorg/fullstacked/src/setup"
+	utils "fullstackedorg/fullstacked/src/utils"
+)
+
+// WebSocket client connections.
+// Events are sent to "ws-<id>" as [event, ...args]
+//   - ["open", protocol]
+//   - ["message", data] data is a string for text messages
+//   - ["error", message]
+//   - ["close", code, reason]
+//
+// In WASM, there are no raw sockets and opening fails with an error event
+
+type Conn struct {
+	ProjectId string
+	Id        string
+
+	conn       net.Conn
+	writeMutex sync.Mutex
+	closeSent  bool
+}
+
+var connsMutex = sync.Mutex{}
+var conns = map[string]*Conn{}
+
+var closeTimeout = time.Second * 5
+
+func Open(
+	projectId string,
+	rawUrl string,
+	headers map[string]string,
+	protocols []string,
+) string {
+	c := &Conn{
+		ProjectId: projectId,
+		Id:        utils.RandString(6),
+	}
+
+	connsMutex.Lock()
+	conns[c.Id] = c
+	connsMutex.Unlock()
+
+	go c.start(rawUrl, headers, protocols)
+
+	return c.Id
+}
+
+func getConn(id string) (*Conn, error) {
+	connsMutex.Lock()
+	c, ok := conns[id]
+	connsMutex.Unlock()
+
+	if !ok {
+		return nil, errors.New("unknown websocket")
+	}
+
+	return c, nil
+}
+
+func Send(id string, data any) []byte {
+	c, err := getConn(id)
+
+	if err != nil {
+		return serialize.SerializeError(err)
+	}
+
+	switch d := data.(type) {
+	case string:
+		err = c.write(opText, []byte(d))
+	case []byte:
+		err = c.write(opBinary, d)
+	default:
+		err = errors.New("unsupported data type")
+	}
+
+	if err != nil {
+		return serialize.SerializeError(err)
+	}
+
+	return nil
+}
+
+// the connection closes once the server replies
+// or after 5s without reply
+func Close(id string, code int, reason string) []byte {
+	c, err := getConn(id)
+
+	if err != nil {
+		return serialize.SerializeError(err)
+	}
+
+	if code == 0 {
+		code = CLOSE_NORMAL
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	// still connecting or already closing
+	if c.conn == nil || c.closeSent {
+		c.closeSent = true
+		return nil
+	}
+
+	c.closeSent = true
+
+	err = writeFrame(c.conn, opClose, closePayload(code, reason))
+
+	if err != nil {
+		return serialize.SerializeError(err)
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(closeTimeout))
+
+	return nil
+}
+
+func (c *Conn) write(opcode byte, payload []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if c.conn == nil {
+		return errors.New("websocket is not open")
+	}
+
+	if c.closeSent && opcode != opClose {
+		return errors.New("websocket is closing")
+	}
+
+	return writeFrame(c.conn, opcode, payload)
+}
+
+func (c *Conn) emit(args ...any) {
+	data := []byte{}
+
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			data = append(data, serialize.SerializeString(v)...)
+		case int:
+			data = append(data, serialize.SerializeNumber(float64(v))...)
+		case []byte:
+			data = append(data, serialize.SerializeBuffer(v)...)
+		}
+	}
+
+	setup.Callback(c.ProjectId, "ws-"+c.Id, base64.StdEncoding.EncodeToString(data))
+}
+
+func (c *Conn) end(code int, reason string) {
+	connsMutex.Lock()
+	delete(conns, c.Id)
+	connsMutex.Unlock()
+
+	if c.conn != nil {
+		c.conn.Close()
+	}
+
+	c.emit("close", code, reason)
+}
+
+func (c *Conn) fail(err error) {
+	c.emit("error", err.Error())
+	c.end(CLOSE_ABNORMAL, "")
+}
+
+func (c *Conn) start(rawUrl string, headers map[string]string, protocols []string) {
+	u, err := url.Parse(rawUrl)
+
+	if err != nil {
+		c.fail(err)
+		return
+	}
+
+	conn, err := dial(u)
+
+	if err != nil {
+		c.fail(err)
+		return
+	}
+
+	reader := bufio.NewReader(conn)
+
+	protocol, err := handshake(conn, reader, u, headers, protocols)
+
+	if err != nil {
+		conn.Close()
+		c.fail(err)
+		return
+	}
+
+	c.writeMutex.Lock()
+	c.conn = conn
+	closeSent := c.closeSent
+	c.writeMutex.Unlock()
+
+	// closed while connecting
+	if closeSent {
+		c.end(CLOSE_ABNORMAL, "")
+		return
+	}
+
+	c.emit("open", protocol)
+
+	c.receive(reader)
+}
+
+func (c *Conn) receive(reader *bufio.Reader) {
+	message := []byte{}
+	messageOpcode := byte(0)
+
+	for {
+		f, err := readFrame(reader)
+
+		if err != nil {
+			c.writeMutex.Lock()
+			closeSent := c.closeSent
+			c.writeMutex.Unlock()
+
+			if err == errMessageTooBig {
+				c.write(opClose, closePayload(CLOSE_TOO_BIG, ""))
+				c.end(CLOSE_TOO_BIG, "")
+			} else if closeSent {
+				// no close reply from the server
+				c.end(CLOSE_ABNORMAL, "")
+			} else {
+				c.fail(err)
+			}
+			return
+		}
+
+		switch f.opcode {
+		case opText, opBinary, opContinuation:
+			if f.opcode != opContinuation {
+				message = []byte{}
+				messageOpcode = f.opcode
+			}
+
+			message = append(message, f.payload...)
+
+			if len(message) > maxMessageSize {
+				c.write(opClose, closePayload(CLOSE_TOO_BIG, ""))
+				c.end(CLOSE_TOO_BIG, "")
+				return
+			}
+
+			if !f.fin {
+				continue
+			}
+
+			if messageOpcode == opText {
+				c.emit("message", string(message))
+			} else {
+				c.emit("message", message)
+			}
+		case opPing:
+			c.write(opPong, f.payload)
+		case opPong:
+		case opClose:
+			code, reason := parseClosePayload(f.payload)
+
+			c.writeMutex.Lock()
+			closeSent := c.closeSent
+			c.closeSent = true
+			c.writeMutex.Unlock()
+
+			// echo the close frame
+			if !closeSent {
+				c.write(opClose, closePayload(code, ""))
+			}
+
+			c.end(code, reason)
+			return
+		default:
+			c.write(opClose, closePayload(CLOSE_PROTOCOL_ERROR, ""))
+			c.end(CLOSE_PROTOCOL_ERROR, "")
+			return
+		}
+	}
+}
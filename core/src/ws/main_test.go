@@ -0,0 +1,242 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	serialize "fullstackedorg/fullstacked/src/serialize"
+	setup "fullstackedorg/fullstacked/src/setup"
+)
+
+type event struct {
+	name string
+	args []any
+}
+
+func captureEvents(t *testing.T) chan event {
+	events := make(chan event, 64)
+
+	setup.Callback = func(projectId string, messageType string, message string) {
+		data, err := base64.StdEncoding.DecodeString(message)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		args := serialize.DeserializeArgs(data)
+		events <- event{name: args[0].(string), args: args[1:]}
+	}
+	t.Cleanup(func() { setup.Callback = nil })
+
+	return events
+}
+
+func nextEvent(t *testing.T, events chan event) event {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+	return event{}
+}
+
+// server frames are never masked
+func serverFrame(conn net.Conn, fin bool, opcode byte, payload []byte) {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	conn.Write(append([]byte{first, byte(len(payload))}, payload...))
+}
+
+// upgrades the request and hands the raw connection to serve
+func newServer(t *testing.T, serve func(conn net.Conn, reader *bufio.Reader)) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\n" +
+			"Connection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + acceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n" +
+			"Sec-WebSocket-Protocol: " + strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",")[0] + "\r\n\r\n")
+		rw.Flush()
+
+		serve(conn, rw.Reader)
+	}))
+	t.Cleanup(server.Close)
+
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestFragmentedMessageAndPing(t *testing.T) {
+	events := captureEvents(t)
+	pong := make(chan []byte, 1)
+
+	url := newServer(t, func(conn net.Conn, reader *bufio.Reader) {
+		serverFrame(conn, false, opText, []byte("hel"))
+		// control frames can come between fragments
+		serverFrame(conn, true, opPing, []byte("ping"))
+		serverFrame(conn, false, opContinuation, []byte("lo "))
+		serverFrame(conn, true, opContinuation, []byte("world"))
+
+		f, err := readFrame(reader)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if f.opcode == opPong {
+			pong <- f.payload
+		}
+
+		serverFrame(conn, true, opBinary, []byte{1, 2, 3})
+		serverFrame(conn, true, opClose, closePayload(CLOSE_NORMAL, "done"))
+
+		readFrame(reader)
+	})
+
+	Open("test", url, nil, []string{"chat"})
+
+	if e := nextEvent(t, events); e.name != "open" || e.args[0] != "chat" {
+		t.Fatalf("unexpected %+v", e)
+	}
+
+	if e := nextEvent(t, events); e.name != "message" || e.args[0] != "hello world" {
+		t.Fatalf("unexpected %+v", e)
+	}
+
+	select {
+	case payload := <-pong:
+		if string(payload) != "ping" {
+			t.Fatalf("pong payload %q", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no pong")
+	}
+
+	if e := nextEvent(t, events); e.name != "message" || !bytes.Equal(e.args[0].([]byte), []byte{1, 2, 3}) {
+		t.Fatalf("unexpected %+v", e)
+	}
+
+	if e := nextEvent(t, events); e.name != "close" || e.args[0] != float64(CLOSE_NORMAL) || e.args[1] != "done" {
+		t.Fatalf("unexpected %+v", e)
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	events := captureEvents(t)
+	received := make(chan *frame, 2)
+
+	url := newServer(t, func(conn net.Conn, reader *bufio.Reader) {
+		for {
+			f, err := readFrame(reader)
+			if err != nil {
+				return
+			}
+			received <- f
+
+			if f.opcode == opClose {
+				code, _ := parseClosePayload(f.payload)
+				serverFrame(conn, true, opClose, closePayload(code, ""))
+				return
+			}
+		}
+	})
+
+	id := Open("test", url, nil, nil)
+
+	if e := nextEvent(t, events); e.name != "open" {
+		t.Fatalf("unexpected %+v", e)
+	}
+
+	if err := Send(id, "hi"); err != nil {
+		t.Fatalf("send: %s", err)
+	}
+
+	if f := <-received; f.opcode != opText || string(f.payload) != "hi" {
+		t.Fatalf("unexpected frame %+v", f)
+	}
+
+	if err := Close(id, 4000, "bye"); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+
+	f := <-received
+	code, reason := parseClosePayload(f.payload)
+	if f.opcode != opClose || code != 4000 || reason != "bye" {
+		t.Fatalf("unexpected close frame %d %q", code, reason)
+	}
+
+	// sending after close fails
+	if Send(id, "late") == nil {
+		t.Fatal("expected an error sending while closing")
+	}
+
+	if e := nextEvent(t, events); e.name != "close" || e.args[0] != float64(4000) {
+		t.Fatalf("unexpected %+v", e)
+	}
+
+	if _, err := getConn(id); err == nil {
+		t.Fatal("connection still registered after close")
+	}
+}
+
+func TestUnknownOpcode(t *testing.T) {
+	events := captureEvents(t)
+	closed := make(chan int, 1)
+
+	url := newServer(t, func(conn net.Conn, reader *bufio.Reader) {
+		serverFrame(conn, true, 0x3, nil)
+
+		f, err := readFrame(reader)
+		if err == nil && f.opcode == opClose {
+			code, _ := parseClosePayload(f.payload)
+			closed <- code
+		}
+	})
+
+	Open("test", url, nil, nil)
+
+	if e := nextEvent(t, events); e.name != "open" {
+		t.Fatalf("unexpected %+v", e)
+	}
+
+	if code := <-closed; code != CLOSE_PROTOCOL_ERROR {
+		t.Fatalf("expected protocol error close, got %d", code)
+	}
+
+	if e := nextEvent(t, events); e.name != "close" || e.args[0] != float64(CLOSE_PROTOCOL_ERROR) {
+		t.Fatalf("unexpected %+v", e)
+	}
+}
+
+func TestHandshakeFailure(t *testing.T) {
+	events := captureEvents(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	Open("test", "ws"+strings.TrimPrefix(server.URL, "http"), nil, nil)
+
+	if e := nextEvent(t, events); e.name != "error" {
+		t.Fatalf("unexpected %+v", e)
+	}
+
+	if e := nextEvent(t, events); e.name != "close" || e.args[0] != float64(CLOSE_ABNORMAL) {
+		t.Fatalf("unexpected %+v", e)
+	}
+}
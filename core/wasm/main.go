@@ -55,28 +55,59 @@ func vfs(this js.Value, args []js.Value) interface{} {
 
 	arrayConstructor := js.Global().Get("Uint8Array")
 
-	for name, f := range fs.VirtFS {
-		if !strings.HasPrefix(name, prefix) {
+	for _, entry := range fs.VirtualEntries("/") {
+		if entry.Path == "/" || !strings.HasPrefix(entry.Path, prefix) {
 			continue
 		}
 
-		dataJS := arrayConstructor.New(len(f.Data))
-		js.CopyBytesToJS(dataJS, f.Data)
-
-		fileMap[name] = dataJS
-	}
-
-	for _, dir := range fs.VirtDirs {
-		if !strings.HasPrefix(dir, prefix) {
+		if entry.IsDir {
+			fileMap[entry.Path] = nil
 			continue
 		}
 
-		fileMap[dir] = nil
+		dataJS := arrayConstructor.New(len(entry.Data))
+		js.CopyBytesToJS(dataJS, entry.Data)
+
+		fileMap[entry.Path] = dataJS
 	}
 
 	return js.ValueOf(fileMap)
 }
 
+func bytesToJS(data []byte) js.Value {
+	dataJS := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(dataJS, data)
+	return dataJS
+}
+
+// everything under prefix, serialized fs.VirtualDelta
+func vfsSnapshot(this js.Value, args []js.Value) interface{} {
+	return bytesToJS(fs.VirtualSnapshot(args[0].String()).Serialize())
+}
+
+// changes under prefix after the sequence, serialized fs.VirtualDelta
+func vfsChanges(this js.Value, args []js.Value) interface{} {
+	delta := fs.VirtualChanges(args[0].String(), uint64(args[1].Float()))
+	return bytesToJS(delta.Serialize())
+}
+
+// serialized fs.VirtualDelta, returns the error message or null
+func vfsImport(this js.Value, args []js.Value) interface{} {
+	data := make([]byte, args[0].Get("length").Int())
+	_ = js.CopyBytesToGo(data, args[0])
+
+	delta, err := fs.DeserializeVirtualDelta(data)
+	if err == nil {
+		err = fs.VirtualImport(delta)
+	}
+
+	if err != nil {
+		return js.ValueOf(err.Error())
+	}
+
+	return nil
+}
+
 func callback(projectId string, messageType string, message string) {
 	js.Global().Call("onmessageWASM", js.ValueOf(projectId), js.ValueOf(messageType), js.ValueOf(message))
 }
@@ -91,6 +122,9 @@ func main() {
 	js.Global().Set("directories", js.FuncOf(directories))
 	js.Global().Set("call", js.FuncOf(call))
 	js.Global().Set("vfs", js.FuncOf(vfs))
+	js.Global().Set("vfsSnapshot", js.FuncOf(vfsSnapshot))
+	js.Global().Set("vfsChanges", js.FuncOf(vfsChanges))
+	js.Global().Set("vfsImport", js.FuncOf(vfsImport))
 
 	<-c
 }
@@ -80,6 +80,8 @@ function fileEntriesToZipData(
         .flat();
 }
 
+// skip is a list of glob patterns with .gitignore semantics,
+// plain names are anchored to the root, e.g. "data" => "/data"
 export function zip(
     entry: FileEntries<string | Uint8Array>
 ): Promise<Uint8Array>;
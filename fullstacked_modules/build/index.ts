@@ -73,14 +73,90 @@ function buildResponse(buildResult: string) {
 }
 core_message.addListener("build", buildResponse);
 
+export type Diagnostic = {
+    // relative to the project directory
+    file: string;
+    // zero-based
+    start: { line: number; character: number };
+    end: { line: number; character: number };
+    code: number;
+    message: string;
+    severity: "error" | "warning" | "suggestion" | "message";
+};
+
+const activeTypeChecks = new Map<
+    number,
+    {
+        resolve: (diagnostics: Diagnostic[]) => void;
+        reject: (error: string) => void;
+    }
+>();
+
+function typecheckResponse(resultStr: string) {
+    const { id, diagnostics, error } = JSON.parse(resultStr);
+    const activeTypeCheck = activeTypeChecks.get(id);
+    activeTypeChecks.delete(id);
+
+    if (error) {
+        activeTypeCheck?.reject(error);
+    } else {
+        activeTypeCheck?.resolve(diagnostics);
+    }
+}
+core_message.addListener("typecheck", typecheckResponse);
+
+function diagnosticToMessage(project: Project, diagnostic: Diagnostic) {
+    return {
+        id: "TS" + diagnostic.code,
+        pluginName: "typecheck",
+        text: diagnostic.message,
+        location: diagnostic.file
+            ? {
+                  file: project
+                      ? project.id + "/" + diagnostic.file
+                      : diagnostic.file,
+                  namespace: "file",
+                  line: diagnostic.start.line + 1,
+                  column: diagnostic.start.character,
+                  length:
+                      diagnostic.start.line === diagnostic.end.line
+                          ? diagnostic.end.character -
+                            diagnostic.start.character
+                          : 0,
+                  lineText: "",
+                  suggestion: ""
+              }
+            : null,
+        notes: [],
+        detail: null
+    } as Message;
+}
+
 // 55
 export function esbuildVersion(): Promise<string> {
     const payload = new Uint8Array([55]);
     return bridge(payload, ([str]) => str);
 }
 
+type BuildOptions = {
+    // fail the build on type errors
+    typecheck: boolean;
+};
+
 // 56
-export function buildProject(project?: Project): Promise<Message[]> {
+export async function buildProject(
+    project?: Project,
+    options?: Partial<BuildOptions>
+): Promise<Message[]> {
+    if (options?.typecheck) {
+        const typeErrors = (await typecheck(project)).filter(
+            ({ severity }) => severity === "error"
+        );
+        if (typeErrors.length) {
+            return typeErrors.map((d) => diagnosticToMessage(project, d));
+        }
+    }
+
     const args: any[] = project ? [project.id] : [];
 
     const buildId = getLowestKeyIdAvailable(activeBuilds);
@@ -104,6 +180,29 @@ export function shouldBuild(project: Project): Promise<boolean> {
     return bridge(payload, ([should]) => should);
 }
 
+// 96
+// checks every source file of the project
+// with the embedded typescript-go language server
+export function typecheck(project?: Project): Promise<Diagnostic[]> {
+    const args: any[] = project ? [project.id] : [];
+
+    const typecheckId = getLowestKeyIdAvailable(activeTypeChecks);
+    args.push(typecheckId);
+
+    const payload = new Uint8Array([96, ...serializeArgs(args)]);
+
+    return new Promise((resolve, reject) => {
+        activeTypeChecks.set(typecheckId, {
+            resolve,
+            reject
+        });
+        bridge(payload).catch((e) => {
+            activeTypeChecks.delete(typecheckId);
+            reject(e);
+        });
+    });
+}
+
 function isPlainObject(input: any) {
     return input && !Array.isArray(input) && typeof input === "object";
 }
@@ -121,7 +220,8 @@ function uncapitalizeKeys<T>(obj: T) {
 const build = {
     esbuildVersion,
     buildProject,
-    shouldBuild
+    shouldBuild,
+    typecheck
 };
 
 export default build;
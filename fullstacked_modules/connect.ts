@@ -1,6 +1,7 @@
 import { bridge } from "./bridge";
 import {
     deserializeArgs,
+    getLowestKeyIdAvailable,
     numberTo4Bytes,
     serializeArgs
 } from "./bridge/serialization";
@@ -11,15 +12,34 @@ export type Data = string | number | boolean | Uint8Array;
 
 type DataChannelCallback = (data: Data[]) => void;
 
-type DataChannel = {
+// error is followed by closed, unless reconnecting
+export type ChannelStatus = "connected" | "error" | "closed";
+
+type ChannelStatusCallback = (status: ChannelStatus, message?: string) => void;
+
+type ChannelLifecycle = {
+    close(): Promise<void>;
+    onStatus(callback: ChannelStatusCallback): void;
+    offStatus(callback: ChannelStatusCallback): void;
+};
+
+type DataChannel = ChannelLifecycle & {
     send(...args: Data[]): void;
+    // rpc to a method handled by the server channel,
+    // timeout in ms, 0 for none
+    call(method: string, args?: Data[], timeout?: number): Promise<Data[]>;
     on(callback: DataChannelCallback): void;
     off(callback: DataChannelCallback): void;
 };
 
+type PendingCall = {
+    resolve: (results: Data[]) => void;
+    reject: (e: Error) => void;
+};
+
 type DataChannelRawCallback = (data: Uint8Array) => void;
 
-type DataChannelRaw = {
+type DataChannelRaw = ChannelLifecycle & {
     send(buffer: Uint8Array): void;
     on(callback: DataChannelRawCallback): void;
     off(callback: DataChannelRawCallback): void;
@@ -37,31 +57,87 @@ type ChannelRaw = {
 
 const channels = new Map<string, Channel | ChannelRaw>();
 
+function channelLifecycle(channelId: string): ChannelLifecycle {
+    const statusListeners = new Set<ChannelStatusCallback>();
+    let lastStatus: ChannelStatus = null;
+
+    core_message.addListener("channel-status-" + channelId, (dataStr) => {
+        const [status, message] = deserializeArgs(toByteArray(dataStr));
+        lastStatus = status;
+        if (status === "closed") {
+            channels.delete(channelId);
+        }
+        statusListeners.forEach((cb) => cb(status, message));
+    });
+
+    return {
+        close: () => close(channelId),
+        onStatus: (cb) => {
+            statusListeners.add(cb);
+            // the first connection happens before
+            // the channel is returned
+            if (lastStatus === "connected") {
+                cb(lastStatus);
+            }
+        },
+        offStatus: (cb) => statusListeners.delete(cb)
+    };
+}
+
+type ConnectOptions = {
+    // for channels requiring a shared secret
+    token: string;
+    // true for the system CAs, or
+    // ca: PEM certificates trusted on top of the system ones
+    // fingerprint: SHA-256 of a self-signed server certificate, hex
+    tls: boolean | { ca?: string; fingerprint?: string };
+};
+
 // 20
+// with reconnect, the channel retries with backoff until closed
 export function connect(
     name: string,
     port: number,
     host?: string,
-    raw?: false
+    raw?: false,
+    reconnect?: boolean,
+    options?: Partial<ConnectOptions>
 ): Promise<DataChannel>;
 export function connect(
     name: string,
     port: number,
     host: string,
-    raw: true
+    raw: true,
+    reconnect?: boolean,
+    options?: Partial<ConnectOptions>
 ): Promise<DataChannelRaw>;
 export function connect(
     name: string,
     port: number,
     host = "localhost",
-    raw = false
+    raw = false,
+    reconnect = false,
+    options?: Partial<ConnectOptions>
 ) {
+    const tls = typeof options?.tls === "object" ? options.tls : null;
     const payload = new Uint8Array([
         20,
-        ...serializeArgs([name, port, host, raw])
+        ...serializeArgs([
+            name,
+            port,
+            host,
+            raw,
+            reconnect,
+            options?.token || "",
+            !!options?.tls,
+            tls?.ca || "",
+            tls?.fingerprint || ""
+        ])
     ]);
 
     const transformer = ([channelId]) => {
+        const lifecycle = channelLifecycle(channelId);
+
         if (raw) {
             const listeners = new Set<DataChannelRawCallback>();
 
@@ -78,6 +154,7 @@ export function connect(
             });
 
             return {
+                ...lifecycle,
                 send: (data) => send(channelId, data),
                 on: (cb) => listeners.add(cb),
                 off: (cb) => listeners.add(cb)
@@ -95,9 +172,26 @@ export function connect(
                 listeners.forEach((cb) => cb(deserializeArgs(data)));
             });
 
+            const calls = new Map<number, PendingCall>();
+
+            core_message.addListener("channel-rpc-" + channelId, (dataStr) => {
+                const [callId, ok, ...results] = deserializeArgs(
+                    toByteArray(dataStr)
+                );
+                const pending = calls.get(callId);
+                if (!pending) return;
+                calls.delete(callId);
+                if (ok) {
+                    pending.resolve(results);
+                } else {
+                    pending.reject(new Error(results[0]));
+                }
+            });
+
             channels.set(channelId, channel);
 
             return {
+                ...lifecycle,
                 send: (...data) => {
                     const body = serializeArgs(data);
                     send(
@@ -108,6 +202,17 @@ export function connect(
                         ])
                     );
                 },
+                call: (method, args = [], timeout = 30000) =>
+                    new Promise<Data[]>((resolve, reject) => {
+                        const callId = getLowestKeyIdAvailable(calls);
+                        calls.set(callId, { resolve, reject });
+                        call(channelId, callId, method, args, timeout).catch(
+                            (e) => {
+                                calls.delete(callId);
+                                reject(e);
+                            }
+                        );
+                    }),
                 on: (cb) => listeners.add(cb),
                 off: (cb) => listeners.add(cb)
             } as DataChannel;
@@ -124,4 +229,27 @@ function send(channelId: string, data: Uint8Array) {
     return bridge(payload);
 }
 
+// 22
+function close(channelId: string) {
+    const payload = new Uint8Array([22, ...serializeArgs([channelId])]);
+
+    return bridge(payload);
+}
+
+// 23
+function call(
+    channelId: string,
+    callId: number,
+    method: string,
+    args: Data[],
+    timeout: number
+) {
+    const payload = new Uint8Array([
+        23,
+        ...serializeArgs([channelId, callId, timeout, method, ...args])
+    ]);
+
+    return bridge(payload);
+}
+
 export default connect;
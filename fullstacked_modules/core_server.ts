@@ -0,0 +1,45 @@
+import { bridge } from "./bridge";
+import { serializeArgs } from "./bridge/serialization";
+
+// http server for the project files and its build,
+// to open the app in external browsers.
+// Editor only, dot directories and data/ are not served
+
+type ServerOptions = {
+    // 0 picks a free port
+    port: number;
+    // use 0.0.0.0 to reach the server from the LAN
+    host: string;
+};
+
+// 101
+// resolves with the port listened to
+export function start(
+    projectId: string,
+    options?: Partial<ServerOptions>
+): Promise<number> {
+    const payload = new Uint8Array([
+        101,
+        ...serializeArgs([
+            projectId,
+            options?.port || 0,
+            options?.host || "localhost"
+        ])
+    ]);
+
+    const transformer = ([port]) => port;
+
+    return bridge(payload, transformer);
+}
+
+// 102
+export function stop(projectId: string) {
+    const payload = new Uint8Array([102, ...serializeArgs([projectId])]);
+
+    return bridge(payload);
+}
+
+export default {
+    start,
+    stop
+};
@@ -15,6 +15,8 @@ type FetchOptions = {
     headers: Record<string, string>;
     body: string | Uint8Array;
     timeout: number;
+    // named cookie jar, persisted per project
+    cookieJar: string;
 };
 
 type FetchResponse = {
@@ -103,7 +105,8 @@ export default function core_fetch(
             headers,
             body,
             timeout,
-            options?.encoding === "utf8"
+            options?.encoding === "utf8",
+            options?.cookieJar || ""
         ])
     ]);
 
@@ -123,6 +126,7 @@ export default function core_fetch(
 
 type ActiveRequest = {
     url: string;
+    onUploadProgress?: (sent: number, total: number) => void;
     resolveResponse(response: Response): void;
     resolveStream?: (param: { done: boolean; chunk: Uint8Array }) => void;
 };
@@ -256,28 +260,59 @@ function receivedResponse2(base64Data: string) {
     request.resolveResponse(response);
 }
 
+// per-request client options, on top of RequestInit
+export type Fetch2Options = RequestInit & {
+    // seconds, 0 or undefined is no timeout
+    timeout?: number;
+    tls?: {
+        // PEM encoded certificates
+        ca?: string;
+        // local dev only
+        insecure?: boolean;
+    };
+    proxy?: string;
+    // named cookie jar persisted per project, no cookies if undefined
+    cookieJar?: string;
+    // project file path, streamed from disk instead of body
+    bodyFile?: string;
+    // total is -1 for streamed bodies
+    onUploadProgress?: (sent: number, total: number) => void;
+};
+
+let addedUploadListener = false;
+function receivedUploadProgress(base64Data: string) {
+    const data = toByteArray(base64Data);
+    const [id, sent, total] = deserializeArgs(data);
+    activeFetch2Requests.get(id)?.onUploadProgress?.(sent, total);
+}
+
 export function core_fetch2(request: Request): Promise<Response>;
 export function core_fetch2(
     url: string | URL,
-    options?: RequestInit
+    options?: Fetch2Options
 ): Promise<Response>;
 export async function core_fetch2(
     urlOrRequest: string | URL | Request,
-    options?: RequestInit
+    options?: Fetch2Options
 ): Promise<Response> {
     if (!addedListener2) {
         core_message.addListener("fetch2-response", receivedResponse2);
         addedListener2 = true;
     }
 
+    if (options?.onUploadProgress && !addedUploadListener) {
+        core_message.addListener("fetch2-upload", receivedUploadProgress);
+        addedUploadListener = true;
+    }
+
     if (urlOrRequest instanceof Request) {
-        const bodyReader = urlOrRequest.body?.getReader();
-        const body = bodyReader ? (await bodyReader.read()).value : "";
+        const body = urlOrRequest.body;
 
         options = {
             method: urlOrRequest.method,
             headers: urlOrRequest.headers,
             signal: urlOrRequest.signal,
+            redirect: urlOrRequest.redirect,
             body
         };
 
@@ -291,7 +326,7 @@ export async function core_fetch2(
 }
 
 // 16
-function fetch2(url: string, options?: RequestInit): Promise<Response> {
+function fetch2(url: string, options?: Fetch2Options): Promise<Response> {
     const id = getLowestKeyIdAvailable(activeFetch2Requests);
 
     const headers = options?.headers
@@ -299,11 +334,25 @@ function fetch2(url: string, options?: RequestInit): Promise<Response> {
             ? JSON.stringify(headersToObject(options.headers))
             : JSON.stringify(options.headers)
         : "";
-    const body = options?.body
-        ? typeof options.body === "string"
-            ? te.encode(options.body)
-            : options.body
-        : new Uint8Array();
+    const bodyStream =
+        options?.body instanceof ReadableStream ? options.body : null;
+    const body =
+        options?.body && !bodyStream
+            ? typeof options.body === "string"
+                ? te.encode(options.body)
+                : options.body
+            : new Uint8Array();
+
+    const requestOptions = JSON.stringify({
+        timeout: options?.timeout || 0,
+        redirect: options?.redirect || "follow",
+        tls: options?.tls || {},
+        proxy: options?.proxy || "",
+        cookieJar: options?.cookieJar || "",
+        bodyFile: options?.bodyFile || "",
+        bodyStream: !!bodyStream,
+        uploadProgress: !!options?.onUploadProgress
+    });
 
     if (options?.signal) {
         options.signal.onabort = () => {
@@ -315,18 +364,135 @@ function fetch2(url: string, options?: RequestInit): Promise<Response> {
     const payload = new Uint8Array([
         16,
 
-        ...serializeArgs([id, options?.method || "GET", url, headers, body])
+        ...serializeArgs([
+            id,
+            options?.method || "GET",
+            url,
+            headers,
+            body,
+            requestOptions
+        ])
     ]);
 
     return new Promise<Response>((resolve) => {
         activeFetch2Requests.set(id, {
             url,
+            onUploadProgress: options?.onUploadProgress,
             resolveResponse: resolve
         });
         bridge(payload);
+        if (bodyStream) {
+            streamBody(id, bodyStream);
+        }
     });
 }
 
+// 17
+async function streamBody(id: number, stream: ReadableStream) {
+    const reader = stream.getReader();
+    let done = false;
+    while (!done) {
+        const result = await reader.read();
+        done = result.done;
+        const chunk =
+            typeof result.value === "string"
+                ? te.encode(result.value)
+                : result.value || new Uint8Array();
+        const payload = new Uint8Array([
+            17,
+            ...serializeArgs([id, chunk, done])
+        ]);
+        await bridge(payload);
+    }
+}
+
+export type Cookie = {
+    jar: string;
+    name: string;
+    value: string;
+    domain: string;
+    path: string;
+    // ms timestamp, 0 for session cookies
+    expires: number;
+    secure: boolean;
+    httpOnly: boolean;
+};
+
+// 18
+// all jars if jar is undefined
+export function cookies(jar?: string): Promise<Cookie[]> {
+    const payload = new Uint8Array([18, ...serializeArgs([jar || ""])]);
+
+    const transformer = (cookiesArgs: (string | number | boolean)[]) => {
+        const cookies: Cookie[] = [];
+
+        for (let i = 0; i < cookiesArgs.length; i = i + 8) {
+            cookies.push({
+                jar: cookiesArgs[i] as string,
+                name: cookiesArgs[i + 1] as string,
+                value: cookiesArgs[i + 2] as string,
+                domain: cookiesArgs[i + 3] as string,
+                path: cookiesArgs[i + 4] as string,
+                expires: cookiesArgs[i + 5] as number,
+                secure: cookiesArgs[i + 6] as boolean,
+                httpOnly: cookiesArgs[i + 7] as boolean
+            });
+        }
+
+        return cookies;
+    };
+
+    return bridge(payload, transformer);
+}
+
+// 19
+// all jars if jar is undefined
+export function clearCookies(jar?: string) {
+    const payload = new Uint8Array([19, ...serializeArgs([jar || ""])]);
+    return bridge(payload);
+}
+
+export type MockRule = {
+    // any method if undefined
+    method?: string;
+    // full url, * matches anything
+    url: string;
+    status?: number;
+    headers?: Record<string, string>;
+    body?: string;
+    // project file path used as body
+    file?: string;
+    // milliseconds
+    delay?: number;
+};
+
+// 24
+// rules are matched in order before the network,
+// no rules to stop mocking
+export function mock(rules: MockRule[] = []) {
+    const payload = new Uint8Array([
+        24,
+        ...serializeArgs([rules.length ? JSON.stringify(rules) : ""])
+    ]);
+    return bridge(payload);
+}
+
+// 25
+// records responses to a HAR file in the project,
+// no file to stop and write the recording
+export function record(file?: string) {
+    const payload = new Uint8Array([25, ...serializeArgs([file || ""])]);
+    return bridge(payload);
+}
+
+// 26
+// serves responses from a HAR file in the project,
+// no file to stop replaying
+export function replay(file?: string) {
+    const payload = new Uint8Array([26, ...serializeArgs([file || ""])]);
+    return bridge(payload);
+}
+
 function objectToHeaders(o: Record<string, string>) {
     const headers = new Headers();
     Object.entries(o).forEach(([n, v]) => {
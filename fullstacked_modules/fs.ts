@@ -1,5 +1,9 @@
 import { bridge } from "./bridge";
-import { serializeArgs } from "./bridge/serialization";
+import {
+    getLowestKeyIdAvailable,
+    serializeArgs
+} from "./bridge/serialization";
+import core_message from "./core_message";
 
 const te = new TextEncoder();
 
@@ -47,34 +51,38 @@ export type FileInfo = {
     isDirectory: boolean;
 };
 
-// 5
+type ReadDirOptions = {
+    recursive?: boolean;
+    filesOnly?: boolean;
+    // glob patterns with .gitignore semantics,
+    // skipped directories are not walked
+    skip?: string[];
+    // only list the files matching one of these globs
+    include?: string[];
+};
+
+// 27
 export function readdir(
     path: string,
-    options?: {
-        recursive?: boolean;
-        withFileTypes?: false;
-        filesOnly?: boolean;
-    }
+    options?: ReadDirOptions & { withFileTypes?: false }
 ): Promise<string[]>;
 export function readdir(
     path: string,
-    options?: { recursive?: boolean; withFileTypes: true; filesOnly?: boolean }
+    options?: ReadDirOptions & { withFileTypes: true }
 ): Promise<FileInfo[]>;
 export function readdir(
     path: string,
-    options?: {
-        recursive?: boolean;
-        withFileTypes?: boolean;
-        filesOnly?: boolean;
-    }
+    options?: ReadDirOptions & { withFileTypes?: boolean }
 ) {
     const payload = new Uint8Array([
-        5,
+        27,
         ...serializeArgs([
             path,
             !!options?.recursive,
             !!options?.withFileTypes,
-            !!options?.filesOnly
+            !!options?.filesOnly,
+            options?.skip ? JSON.stringify(options.skip) : "",
+            options?.include ? JSON.stringify(options.include) : ""
         ])
     ]);
 
@@ -169,6 +177,201 @@ export function stat(path: string): Promise<FileStats> {
     return bridge(payload, transformer);
 }
 
+export type SearchOptions = {
+    query: string;
+    regex?: boolean;
+    caseSensitive?: boolean;
+    wholeWord?: boolean;
+    include?: string[];
+    exclude?: string[];
+    // glob patterns, defaults to [".git", "node_modules", "/.build"]
+    skip?: string[];
+    maxResults?: number;
+    // only search these files
+    files?: string[];
+};
+
+export type SearchMatch = {
+    // zero-based
+    line: number;
+    character: number;
+    length: number;
+    preview: string;
+    previewCharacter: number;
+};
+
+export type SearchResult = {
+    files: number;
+    matches: number;
+    truncated: boolean;
+};
+
+const activeSearches = new Map<
+    number,
+    {
+        onFile: (file: string, matches: SearchMatch[]) => void;
+        resolve: (result: SearchResult) => void;
+        reject: (error: string) => void;
+    }
+>();
+
+function searchResponse(messageStr: string) {
+    const { id, file, matches, done, error, ...result } =
+        JSON.parse(messageStr);
+    const activeSearch = activeSearches.get(id);
+
+    if (!done) {
+        activeSearch?.onFile(file, matches);
+        return;
+    }
+
+    activeSearches.delete(id);
+
+    if (error) {
+        activeSearch?.reject(error);
+    } else {
+        activeSearch?.resolve(result);
+    }
+}
+core_message.addListener("fs-search", searchResponse);
+
+// 11
+// matches are streamed to onFile, one call per file
+export function search(
+    path: string,
+    options: SearchOptions,
+    onFile: (file: string, matches: SearchMatch[]) => void
+): Promise<SearchResult> {
+    const searchId = getLowestKeyIdAvailable(activeSearches);
+
+    const payload = new Uint8Array([
+        11,
+        ...serializeArgs([path, searchId, JSON.stringify(options)])
+    ]);
+
+    return new Promise((resolve, reject) => {
+        activeSearches.set(searchId, {
+            onFile,
+            resolve,
+            reject
+        });
+        bridge(payload).catch((e) => {
+            activeSearches.delete(searchId);
+            reject(e);
+        });
+    });
+}
+
+export type ReplaceResult = {
+    files: number;
+    replacements: number;
+};
+
+const activeReplaces = new Map<
+    number,
+    {
+        resolve: (result: ReplaceResult) => void;
+        reject: (error: string) => void;
+    }
+>();
+
+function replaceResponse(messageStr: string) {
+    const { id, error, ...result } = JSON.parse(messageStr);
+    const activeReplace = activeReplaces.get(id);
+    activeReplaces.delete(id);
+
+    if (error) {
+        activeReplace?.reject(error);
+    } else {
+        activeReplace?.resolve(result);
+    }
+}
+core_message.addListener("fs-replace", replaceResponse);
+
+// 12
+// regex replacements can use $1 or ${name}
+export function replace(
+    path: string,
+    options: SearchOptions,
+    replacement: string,
+    origin = ""
+): Promise<ReplaceResult> {
+    const replaceId = getLowestKeyIdAvailable(activeReplaces);
+
+    const payload = new Uint8Array([
+        12,
+        ...serializeArgs([
+            path,
+            replaceId,
+            JSON.stringify(options),
+            replacement,
+            origin
+        ])
+    ]);
+
+    return new Promise((resolve, reject) => {
+        activeReplaces.set(replaceId, { resolve, reject });
+        bridge(payload).catch((e) => {
+            activeReplaces.delete(replaceId);
+            reject(e);
+        });
+    });
+}
+
+// 13
+// report the changes made outside of FullStacked
+// as file events with the "external" origin
+export function watch(path: string): Promise<void> {
+    const payload = new Uint8Array([13, ...serializeArgs([path])]);
+
+    return bridge(payload);
+}
+
+// 14
+export function unwatch(path: string): Promise<void> {
+    const payload = new Uint8Array([14, ...serializeArgs([path])]);
+
+    return bridge(payload);
+}
+
+export enum FileEventType {
+    UNKNOWN = 0,
+    CREATED = 1,
+    MODIFIED = 2,
+    RENAME = 3,
+    DELETED = 4
+}
+
+export type FileEvent = {
+    type: FileEventType;
+    paths: string[];
+    isFile: boolean;
+    origin: string;
+};
+
+// 28
+// receive the file events of this project to "file-event",
+// coalesced and batched. Replaces the previous subscription
+export function subscribe(options?: {
+    // only these origins
+    origins?: string[];
+    ignoreOrigins?: string[];
+}): Promise<void> {
+    const payload = new Uint8Array([
+        28,
+        ...serializeArgs([options ? JSON.stringify(options) : ""])
+    ]);
+
+    return bridge(payload);
+}
+
+// 29
+export function unsubscribe(): Promise<void> {
+    const payload = new Uint8Array([29]);
+
+    return bridge(payload);
+}
+
 const fs = {
     readFile,
     writeFile,
@@ -178,6 +381,12 @@ const fs = {
     rmdir,
     exists,
     rename,
-    stat
+    stat,
+    search,
+    replace,
+    watch,
+    unwatch,
+    subscribe,
+    unsubscribe
 };
 export default fs;
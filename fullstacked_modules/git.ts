@@ -42,11 +42,12 @@ export function clone(url: string, into: string) {
 // 71
 export function head(
     projectId: string
-): Promise<{ name: string; hash: string }> {
+): Promise<{ name: string; hash: string; ahead: number; behind: number }> {
     const payload = new Uint8Array([71, ...serializeArgs([projectId])]);
 
-    const transformer = ([name, hash]) => {
-        return { name, hash };
+    // ahead and behind are -1 without upstream
+    const transformer = ([name, hash, ahead, behind]) => {
+        return { name, hash, ahead, behind };
     };
 
     return bridge(payload, transformer);
@@ -101,14 +102,17 @@ export enum PullResponse {
     UNAUTHORIZED = "authentication required",
     UNREACHABLE = "unreacheable"
 }
-export async function pull(project?: Project): Promise<PullResponse> {
+export async function pull(
+    project?: Project,
+    remote?: string
+): Promise<PullResponse> {
     setListenerOnce();
 
-    const args = project ? serializeArgs([project.id]) : [];
+    const args = project ? serializeArgs([project.id, remote || ""]) : [];
 
     const payload = new Uint8Array([73, ...args]);
 
-    const url = await remoteUrl(project);
+    const url = await remoteUrl(project, remote);
     let p = pullPromises.get(url);
     if (!p) {
         p = [];
@@ -135,19 +139,23 @@ export function restore(projectId: string, files: string[]): Promise<void> {
 export function checkout(
     project: Project,
     branch: string,
-    create: boolean = false
+    create: boolean = false,
+    remote: string = ""
 ) {
     const payload = new Uint8Array([
         75,
-        ...serializeArgs([project.id, branch, create])
+        ...serializeArgs([project.id, branch, create, remote])
     ]);
 
     return bridge(payload);
 }
 
 // 76
-export function fetch(project: Project): Promise<void> {
-    const payload = new Uint8Array([76, ...serializeArgs([project.id])]);
+export function fetch(project: Project, remote: string = ""): Promise<void> {
+    const payload = new Uint8Array([
+        76,
+        ...serializeArgs([project.id, remote])
+    ]);
     return bridge(payload);
 }
 
@@ -170,21 +178,31 @@ type Branch = {
     name: string;
     remote: boolean;
     local: boolean;
+    ahead: number;
+    behind: number;
 };
 
 // 78
-export async function branches(project: Project): Promise<Branch[]> {
-    const payload = new Uint8Array([78, ...serializeArgs([project.id])]);
+export async function branches(
+    project: Project,
+    remote: string = ""
+): Promise<Branch[]> {
+    const payload = new Uint8Array([
+        78,
+        ...serializeArgs([project.id, remote])
+    ]);
 
-    // [name, isLocal, isRemote, name, isLocal, isRemote, ...]
-    const transformer = (branchesArgs: (string | boolean)[]) => {
+    // [name, isRemote, isLocal, ahead, behind, name, ...]
+    const transformer = (branchesArgs: (string | boolean | number)[]) => {
         const branches: Branch[] = [];
 
-        for (let i = 0; i < branchesArgs.length; i = i + 3) {
+        for (let i = 0; i < branchesArgs.length; i = i + 5) {
             branches.push({
                 name: branchesArgs[i] as string,
                 remote: branchesArgs[i + 1] as boolean,
-                local: branchesArgs[i + 2] as boolean
+                local: branchesArgs[i + 2] as boolean,
+                ahead: branchesArgs[i + 3] as number,
+                behind: branchesArgs[i + 4] as number
             });
         }
 
@@ -194,9 +212,23 @@ export async function branches(project: Project): Promise<Branch[]> {
     return bridge(payload, transformer);
 }
 
+type PushOptions = {
+    remote: string;
+    // defaults to all local branches
+    branch: string;
+    // force-with-lease
+    force: boolean;
+    setUpstream: boolean;
+    tags: string[];
+    allTags: boolean;
+};
+
 // 79
-export function push(project: Project) {
-    const payload = new Uint8Array([79, ...serializeArgs([project.id])]);
+export function push(project: Project, options?: Partial<PushOptions>) {
+    const payload = new Uint8Array([
+        79,
+        ...serializeArgs([project.id, options ? JSON.stringify(options) : ""])
+    ]);
     return bridge(payload);
 }
 
@@ -220,14 +252,169 @@ export function hasGit(project?: Project) {
 }
 
 // 83
-export function remoteUrl(project?: Project) {
-    const args = project ? [project.id] : [];
+export function remoteUrl(project?: Project, remote?: string) {
+    const args = project ? [project.id, remote || ""] : [];
 
     const payload = new Uint8Array([83, ...serializeArgs(args)]);
 
     return bridge(payload, ([url]) => url);
 }
 
+type Tag = {
+    name: string;
+    hash: string;
+    annotated: boolean;
+    message: string;
+};
+
+// 84
+export function tags(project: Project): Promise<Tag[]> {
+    const payload = new Uint8Array([84, ...serializeArgs([project.id])]);
+
+    // [name, hash, annotated, message, name, hash, annotated, message, ...]
+    const transformer = (tagsArgs: (string | boolean)[]) => {
+        const tags: Tag[] = [];
+
+        for (let i = 0; i < tagsArgs.length; i = i + 4) {
+            tags.push({
+                name: tagsArgs[i] as string,
+                hash: tagsArgs[i + 1] as string,
+                annotated: tagsArgs[i + 2] as boolean,
+                message: tagsArgs[i + 3] as string
+            });
+        }
+
+        return tags;
+    };
+
+    return bridge(payload, transformer);
+}
+
+// 85
+// no message creates a lightweight tag
+export function tagCreate(
+    project: Project,
+    name: string,
+    ref: string = "",
+    message: string = ""
+) {
+    const payload = new Uint8Array([
+        85,
+        ...serializeArgs([
+            project.id,
+            name,
+            ref,
+            message,
+            project.gitRepository.name || "",
+            project.gitRepository.email || ""
+        ])
+    ]);
+
+    return bridge(payload);
+}
+
+// 86
+export function tagDelete(project: Project, name: string) {
+    const payload = new Uint8Array([86, ...serializeArgs([project.id, name])]);
+
+    return bridge(payload);
+}
+
+type Remote = {
+    name: string;
+    url: string;
+};
+
+// 110
+export function remotes(project: Project): Promise<Remote[]> {
+    const payload = new Uint8Array([110, ...serializeArgs([project.id])]);
+
+    // [name, url, name, url, ...]
+    const transformer = (remotesArgs: string[]) => {
+        const remotes: Remote[] = [];
+
+        for (let i = 0; i < remotesArgs.length; i = i + 2) {
+            remotes.push({
+                name: remotesArgs[i],
+                url: remotesArgs[i + 1]
+            });
+        }
+
+        return remotes;
+    };
+
+    return bridge(payload, transformer);
+}
+
+// 111
+export function remoteAdd(project: Project, name: string, url: string) {
+    const payload = new Uint8Array([
+        111,
+        ...serializeArgs([project.id, name, url])
+    ]);
+
+    return bridge(payload);
+}
+
+// 112
+export function remoteRename(project: Project, name: string, newName: string) {
+    const payload = new Uint8Array([
+        112,
+        ...serializeArgs([project.id, name, newName])
+    ]);
+
+    return bridge(payload);
+}
+
+// 113
+export function remoteRemove(project: Project, name: string) {
+    const payload = new Uint8Array([113, ...serializeArgs([project.id, name])]);
+
+    return bridge(payload);
+}
+
+// 114
+export function remoteSetUrl(project: Project, name: string, url: string) {
+    const payload = new Uint8Array([
+        114,
+        ...serializeArgs([project.id, name, url])
+    ]);
+
+    return bridge(payload);
+}
+
+type BlameLine = {
+    hash: string;
+    authorName: string;
+    authorEmail: string;
+    date: Date;
+    summary: string;
+};
+
+// 115
+export function blame(project: Project, file: string): Promise<BlameLine[]> {
+    const payload = new Uint8Array([115, ...serializeArgs([project.id, file])]);
+
+    // [hash, authorName, authorEmail, date, summary, ...]
+    const transformer = (blameArgs: (string | number)[]) => {
+        const lines: BlameLine[] = [];
+
+        for (let i = 0; i < blameArgs.length; i = i + 5) {
+            lines.push({
+                hash: blameArgs[i] as string,
+                authorName: blameArgs[i + 1] as string,
+                authorEmail: blameArgs[i + 2] as string,
+                date: new Date(blameArgs[i + 3] as number),
+                summary: blameArgs[i + 4] as string
+            });
+        }
+
+        return lines;
+    };
+
+    return bridge(payload, transformer);
+}
+
 const git = {
     PullResponse,
     gitAuthResponse,
@@ -243,7 +430,16 @@ const git = {
     push,
     branchDelete,
     hasGit,
-    remoteUrl
+    remoteUrl,
+    tags,
+    tagCreate,
+    tagDelete,
+    remotes,
+    remoteAdd,
+    remoteRename,
+    remoteRemove,
+    remoteSetUrl,
+    blame
 };
 
 export default git;
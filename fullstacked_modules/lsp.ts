@@ -0,0 +1,33 @@
+import { bridge } from "./bridge";
+
+type LSPSession = {
+    transportId: string;
+    projectId: string;
+    // seconds since the last request or message
+    idle: number;
+};
+
+// 95
+// live sessions, app sessions idle for
+// 15 minutes are shut down, editor sessions are not
+export function list(): Promise<LSPSession[]> {
+    const payload = new Uint8Array([95]);
+
+    const transformer = (args: any[]) => {
+        const sessions: LSPSession[] = [];
+        for (let i = 0; i < args.length; i += 3) {
+            sessions.push({
+                transportId: args[i],
+                projectId: args[i + 1],
+                idle: args[i + 2]
+            });
+        }
+        return sessions;
+    };
+
+    return bridge(payload, transformer);
+}
+
+export default {
+    list
+};
@@ -0,0 +1,87 @@
+import { bridge } from "./bridge";
+import { deserializeArgs, serializeArgs } from "./bridge/serialization";
+import core_message from "./core_message";
+import { toByteArray } from "./base64";
+
+// WebSocket client running in the core,
+// not subject to CORS and mixed-content rules
+
+type WebSocketEvents = {
+    open: (protocol: string) => void;
+    message: (data: string | Uint8Array) => void;
+    error: (message: string) => void;
+    close: (code: number, reason: string) => void;
+};
+
+type WebSocketCore = {
+    id: string;
+    send(data: string | Uint8Array): Promise<void>;
+    close(code?: number, reason?: string): Promise<void>;
+    on<E extends keyof WebSocketEvents>(
+        event: E,
+        callback: WebSocketEvents[E]
+    ): void;
+    off<E extends keyof WebSocketEvents>(
+        event: E,
+        callback: WebSocketEvents[E]
+    ): void;
+};
+
+// 103
+export function websocket(
+    url: string,
+    protocols: string[] = [],
+    headers?: Record<string, string>
+): Promise<WebSocketCore> {
+    const payload = new Uint8Array([
+        103,
+        ...serializeArgs([
+            url,
+            headers ? JSON.stringify(headers) : "",
+            ...protocols
+        ])
+    ]);
+
+    const transformer = ([wsId]) => {
+        const listeners = new Map<keyof WebSocketEvents, Set<Function>>();
+
+        core_message.addListener("ws-" + wsId, (dataStr) => {
+            const [event, ...args] = deserializeArgs(toByteArray(dataStr));
+            listeners.get(event)?.forEach((cb) => cb(...args));
+        });
+
+        return {
+            id: wsId,
+            send: (data) => send(wsId, data),
+            close: (code, reason) => close(wsId, code, reason),
+            on: (event, cb) => {
+                let eventListeners = listeners.get(event);
+                if (!eventListeners) {
+                    eventListeners = new Set();
+                    listeners.set(event, eventListeners);
+                }
+                eventListeners.add(cb);
+            },
+            off: (event, cb) => listeners.get(event)?.delete(cb)
+        } as WebSocketCore;
+    };
+
+    return bridge(payload, transformer);
+}
+
+// 104
+function send(wsId: string, data: string | Uint8Array) {
+    const payload = new Uint8Array([104, ...serializeArgs([wsId, data])]);
+    return bridge(payload);
+}
+
+// 105
+function close(wsId: string, code = 1000, reason = "") {
+    const payload = new Uint8Array([
+        105,
+        ...serializeArgs([wsId, code, reason])
+    ]);
+    return bridge(payload);
+}
+
+export default websocket;
@@ -3,7 +3,10 @@ import { callLib, CoreCallbackListeners } from "./call";
 import { buildSASS } from "../../../fullstacked_modules/build/sass";
 import fs from "node:fs";
 import path from "node:path";
-import { serializeArgs } from "../../../fullstacked_modules/bridge/serialization";
+import {
+    deserializeArgs,
+    serializeArgs
+} from "../../../fullstacked_modules/bridge/serialization";
 import jsdom from "jsdom";
 
 function quickInstallPackage(editorHeader: Uint8Array, directory: string) {
@@ -113,3 +116,72 @@ export async function buildLocalProject(directory: string) {
         );
     });
 }
+
+type Diagnostic = {
+    file: string;
+    start: { line: number; character: number };
+    code: number;
+    message: string;
+    severity: string;
+};
+
+// resolves false if the project has type errors
+export function typecheckLocalProject(directory: string, json = false) {
+    const editorHeader = createPayloadHeader({
+        id: "",
+        isEditor: true
+    });
+
+    return new Promise<boolean>((resolve, reject) => {
+        const cb = (_: string, messageType: string, message: string) => {
+            if (messageType !== "typecheck") return;
+            CoreCallbackListeners.delete(cb);
+
+            const { diagnostics, error } = JSON.parse(message);
+
+            if (error) {
+                reject(error);
+                return;
+            }
+
+            if (json) {
+                console.log(JSON.stringify(diagnostics, null, 4));
+            } else {
+                diagnostics.forEach((d: Diagnostic) => {
+                    const location = d.file
+                        ? `${d.file}:${d.start.line + 1}:${d.start.character + 1} - `
+                        : "";
+                    console.log(
+                        `${location}${d.severity} TS${d.code}: ${d.message}\n`
+                    );
+                });
+            }
+
+            const errors = diagnostics.filter(
+                ({ severity }: Diagnostic) => severity === "error"
+            );
+            if (!json) {
+                console.log(`Found ${errors.length} error(s)`);
+            }
+            resolve(errors.length === 0);
+        };
+        CoreCallbackListeners.add(cb);
+
+        // typecheck project
+        const response = callLib(
+            new Uint8Array([
+                ...editorHeader,
+                96,
+                ...serializeArgs([directory, 0])
+            ])
+        );
+
+        // core built without typescript-go
+        try {
+            if (response?.byteLength) deserializeArgs(response);
+        } catch (e) {
+            CoreCallbackListeners.delete(cb);
+            reject(e);
+        }
+    });
+}
@@ -5,7 +5,7 @@ import url from "node:url";
 import { load, setDirectories, CoreCallbackListeners } from "./call";
 import { createWebView } from "./webview";
 import { createInstance } from "./instance";
-import { buildLocalProject } from "./build";
+import { buildLocalProject, typecheckLocalProject } from "./build";
 import { getLibPath } from "./lib";
 import { setupDevFiles } from "./dev-files";
 import { createRequire } from "node:module";
@@ -81,6 +81,17 @@ setDirectories({
             : path.resolve(currentDirectory, ".tmp")
 });
 
+// fullstacked typecheck [--json]
+// exits with 1 on type errors, for CI
+if (process.argv.at(2) === "typecheck") {
+    setupDevFiles();
+    const passed = await typecheckLocalProject(
+        ".",
+        process.argv.includes("--json")
+    );
+    process.exit(passed ? 0 : 1);
+}
+
 export const platform = new TextEncoder().encode("node");
 
 type WebView = Awaited<ReturnType<typeof createWebView>>;
@@ -107,6 +118,13 @@ const mainInstanceId =
         : ".";
 
 if (mainInstanceId === ".") {
+    // --typecheck fails the build on type errors
+    if (process.argv.includes("--typecheck")) {
+        setupDevFiles();
+        if (!(await typecheckLocalProject(mainInstanceId))) {
+            process.exit(1);
+        }
+    }
     await buildLocalProject(mainInstanceId);
     setupDevFiles();
 }
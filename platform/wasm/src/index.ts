@@ -3,7 +3,8 @@ import wb from "winbox/src/js/winbox";
 import type * as WinBoxType from "winbox";
 import {
     deserializeArgs,
-    numberTo4Bytes
+    numberTo4Bytes,
+    serializeArgs
 } from "../../../fullstacked_modules/bridge/serialization";
 import { toByteArray } from "../../../fullstacked_modules/base64";
 import prettyBytes from "pretty-bytes";
@@ -24,6 +25,10 @@ declare global {
         tmp: string
     ) => void;
     var call: (payload: Uint8Array) => Promise<string>; // base64
+    // serialized virtual fs deltas
+    var vfsSnapshot: (prefix: string) => Uint8Array;
+    var vfsChanges: (prefix: string, since: number) => Uint8Array;
+    var vfsImport: (delta: Uint8Array) => string | null; // error
 }
 
 type FullStackedWindow = Window & {
@@ -261,6 +266,155 @@ if (!unzipResult) {
 
 directories(dirs.root, dirs.config, dirs.editor, dirs.root + "/.tmp");
 
+// persist projects and config to IndexedDB,
+// one record per path, only the changes since the last save
+
+const persistedPrefixes = [dirs.root, dirs.config];
+// restored by directories() on every load
+const notPersistedPrefixes = [
+    dirs.root + "/.tmp",
+    dirs.root + "/.fullstacked_modules"
+];
+const vfsStore = "vfs";
+const metaStore = "meta";
+
+type VfsRecord = {
+    path: string;
+    isDir: boolean;
+    modTime: number;
+    data: Uint8Array;
+};
+
+const underPrefix = (path: string, prefix: string) =>
+    path === prefix || path.startsWith(prefix + "/");
+const isPersisted = (path: string) =>
+    !notPersistedPrefixes.some((prefix) => underPrefix(path, prefix));
+
+function idbRequest<T>(request: IDBRequest<T>) {
+    return new Promise<T>((res, rej) => {
+        request.onsuccess = () => res(request.result);
+        request.onerror = () => rej(request.error);
+    });
+}
+
+function openVfsDB() {
+    const request = indexedDB.open("fullstacked", 1);
+    request.onupgradeneeded = () => {
+        request.result.createObjectStore(vfsStore, { keyPath: "path" });
+        request.result.createObjectStore(metaStore);
+    };
+    return idbRequest(request);
+}
+
+// [sequence, full, prefix, deletedCount, ...deleted, ...(path, isDir, modTime, data)]
+function parseDelta(delta: Uint8Array) {
+    const args = deserializeArgs(delta);
+    const sequence: number = args[0];
+    const deletedCount: number = args[3];
+    const deleted: string[] = args.slice(4, 4 + deletedCount);
+    const records: VfsRecord[] = [];
+    for (let i = 4 + deletedCount; i < args.length; i += 4) {
+        records.push({
+            path: args[i],
+            isDir: args[i + 1],
+            modTime: args[i + 2],
+            data: args[i + 3]
+        });
+    }
+    return { sequence, deleted, records };
+}
+
+async function restoreVfs(db: IDBDatabase) {
+    const transaction = db.transaction([vfsStore, metaStore], "readonly");
+    const [records, sequence = 0] = await Promise.all([
+        idbRequest<VfsRecord[]>(transaction.objectStore(vfsStore).getAll()),
+        idbRequest<number>(
+            transaction.objectStore(metaStore).get("sequence")
+        )
+    ]);
+
+    // parents before their content
+    records.sort((a, b) => (a.path < b.path ? -1 : 1));
+
+    const delta = serializeArgs([
+        sequence,
+        false,
+        "/",
+        0,
+        ...records.flatMap((record) => [
+            record.path,
+            record.isDir,
+            record.modTime,
+            record.data
+        ])
+    ]);
+    const error = vfsImport(delta);
+    if (error) {
+        console.error("Failed to restore files", error);
+    }
+
+    return sequence;
+}
+
+async function persistVfs(db: IDBDatabase, since: number) {
+    const changes = persistedPrefixes.map((prefix) =>
+        parseDelta(vfsChanges(prefix, since))
+    );
+    const deleted = changes
+        .flatMap(({ deleted }) => deleted)
+        .filter(isPersisted);
+    const records = changes
+        .flatMap(({ records }) => records)
+        .filter(({ path }) => isPersisted(path));
+    const sequence = Math.max(...changes.map(({ sequence }) => sequence));
+
+    if (deleted.length === 0 && records.length === 0) {
+        return sequence;
+    }
+
+    const transaction = db.transaction([vfsStore, metaStore], "readwrite");
+    const store = transaction.objectStore(vfsStore);
+    for (const path of deleted) {
+        store.delete(path);
+        // "/" + 1 is "0", every key under path
+        store.delete(IDBKeyRange.bound(path + "/", path + "0", false, true));
+    }
+    for (const record of records) {
+        store.put(record);
+    }
+    transaction.objectStore(metaStore).put(sequence, "sequence");
+
+    await new Promise<void>((res, rej) => {
+        transaction.oncomplete = () => res();
+        transaction.onerror = () => rej(transaction.error);
+    });
+
+    return sequence;
+}
+
+try {
+    const db = await openVfsDB();
+    let sequence = await restoreVfs(db);
+    let persisting = false;
+    const persist = async () => {
+        if (persisting) return;
+        persisting = true;
+        try {
+            sequence = await persistVfs(db, sequence);
+        } catch (e) {
+            console.error("Failed to persist files", e);
+        }
+        persisting = false;
+    };
+    setInterval(persist, 2000);
+    window.addEventListener("pagehide", persist);
+    document.addEventListener("visibilitychange", () => {
+        if (document.visibilityState === "hidden") persist();
+    });
+} catch (e) {
+    console.error("Files will not be persisted", e);
+}
+
 // add FullStacked main projects list for Demo purpose
 
 const projectsListsConfig = {